@@ -0,0 +1,256 @@
+package pyrin
+
+import (
+	"net/http"
+	"strings"
+)
+
+type SecuritySchemeType string
+
+const (
+	SecuritySchemeBearer SecuritySchemeType = "bearer"
+	SecuritySchemeApiKey SecuritySchemeType = "apiKey"
+	SecuritySchemeBasic  SecuritySchemeType = "basic"
+	SecuritySchemeCookie SecuritySchemeType = "cookie"
+)
+
+type ApiKeyLocation string
+
+const (
+	ApiKeyInHeader ApiKeyLocation = "header"
+	ApiKeyInQuery  ApiKeyLocation = "query"
+)
+
+// Credentials are the credentials found in the request for a scheme
+type Credentials struct {
+	Scheme *SecurityScheme
+
+	// Token is the bearer token, the api key or the value of the cookie
+	Token string
+
+	// NOTE(patrik): Only set for basic auth
+	Username string
+	Password string
+}
+
+// Verifier checks the credentials and returns the principal, the principal
+// can be retrieved inside the handler with Principal. Returning a *Error
+// sends that error to the client, any other error becomes UNAUTHORIZED
+type Verifier func(c Context, credentials Credentials) (any, error)
+
+type SecurityScheme struct {
+	// Name identifies the scheme inside the server def and the clients
+	Name string
+	Type SecuritySchemeType
+
+	// In is where the api key is sent, only used by SecuritySchemeApiKey
+	In ApiKeyLocation
+	// ParamName is the name of the header, query parameter or cookie
+	ParamName string
+
+	Verifier Verifier
+}
+
+func BearerAuth(name string, verifier Verifier) *SecurityScheme {
+	return &SecurityScheme{
+		Name:     name,
+		Type:     SecuritySchemeBearer,
+		Verifier: verifier,
+	}
+}
+
+func ApiKeyAuth(name string, in ApiKeyLocation, paramName string, verifier Verifier) *SecurityScheme {
+	return &SecurityScheme{
+		Name:      name,
+		Type:      SecuritySchemeApiKey,
+		In:        in,
+		ParamName: paramName,
+		Verifier:  verifier,
+	}
+}
+
+func BasicAuth(name string, verifier Verifier) *SecurityScheme {
+	return &SecurityScheme{
+		Name:     name,
+		Type:     SecuritySchemeBasic,
+		Verifier: verifier,
+	}
+}
+
+func CookieAuth(name string, cookieName string, verifier Verifier) *SecurityScheme {
+	return &SecurityScheme{
+		Name:      name,
+		Type:      SecuritySchemeCookie,
+		ParamName: cookieName,
+		Verifier:  verifier,
+	}
+}
+
+func (s *SecurityScheme) credentials(r *http.Request) (Credentials, bool) {
+	res := Credentials{
+		Scheme: s,
+	}
+
+	switch s.Type {
+	case SecuritySchemeBearer:
+		auth := r.Header.Get("Authorization")
+
+		scheme, token, found := strings.Cut(auth, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return res, false
+		}
+
+		res.Token = strings.TrimSpace(token)
+	case SecuritySchemeApiKey:
+		switch s.In {
+		case ApiKeyInQuery:
+			res.Token = r.URL.Query().Get(s.ParamName)
+		default:
+			res.Token = r.Header.Get(s.ParamName)
+		}
+
+		if res.Token == "" {
+			return res, false
+		}
+	case SecuritySchemeBasic:
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			return res, false
+		}
+
+		res.Username = username
+		res.Password = password
+	case SecuritySchemeCookie:
+		cookie, err := r.Cookie(s.ParamName)
+		if err != nil || cookie.Value == "" {
+			return res, false
+		}
+
+		res.Token = cookie.Value
+	default:
+		return res, false
+	}
+
+	return res, true
+}
+
+func (s *SecurityScheme) challenge() string {
+	switch s.Type {
+	case SecuritySchemeBearer:
+		return "Bearer"
+	case SecuritySchemeBasic:
+		return "Basic"
+	}
+
+	return ""
+}
+
+// SecurityMiddleware requires one of the schemes to authenticate the
+// request, created with RequireAuth and added to a group with Group.With
+type SecurityMiddleware struct {
+	Schemes []*SecurityScheme
+}
+
+func (m SecurityMiddleware) middlewareType() {}
+
+// RequireAuth requires the requests to authenticate with one of the schemes,
+// the schemes are tried in order and the first one with credentials present
+// in the request is used
+func RequireAuth(schemes ...*SecurityScheme) SecurityMiddleware {
+	return SecurityMiddleware{
+		Schemes: schemes,
+	}
+}
+
+var principalKey = NewKey[any]("principal")
+
+// Principal returns the principal returned by the verifier of the scheme
+// that authenticated the request
+func Principal(c Context) any {
+	principal, _ := Get(c, principalKey)
+	return principal
+}
+
+func authenticate(ctx *wrapperContext, schemes []*SecurityScheme) error {
+	if len(schemes) == 0 {
+		return nil
+	}
+
+	for _, scheme := range schemes {
+		credentials, ok := scheme.credentials(ctx.r)
+		if !ok {
+			continue
+		}
+
+		if scheme.Verifier == nil {
+			return Unauthorized()
+		}
+
+		principal, err := scheme.Verifier(ctx, credentials)
+		if err != nil {
+			if e, ok := err.(*Error); ok {
+				return e
+			}
+
+			return Unauthorized()
+		}
+
+		Set(ctx, principalKey, principal)
+
+		return nil
+	}
+
+	for _, scheme := range schemes {
+		if challenge := scheme.challenge(); challenge != "" {
+			ctx.w.Header().Add("WWW-Authenticate", challenge)
+		}
+	}
+
+	return Unauthorized()
+}
+
+func (s *Server) authFailureKey(ctx *wrapperContext) (string, error) {
+	clientKey, err := s.authFailureLimit.clientKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return "authFailure|" + s.authFailureLimit.Name + "|" + clientKey, nil
+}
+
+// checkAuthFailures rejects the client when it has used up the
+// AuthFailureLimit, checked before the credentials so a client that is
+// limited can't tell if a guess was correct
+func (s *Server) checkAuthFailures(ctx *wrapperContext) error {
+	// NOTE(patrik): NewServer makes sure the store can peek
+	peeker := s.authFailureStore.(RateLimitPeeker)
+
+	key, err := s.authFailureKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := peeker.Peek(ctx.r.Context(), key, s.authFailureLimit)
+	if err != nil {
+		return err
+	}
+
+	if !res.Allowed {
+		ctx.w.Header().Set("Retry-After", ceilSeconds(res.RetryAfter))
+		return RateLimited(res.RetryAfter)
+	}
+
+	return nil
+}
+
+// recordAuthFailure counts a failed authentication against the
+// AuthFailureLimit of the client
+func (s *Server) recordAuthFailure(ctx *wrapperContext) error {
+	key, err := s.authFailureKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.authFailureStore.Take(ctx.r.Context(), key, s.authFailureLimit)
+	return err
+}
@@ -0,0 +1,154 @@
+package pyrin
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CachePolicy enables conditional requests for a GET ApiHandler, the server
+// answers If-None-Match and If-Modified-Since with 304 Not Modified
+type CachePolicy struct {
+	// ETag computes a weak ETag from the serialized response, the handler
+	// still runs for every request
+	ETag bool
+	// Validator returns the ETag and the modification time of the resource
+	// before the handler runs, the handler is skipped when the client has
+	// the current version. Used instead of ETag when set, an empty etag or
+	// a zero time is not sent
+	Validator func(c Context) (etag string, lastModified time.Time, err error)
+	// CacheControl is sent as the Cache-Control header, e.g.
+	// "private, max-age=60"
+	CacheControl string
+}
+
+func quoteETag(etag string) string {
+	if strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+
+	return `"` + etag + `"`
+}
+
+func weakETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `W/"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// NOTE(patrik): If-None-Match uses the weak comparison
+func matchETag(header, etag string) bool {
+	if header == "" || etag == "" {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return matchETag(inm, etag)
+	}
+
+	if lastModified.IsZero() {
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	// NOTE(patrik): HTTP dates has second precision
+	return !lastModified.Truncate(time.Second).After(ims)
+}
+
+func writeNotModified(w http.ResponseWriter) {
+	// NOTE(patrik): RFC 9110 says the 304 should not have the content
+	// headers
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// runCached runs a GET handler with the cache policy, only 200 responses
+// gets a ETag
+func runCached(ctx *wrapperContext, policy *CachePolicy, status int, handler ApiHandlerFunc) error {
+	header := ctx.w.Header()
+
+	if policy.CacheControl != "" {
+		header.Set("Cache-Control", policy.CacheControl)
+	}
+
+	if policy.Validator != nil {
+		etag, lastModified, err := policy.Validator(ctx)
+		if err != nil {
+			return err
+		}
+
+		if etag != "" {
+			etag = quoteETag(etag)
+			header.Set("ETag", etag)
+		}
+
+		if !lastModified.IsZero() {
+			header.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+		}
+
+		if notModified(ctx.r, etag, lastModified) {
+			writeNotModified(ctx.w)
+			return nil
+		}
+
+		data, err := handler(ctx)
+		if err != nil {
+			return err
+		}
+
+		writeApiResult(ctx, status, data)
+
+		return nil
+	}
+
+	data, err := handler(ctx)
+	if err != nil {
+		return err
+	}
+
+	status, data = resolveResult(ctx.w, status, data)
+	if status != http.StatusOK {
+		writeApiResult(ctx, status, data)
+		return nil
+	}
+
+	body, contentType, err := marshalSuccess(ctx.r, data)
+	if err != nil {
+		return err
+	}
+
+	if policy.ETag {
+		etag := weakETag(body)
+		header.Set("ETag", etag)
+
+		if notModified(ctx.r, etag, time.Time{}) {
+			writeNotModified(ctx.w)
+			return nil
+		}
+	}
+
+	writeBody(ctx.w, ctx.r, http.StatusOK, contentType, body)
+
+	return nil
+}
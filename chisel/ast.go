@@ -0,0 +1,54 @@
+package chisel
+
+type Operator string
+
+const (
+	OpEq Operator = "=="
+	OpNe Operator = "!="
+	OpLt Operator = "<"
+	OpLe Operator = "<="
+	OpGt Operator = ">"
+	OpGe Operator = ">="
+	// OpContains matches the strings that contains the value
+	OpContains    Operator = "~"
+	OpNotContains Operator = "!~"
+)
+
+// Expr is a node of a filter, one of *AndExpr, *OrExpr, *NotExpr or
+// *CompareExpr
+type Expr interface {
+	exprType()
+}
+
+type AndExpr struct {
+	Left  Expr
+	Right Expr
+}
+
+type OrExpr struct {
+	Left  Expr
+	Right Expr
+}
+
+type NotExpr struct {
+	Expr Expr
+}
+
+// CompareExpr compares a field with a value, Value is a string, int64,
+// float64, bool or time.Time depending on the type of the field and nil
+// when the field is compared with null
+type CompareExpr struct {
+	Field Field
+	Op    Operator
+	Value any
+}
+
+func (e *AndExpr) exprType()     {}
+func (e *OrExpr) exprType()      {}
+func (e *NotExpr) exprType()     {}
+func (e *CompareExpr) exprType() {}
+
+type SortField struct {
+	Field Field
+	Desc  bool
+}
@@ -0,0 +1,235 @@
+// Package chisel parses the filter and sort expressions of list endpoints,
+// e.g. filter=status=="active" && age>18 and sort=-createdAt,name. The
+// expressions are checked against a Schema and the AST can be translated
+// to SQL with bound parameters.
+package chisel
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type FieldType string
+
+const (
+	TypeString FieldType = "string"
+	TypeInt    FieldType = "int"
+	TypeFloat  FieldType = "float"
+	TypeBool   FieldType = "bool"
+	// TypeDate values is written as strings in RFC 3339 or as "2006-01-02"
+	TypeDate FieldType = "date"
+)
+
+var typeOperators = map[FieldType][]Operator{
+	TypeString: {OpEq, OpNe, OpLt, OpLe, OpGt, OpGe, OpContains, OpNotContains},
+	TypeInt:    {OpEq, OpNe, OpLt, OpLe, OpGt, OpGe},
+	TypeFloat:  {OpEq, OpNe, OpLt, OpLe, OpGt, OpGe},
+	TypeBool:   {OpEq, OpNe},
+	TypeDate:   {OpEq, OpNe, OpLt, OpLe, OpGt, OpGe},
+}
+
+// Operators returns the operators a field of type t can be filtered with
+func Operators(t FieldType) []Operator {
+	return typeOperators[t]
+}
+
+// Field is a field of the items that can be filtered or sorted
+type Field struct {
+	// Name is the name used in the expressions
+	Name string
+	Type FieldType
+	// Column is the column used by the SQL adapter, defaults to Name. The
+	// column is written to the SQL as is so it should never come from the
+	// request
+	Column string
+	Filter bool
+	Sort   bool
+	// Nullable allows the field to be compared with null
+	Nullable bool
+}
+
+// ColumnName returns the Column or the Name when the field has no column
+func (f *Field) ColumnName() string {
+	if f.Column != "" {
+		return f.Column
+	}
+
+	return f.Name
+}
+
+// Schema is the fields a list can be filtered and sorted by
+type Schema struct {
+	Fields []Field
+	// DefaultSort is used when the request has no sort, e.g. "-createdAt"
+	DefaultSort string
+}
+
+func (s *Schema) field(name string) *Field {
+	for i := range s.Fields {
+		if s.Fields[i].Name == name {
+			return &s.Fields[i]
+		}
+	}
+
+	return nil
+}
+
+// Validate checks that the fields has unique names and known types and
+// that the DefaultSort is valid
+func (s *Schema) Validate() error {
+	names := make(map[string]bool)
+
+	for _, f := range s.Fields {
+		if f.Name == "" {
+			return errors.New("field without a name")
+		}
+
+		if names[f.Name] {
+			return fmt.Errorf("field %q is declared multiple times", f.Name)
+		}
+		names[f.Name] = true
+
+		if _, exists := typeOperators[f.Type]; !exists {
+			return fmt.Errorf("field %q has unknown type %q", f.Name, f.Type)
+		}
+	}
+
+	_, err := s.ParseSort(s.DefaultSort)
+	if err != nil {
+		return fmt.Errorf("invalid DefaultSort: %w", err)
+	}
+
+	return nil
+}
+
+// Query is the parsed filter and sort of a request
+type Query struct {
+	// Filter is nil when the request has no filter
+	Filter Expr
+	Sort   []SortField
+}
+
+// Parse parses the filter and the sort, an empty filter is no filter and
+// an empty sort uses the DefaultSort
+func (s *Schema) Parse(filter, sort string) (*Query, error) {
+	expr, err := s.ParseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(sort) == "" {
+		sort = s.DefaultSort
+	}
+
+	sortFields, err := s.ParseSort(sort)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Query{
+		Filter: expr,
+		Sort:   sortFields,
+	}, nil
+}
+
+// ParseFilter parses the filter expression, returns nil when the filter is
+// empty
+func (s *Schema) ParseFilter(filter string) (Expr, error) {
+	if strings.TrimSpace(filter) == "" {
+		return nil, nil
+	}
+
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser{
+		schema: s,
+		tokens: tokens,
+	}
+
+	return p.parse()
+}
+
+// ParseSort parses a comma separated list of fields, a field prefixed with
+// "-" is sorted in descending order and "+" or no prefix in ascending order
+func (s *Schema) ParseSort(sort string) ([]SortField, error) {
+	if strings.TrimSpace(sort) == "" {
+		return nil, nil
+	}
+
+	var res []SortField
+
+	pos := 0
+	for _, part := range strings.Split(sort, ",") {
+		start := pos + len(part) - len(strings.TrimLeft(part, " "))
+		pos += len(part) + 1
+
+		name := strings.TrimSpace(part)
+		if name == "" {
+			return nil, sortError(start, "expected a field")
+		}
+
+		desc := false
+		switch name[0] {
+		case '-':
+			desc = true
+			name = name[1:]
+		case '+':
+			name = name[1:]
+		}
+
+		field := s.field(name)
+		if field == nil {
+			return nil, sortError(start, fmt.Sprintf("unknown field %q", name))
+		}
+
+		if !field.Sort {
+			return nil, sortError(start, fmt.Sprintf("field %q can't be sorted", name))
+		}
+
+		for _, existing := range res {
+			if existing.Field.Name == name {
+				return nil, sortError(start, fmt.Sprintf("field %q is sorted multiple times", name))
+			}
+		}
+
+		res = append(res, SortField{
+			Field: *field,
+			Desc:  desc,
+		})
+	}
+
+	return res, nil
+}
+
+// Error is returned when a expression is invalid
+type Error struct {
+	// Param is "filter" or "sort"
+	Param string
+	// Pos is the position of the error in the expression, starts at 1
+	Pos     int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s at position %d", e.Param, e.Message, e.Pos)
+}
+
+func filterError(offset int, message string) *Error {
+	return &Error{
+		Param:   "filter",
+		Pos:     offset + 1,
+		Message: message,
+	}
+}
+
+func sortError(offset int, message string) *Error {
+	return &Error{
+		Param:   "sort",
+		Pos:     offset + 1,
+		Message: message,
+	}
+}
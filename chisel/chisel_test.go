@@ -0,0 +1,262 @@
+package chisel_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nanoteck137/pyrin/chisel"
+)
+
+func testSchema() *chisel.Schema {
+	return &chisel.Schema{
+		Fields: []chisel.Field{
+			{Name: "name", Type: chisel.TypeString, Filter: true, Sort: true},
+			{Name: "age", Type: chisel.TypeInt, Filter: true, Sort: true},
+			{Name: "score", Type: chisel.TypeFloat, Filter: true},
+			{Name: "active", Type: chisel.TypeBool, Filter: true},
+			{Name: "createdAt", Type: chisel.TypeDate, Column: "created_at", Filter: true, Sort: true},
+			{Name: "deletedAt", Type: chisel.TypeDate, Column: "deleted_at", Filter: true, Nullable: true},
+			{Name: "secret", Type: chisel.TypeString},
+		},
+		DefaultSort: "-createdAt",
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		sql    string
+		args   []any
+	}{
+		{"empty", "  ", "", nil},
+		{"string", `name == "bob"`, "name = ?", []any{"bob"}},
+		{"single quotes", `name != 'bob'`, "name <> ?", []any{"bob"}},
+		{"string escapes", `name == "a\"b\\c\n"`, "name = ?", []any{"a\"b\\c\n"}},
+		{"int", "age >= 18", "age >= ?", []any{int64(18)}},
+		{"negative int", "age > -5", "age > ?", []any{int64(-5)}},
+		{"float", "score < 1.5e2", "score < ?", []any{150.0}},
+		{"bool", "active == true", "active = ?", []any{true}},
+		{"column", `createdAt < "2024-01-02"`, "created_at < ?", []any{time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}},
+		{"rfc3339", `createdAt >= "2024-01-02T03:04:05Z"`, "created_at >= ?", []any{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}},
+		{"null", "deletedAt == null", "deleted_at IS NULL", nil},
+		{"not null", "deletedAt != null", "deleted_at IS NOT NULL", nil},
+		{"contains", `name ~ "bo"`, "name LIKE ? ESCAPE '!'", []any{"%bo%"}},
+		{"not contains", `name !~ "bo"`, "name NOT LIKE ? ESCAPE '!'", []any{"%bo%"}},
+		{
+			"and binds tighter than or",
+			`name == "a" || age > 1 && active == false`,
+			"(name = ? OR (age > ? AND active = ?))",
+			[]any{"a", int64(1), false},
+		},
+		{
+			"parens",
+			`(name == "a" || age > 1) && active == false`,
+			"((name = ? OR age > ?) AND active = ?)",
+			[]any{"a", int64(1), false},
+		},
+		{
+			"not",
+			`!(name == "a" && !active == true)`,
+			"NOT ((name = ? AND NOT (active = ?)))",
+			[]any{"a", true},
+		},
+	}
+
+	schema := testSchema()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expr, err := schema.ParseFilter(test.filter)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			sql, args := chisel.SQL{}.Where(expr, nil)
+			if sql != test.sql {
+				t.Errorf("sql = %q, expected %q", sql, test.sql)
+			}
+
+			if !reflect.DeepEqual(args, test.args) {
+				t.Errorf("args = %#v, expected %#v", args, test.args)
+			}
+		})
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		pos     int
+		message string
+	}{
+		{"unknown field", `title == "a"`, 1, `unknown field "title"`},
+		{"not filterable", `secret == "a"`, 1, `field "secret" can't be filtered`},
+		{"operator not allowed", "active > true", 8, `operator ">" can't be used on field "active"`},
+		{"contains on int", "age ~ 1", 5, `operator "~" can't be used on field "age"`},
+		{"missing operator", "age 1", 5, `expected a operator got "1"`},
+		{"lone equals", "age = 1", 5, `unexpected "="`},
+		{"missing value", "age ==", 7, "expected a value got end of filter"},
+		{"wrong value type", `age == "1"`, 8, `invalid value string "1" for int field "age"`},
+		{"invalid int", "age == 1.5", 8, `invalid value "1.5" for int field "age"`},
+		{"invalid date", `createdAt == "yesterday"`, 14, `invalid date "yesterday"`},
+		{"null not nullable", "age == null", 8, `field "age" can't be null`},
+		{"null with ordering", "deletedAt < null", 13, `null can only be compared with "==" and "!="`},
+		{"unterminated string", `name == "a`, 9, "unterminated string"},
+		{"invalid escape", `name == "\x"`, 9, `invalid escape "\x"`},
+		{"unexpected character", "age == 1 & age == 2", 10, `unexpected "&"`},
+		{"unclosed paren", "(age == 1", 10, `expected ")" got end of filter`},
+		{"trailing token", "age == 1)", 9, `unexpected ")"`},
+		{"missing field", "&& age == 1", 1, `expected a field got "&&"`},
+	}
+
+	schema := testSchema()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := schema.ParseFilter(test.filter)
+
+			var cerr *chisel.Error
+			if !errors.As(err, &cerr) {
+				t.Fatalf("expected a *chisel.Error, got %v", err)
+			}
+
+			if cerr.Param != "filter" || cerr.Pos != test.pos || cerr.Message != test.message {
+				t.Errorf("error = %s %d %q, expected filter %d %q", cerr.Param, cerr.Pos, cerr.Message, test.pos, test.message)
+			}
+		})
+	}
+}
+
+func TestParseFilterDepth(t *testing.T) {
+	filter := ""
+	for i := 0; i < 40; i++ {
+		filter += "!"
+	}
+	filter += "active == true"
+
+	_, err := testSchema().ParseFilter(filter)
+
+	var cerr *chisel.Error
+	if !errors.As(err, &cerr) || cerr.Message != "filter is nested too deep" {
+		t.Fatalf("expected the filter to be too deep, got %v", err)
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		name    string
+		sort    string
+		orderBy string
+	}{
+		{"default", "", "created_at DESC"},
+		{"ascending", "name", "name ASC"},
+		{"plus", "+age", "age ASC"},
+		{"descending", "-age", "age DESC"},
+		{"multiple", " -createdAt, name ", "created_at DESC, name ASC"},
+	}
+
+	schema := testSchema()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, err := schema.Parse("", test.sort)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if orderBy := (chisel.SQL{}).OrderBy(query.Sort); orderBy != test.orderBy {
+				t.Errorf("order by = %q, expected %q", orderBy, test.orderBy)
+			}
+		})
+	}
+}
+
+func TestParseSortErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		sort    string
+		pos     int
+		message string
+	}{
+		{"empty item", "name,,age", 6, "expected a field"},
+		{"trailing comma", "name,", 6, "expected a field"},
+		{"unknown field", "name, title", 7, `unknown field "title"`},
+		{"not sortable", "-score", 1, `field "score" can't be sorted`},
+		{"duplicate", "name,-name", 6, `field "name" is sorted multiple times`},
+	}
+
+	schema := testSchema()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := schema.ParseSort(test.sort)
+
+			var cerr *chisel.Error
+			if !errors.As(err, &cerr) {
+				t.Fatalf("expected a *chisel.Error, got %v", err)
+			}
+
+			if cerr.Param != "sort" || cerr.Pos != test.pos || cerr.Message != test.message {
+				t.Errorf("error = %s %d %q, expected sort %d %q", cerr.Param, cerr.Pos, cerr.Message, test.pos, test.message)
+			}
+		})
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema chisel.Schema
+		err    string
+	}{
+		{"valid", *testSchema(), ""},
+		{
+			"no name",
+			chisel.Schema{Fields: []chisel.Field{{Type: chisel.TypeInt}}},
+			"field without a name",
+		},
+		{
+			"duplicate",
+			chisel.Schema{Fields: []chisel.Field{
+				{Name: "a", Type: chisel.TypeInt},
+				{Name: "a", Type: chisel.TypeString},
+			}},
+			`field "a" is declared multiple times`,
+		},
+		{
+			"unknown type",
+			chisel.Schema{Fields: []chisel.Field{{Name: "a", Type: "uuid"}}},
+			`field "a" has unknown type "uuid"`,
+		},
+		{
+			"invalid default sort",
+			chisel.Schema{
+				Fields:      []chisel.Field{{Name: "a", Type: chisel.TypeInt}},
+				DefaultSort: "-a",
+			},
+			`invalid DefaultSort: sort: field "a" can't be sorted at position 1`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.schema.Validate()
+
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if err == nil || err.Error() != test.err {
+				t.Errorf("error = %v, expected %q", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package chisel
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind tokenKind
+	// text is the unquoted value for strings
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of filter"
+	case tokenString:
+		return fmt.Sprintf("string %q", t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdent(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '.'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// tokenize splits the filter into tokens, the last token is always a
+// tokenEOF
+func tokenize(src string) ([]token, error) {
+	var res []token
+
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		start := i
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '(':
+			res = append(res, token{kind: tokenLParen, text: "(", pos: start})
+			i++
+		case c == ')':
+			res = append(res, token{kind: tokenRParen, text: ")", pos: start})
+			i++
+		case strings.HasPrefix(src[i:], "&&"):
+			res = append(res, token{kind: tokenAnd, text: "&&", pos: start})
+			i += 2
+		case strings.HasPrefix(src[i:], "||"):
+			res = append(res, token{kind: tokenOr, text: "||", pos: start})
+			i += 2
+		case c == '=' || c == '!' || c == '<' || c == '>' || c == '~':
+			op := lexOperator(src[i:])
+			if op == "" {
+				return nil, filterError(start, fmt.Sprintf("unexpected %q", src[i:i+1]))
+			}
+
+			if op == "!" {
+				res = append(res, token{kind: tokenNot, text: op, pos: start})
+			} else {
+				res = append(res, token{kind: tokenOperator, text: op, pos: start})
+			}
+
+			i += len(op)
+		case c == '"' || c == '\'':
+			s, n, err := lexString(src[i:])
+			if err != nil {
+				return nil, filterError(start, err.Error())
+			}
+
+			res = append(res, token{kind: tokenString, text: s, pos: start})
+			i += n
+		case isDigit(c) || c == '-' || c == '.':
+			i++
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.' || src[i] == 'e' || src[i] == 'E' ||
+				((src[i] == '-' || src[i] == '+') && (src[i-1] == 'e' || src[i-1] == 'E'))) {
+				i++
+			}
+
+			res = append(res, token{kind: tokenNumber, text: src[start:i], pos: start})
+		case isIdentStart(c):
+			for i < len(src) && isIdent(src[i]) {
+				i++
+			}
+
+			res = append(res, token{kind: tokenIdent, text: src[start:i], pos: start})
+		default:
+			r, _ := utf8.DecodeRuneInString(src[i:])
+			return nil, filterError(start, fmt.Sprintf("unexpected %q", string(r)))
+		}
+	}
+
+	res = append(res, token{kind: tokenEOF, pos: len(src)})
+
+	return res, nil
+}
+
+// lexOperator returns the operator at the start of s, "!" is returned for
+// the not operator and an empty string for a lone "="
+func lexOperator(s string) string {
+	// NOTE(patrik): The two character operators needs to be checked first
+	for _, op := range []Operator{OpEq, OpNe, OpLe, OpGe, OpNotContains} {
+		if strings.HasPrefix(s, string(op)) {
+			return string(op)
+		}
+	}
+
+	switch s[0] {
+	case '<', '>', '~', '!':
+		return s[:1]
+	}
+
+	return ""
+}
+
+// lexString reads the quoted string at the start of s, returns the unquoted
+// string and the number of bytes read
+func lexString(s string) (string, int, error) {
+	quote := s[0]
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+
+		switch c {
+		case quote:
+			return b.String(), i + 1, nil
+		case '\\':
+			i++
+			if i >= len(s) {
+				return "", 0, fmt.Errorf("unterminated string")
+			}
+
+			switch s[i] {
+			case '\\', '"', '\'':
+				b.WriteByte(s[i])
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				return "", 0, fmt.Errorf("invalid escape \"\\%c\"", s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return "", 0, fmt.Errorf("unterminated string")
+}
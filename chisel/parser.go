@@ -0,0 +1,224 @@
+package chisel
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// maxDepth is the deepest nesting of parentheses and not operators allowed
+// in a filter
+const maxDepth = 32
+
+type parser struct {
+	schema *Schema
+	tokens []token
+	pos    int
+	depth  int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *parser) parse() (Expr, error) {
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, filterError(t.pos, fmt.Sprintf("unexpected %s", t))
+	}
+
+	return expr, nil
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenOr {
+		p.advance()
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &OrExpr{Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenAnd {
+		p.advance()
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &AndExpr{Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	t := p.peek()
+
+	switch t.kind {
+	case tokenNot, tokenLParen:
+		p.depth++
+		defer func() { p.depth-- }()
+
+		if p.depth > maxDepth {
+			return nil, filterError(t.pos, "filter is nested too deep")
+		}
+	}
+
+	switch t.kind {
+	case tokenNot:
+		p.advance()
+
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return &NotExpr{Expr: expr}, nil
+	case tokenLParen:
+		p.advance()
+
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if t := p.advance(); t.kind != tokenRParen {
+			return nil, filterError(t.pos, fmt.Sprintf("expected \")\" got %s", t))
+		}
+
+		return expr, nil
+	}
+
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (Expr, error) {
+	t := p.advance()
+	if t.kind != tokenIdent {
+		return nil, filterError(t.pos, fmt.Sprintf("expected a field got %s", t))
+	}
+
+	field := p.schema.field(t.text)
+	if field == nil {
+		return nil, filterError(t.pos, fmt.Sprintf("unknown field %q", t.text))
+	}
+
+	if !field.Filter {
+		return nil, filterError(t.pos, fmt.Sprintf("field %q can't be filtered", t.text))
+	}
+
+	opToken := p.advance()
+	if opToken.kind != tokenOperator {
+		return nil, filterError(opToken.pos, fmt.Sprintf("expected a operator got %s", opToken))
+	}
+
+	op := Operator(opToken.text)
+	if !slices.Contains(Operators(field.Type), op) {
+		return nil, filterError(opToken.pos, fmt.Sprintf("operator %q can't be used on field %q", op, field.Name))
+	}
+
+	valueToken := p.advance()
+	value, err := parseValue(field, op, valueToken)
+	if err != nil {
+		return nil, filterError(valueToken.pos, err.Error())
+	}
+
+	return &CompareExpr{
+		Field: *field,
+		Op:    op,
+		Value: value,
+	}, nil
+}
+
+// parseValue converts the literal to the type of the field
+func parseValue(field *Field, op Operator, t token) (any, error) {
+	if t.kind == tokenEOF {
+		return nil, fmt.Errorf("expected a value got %s", t)
+	}
+
+	if t.kind == tokenIdent && t.text == "null" {
+		if !field.Nullable {
+			return nil, fmt.Errorf("field %q can't be null", field.Name)
+		}
+
+		if op != OpEq && op != OpNe {
+			return nil, fmt.Errorf("null can only be compared with \"==\" and \"!=\"")
+		}
+
+		return nil, nil
+	}
+
+	switch field.Type {
+	case TypeString:
+		if t.kind == tokenString {
+			return t.text, nil
+		}
+	case TypeInt:
+		if t.kind == tokenNumber {
+			v, err := strconv.ParseInt(t.text, 10, 64)
+			if err == nil {
+				return v, nil
+			}
+		}
+	case TypeFloat:
+		if t.kind == tokenNumber {
+			v, err := strconv.ParseFloat(t.text, 64)
+			if err == nil {
+				return v, nil
+			}
+		}
+	case TypeBool:
+		if t.kind == tokenIdent && (t.text == "true" || t.text == "false") {
+			return t.text == "true", nil
+		}
+	case TypeDate:
+		if t.kind == tokenString {
+			if v, err := time.Parse(time.RFC3339, t.text); err == nil {
+				return v, nil
+			}
+
+			if v, err := time.Parse(time.DateOnly, t.text); err == nil {
+				return v, nil
+			}
+
+			return nil, fmt.Errorf("invalid date %q", t.text)
+		}
+	default:
+		return nil, fmt.Errorf("field %q has unknown type %q", field.Name, field.Type)
+	}
+
+	return nil, fmt.Errorf("invalid value %s for %s field %q", t, field.Type, field.Name)
+}
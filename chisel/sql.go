@@ -0,0 +1,136 @@
+package chisel
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Placeholder returns the placeholder of the nth bound parameter, n starts
+// at 1
+type Placeholder func(n int) string
+
+// QuestionPlaceholder is used by SQLite and MySQL
+func QuestionPlaceholder(n int) string {
+	return "?"
+}
+
+// DollarPlaceholder is used by PostgreSQL
+func DollarPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// SQL translates a Query to SQL, the values is always bound as parameters
+// and the columns comes from the Schema
+type SQL struct {
+	// Placeholder defaults to QuestionPlaceholder
+	Placeholder Placeholder
+}
+
+func (s SQL) placeholder(n int) string {
+	if s.Placeholder == nil {
+		return QuestionPlaceholder(n)
+	}
+
+	return s.Placeholder(n)
+}
+
+// Where translates the filter to a condition for the WHERE clause, the
+// values is appended to args and the placeholders is numbered after the
+// existing args. Returns an empty string when expr is nil
+func (s SQL) Where(expr Expr, args []any) (string, []any) {
+	if expr == nil {
+		return "", args
+	}
+
+	var b strings.Builder
+	args = s.writeExpr(&b, expr, args)
+
+	return b.String(), args
+}
+
+func (s SQL) writeExpr(b *strings.Builder, expr Expr, args []any) []any {
+	switch e := expr.(type) {
+	case *AndExpr:
+		b.WriteString("(")
+		args = s.writeExpr(b, e.Left, args)
+		b.WriteString(" AND ")
+		args = s.writeExpr(b, e.Right, args)
+		b.WriteString(")")
+	case *OrExpr:
+		b.WriteString("(")
+		args = s.writeExpr(b, e.Left, args)
+		b.WriteString(" OR ")
+		args = s.writeExpr(b, e.Right, args)
+		b.WriteString(")")
+	case *NotExpr:
+		b.WriteString("NOT (")
+		args = s.writeExpr(b, e.Expr, args)
+		b.WriteString(")")
+	case *CompareExpr:
+		b.WriteString(e.Field.ColumnName())
+
+		if e.Value == nil {
+			if e.Op == OpEq {
+				b.WriteString(" IS NULL")
+			} else {
+				b.WriteString(" IS NOT NULL")
+			}
+
+			return args
+		}
+
+		value := e.Value
+
+		switch e.Op {
+		case OpContains, OpNotContains:
+			if e.Op == OpContains {
+				b.WriteString(" LIKE ")
+			} else {
+				b.WriteString(" NOT LIKE ")
+			}
+
+			// NOTE(patrik): The value is escaped so "%" and "_" in the
+			// value is matched as is, "!" is used as the escape character
+			// because MySQL treats "\" as a escape inside the literal
+			value = "%" + escapeLike(value.(string)) + "%"
+			args = append(args, value)
+			b.WriteString(s.placeholder(len(args)))
+			b.WriteString(" ESCAPE '!'")
+
+			return args
+		case OpEq:
+			b.WriteString(" = ")
+		case OpNe:
+			b.WriteString(" <> ")
+		default:
+			b.WriteString(" " + string(e.Op) + " ")
+		}
+
+		args = append(args, value)
+		b.WriteString(s.placeholder(len(args)))
+	}
+
+	return args
+}
+
+// OrderBy translates the sort to the columns of the ORDER BY clause, e.g.
+// "created_at DESC, name ASC". Returns an empty string when there is no
+// sort
+func (s SQL) OrderBy(sort []SortField) string {
+	var parts []string
+	for _, f := range sort {
+		dir := "ASC"
+		if f.Desc {
+			dir = "DESC"
+		}
+
+		parts = append(parts, f.Field.ColumnName()+" "+dir)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func escapeLike(s string) string {
+	r := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+	return r.Replace(s)
+}
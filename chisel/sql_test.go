@@ -0,0 +1,113 @@
+package chisel_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nanoteck137/pyrin/chisel"
+)
+
+func TestSQLWhere(t *testing.T) {
+	tests := []struct {
+		name   string
+		sql    chisel.SQL
+		filter string
+		args   []any
+		where  string
+		res    []any
+	}{
+		{
+			"question",
+			chisel.SQL{},
+			`name == "a" && age > 1`,
+			nil,
+			"(name = ? AND age > ?)",
+			[]any{"a", int64(1)},
+		},
+		{
+			"dollar",
+			chisel.SQL{Placeholder: chisel.DollarPlaceholder},
+			`name == "a" || (age > 1 && name ~ "b")`,
+			nil,
+			"(name = $1 OR (age > $2 AND name LIKE $3 ESCAPE '!'))",
+			[]any{"a", int64(1), "%b%"},
+		},
+		{
+			"dollar after existing args",
+			chisel.SQL{Placeholder: chisel.DollarPlaceholder},
+			`name == "a" && deletedAt == null && age != 2`,
+			[]any{"tenant"},
+			"((name = $2 AND deleted_at IS NULL) AND age <> $3)",
+			[]any{"tenant", "a", int64(2)},
+		},
+		{
+			"no filter",
+			chisel.SQL{Placeholder: chisel.DollarPlaceholder},
+			"",
+			[]any{"tenant"},
+			"",
+			[]any{"tenant"},
+		},
+	}
+
+	schema := testSchema()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expr, err := schema.ParseFilter(test.filter)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			where, args := test.sql.Where(expr, test.args)
+			if where != test.where {
+				t.Errorf("where = %q, expected %q", where, test.where)
+			}
+
+			if !reflect.DeepEqual(args, test.res) {
+				t.Errorf("args = %#v, expected %#v", args, test.res)
+			}
+		})
+	}
+}
+
+func TestSQLLikeEscape(t *testing.T) {
+	tests := []struct {
+		value string
+		arg   string
+	}{
+		{"plain", "%plain%"},
+		{"100%", "%100!%%"},
+		{"a_b", "%a!_b%"},
+		{"wow!", "%wow!!%"},
+		{`back\slash`, `%back\slash%`},
+	}
+
+	schema := testSchema()
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			expr, err := schema.ParseFilter(`name ~ "` + escapeString(test.value) + `"`)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			_, args := chisel.SQL{}.Where(expr, nil)
+			if len(args) != 1 || args[0] != test.arg {
+				t.Errorf("args = %#v, expected %q", args, test.arg)
+			}
+		})
+	}
+}
+
+func escapeString(s string) string {
+	res := ""
+	for _, c := range s {
+		if c == '\\' || c == '"' {
+			res += `\`
+		}
+		res += string(c)
+	}
+
+	return res
+}
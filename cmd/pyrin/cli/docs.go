@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/nanoteck137/pyrin/spark"
+	"github.com/spf13/cobra"
+)
+
+var docsCmd = &cobra.Command{
+	Use:   "docs <SERVER_DEF_FILE> [PACKAGES...]",
+	Short: "Attach Go doc comments to a server def",
+	Long: "Load the Go packages (default .) and attach the doc comments " +
+		"of structures, fields and handlers to the server def, the " +
+		"generators emit them as TSDoc, GoDoc and DartDoc",
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		input := args[0]
+		patterns := args[1:]
+		if len(patterns) == 0 {
+			patterns = []string{"."}
+		}
+
+		dir, _ := cmd.Flags().GetString("dir")
+		output, _ := cmd.Flags().GetString("output")
+		if output == "" {
+			output = input
+		}
+
+		d, err := os.ReadFile(input)
+		if err != nil {
+			log.Fatalf("failed to read file: %v", err)
+		}
+
+		var serverDef spark.ServerDef
+		err = json.Unmarshal(d, &serverDef)
+		if err != nil {
+			log.Fatalf("failed to unmarshal server def: %v", err)
+		}
+
+		err = spark.AttachDocs(&serverDef, dir, patterns...)
+		if err != nil {
+			log.Fatalf("failed to attach docs: %v", err)
+		}
+
+		err = serverDef.SaveToFile(output)
+		if err != nil {
+			log.Fatalf("failed to save server def: %v", err)
+		}
+
+		fmt.Printf("Wrote docs to %s\n", output)
+	},
+}
+
+func init() {
+	docsCmd.Flags().StringP("dir", "d", ".", "Directory to load the packages from")
+	docsCmd.Flags().StringP("output", "o", "", "Output file (default is to overwrite the input)")
+
+	rootCmd.AddCommand(docsCmd)
+}
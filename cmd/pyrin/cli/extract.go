@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/nanoteck137/pyrin/spark"
+	"github.com/spf13/cobra"
+)
+
+var extractCmd = &cobra.Command{
+	Use:   "extract [PACKAGES...]",
+	Short: "Extract the server def from source",
+	Long: "Find the function that registers the handlers, a function with " +
+		"the signature func(pyrin.Router), and create the server def from " +
+		"it without a separate main package",
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, _ := cmd.Flags().GetString("dir")
+		output, _ := cmd.Flags().GetString("output")
+		funcName, _ := cmd.Flags().GetString("func")
+		defaultNameFilter, _ := cmd.Flags().GetBool("default-name-filter")
+		docs, _ := cmd.Flags().GetBool("docs")
+		envelope, _ := cmd.Flags().GetString("envelope")
+
+		serverDef, err := spark.ExtractServerDef(spark.ExtractConfig{
+			Dir:                   dir,
+			Patterns:              args,
+			FuncName:              funcName,
+			LoadDefaultNameFilter: defaultNameFilter,
+			Envelope:              envelope,
+		})
+		if err != nil {
+			log.Fatalf("failed to extract server def: %v", err)
+		}
+
+		if docs {
+			patterns := args
+			if len(patterns) == 0 {
+				patterns = []string{"."}
+			}
+
+			err = spark.AttachDocs(serverDef, dir, patterns...)
+			if err != nil {
+				log.Fatalf("failed to attach docs: %v", err)
+			}
+		}
+
+		err = serverDef.SaveToFile(output)
+		if err != nil {
+			log.Fatalf("failed to save server def: %v", err)
+		}
+
+		fmt.Printf("Wrote server def to %s\n", output)
+	},
+}
+
+func init() {
+	extractCmd.Flags().StringP("dir", "d", ".", "Directory to load the packages from")
+	extractCmd.Flags().StringP("output", "o", "./pyrin.json", "Output file")
+	extractCmd.Flags().StringP("func", "f", "", "Name of the register function")
+	extractCmd.Flags().Bool("default-name-filter", false, "Ban the default set of field names")
+	extractCmd.Flags().Bool("docs", false, "Attach the Go doc comments")
+	extractCmd.Flags().String("envelope", "", "Envelope of the server (default, problem)")
+
+	rootCmd.AddCommand(extractCmd)
+}
@@ -206,22 +206,6 @@ func loggerMiddleware(logName string) func(next http.Handler) http.Handler {
 	}
 }
 
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, PATCH")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
-		w.Header().Set("Access-Control-Max-Age", "86400")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
 func main() {
 	if true {
 		router := spark.Router{}
@@ -299,9 +283,12 @@ func main() {
 		RegisterHandlers: registerRoutes,
 		Middlewares: []pyrin.MiddlewareFunc{
 			loggerMiddleware("Test"),
-			corsMiddleware,
 			middleware.Recoverer,
 		},
+		Cors: &pyrin.CorsConfig{
+			AllowedOrigins: []string{"*"},
+			MaxAge:         24 * time.Hour,
+		},
 	})
 
 	registerRoutes(server)
@@ -0,0 +1,254 @@
+package pyrin
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	msgpackMimeType = "application/msgpack"
+	cborMimeType    = "application/cbor"
+)
+
+// Codec encodes the request and response bodies of the ApiHandlers, the
+// server picks the codec from the Accept and Content-Type headers. The
+// codecs uses the json struct tags so the envelope and the types looks the
+// same in every encoding
+type Codec interface {
+	// ContentType is the media type of the encoding, e.g. "application/json"
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	_ Codec = JSONCodec{}
+	_ Codec = MsgPackCodec{}
+	_ Codec = CBORCodec{}
+)
+
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string {
+	return jsonMimeType
+}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE(patrik): Same output as json.Encoder
+	return append(body, '\n'), nil
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+type MsgPackCodec struct{}
+
+func (MsgPackCodec) ContentType() string {
+	return msgpackMimeType
+}
+
+func (MsgPackCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	enc.UseCompactFloats(true)
+
+	err := enc.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (MsgPackCodec) Unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	dec.SetMapDecoder(func(d *msgpack.Decoder) (any, error) {
+		return d.DecodeUntypedMap()
+	})
+
+	return dec.Decode(v)
+}
+
+// NOTE(patrik): Decode the maps inside any values as map[string]any, same
+// as encoding/json
+var cborDecMode, _ = cbor.DecOptions{
+	DefaultMapType: reflect.TypeOf(map[string]any(nil)),
+}.DecMode()
+
+type CBORCodec struct{}
+
+func (CBORCodec) ContentType() string {
+	return cborMimeType
+}
+
+func (CBORCodec) Marshal(v any) ([]byte, error) {
+	return cbor.Marshal(v)
+}
+
+func (CBORCodec) Unmarshal(data []byte, v any) error {
+	return cborDecMode.Unmarshal(data, v)
+}
+
+var defaultCodecs = []Codec{JSONCodec{}}
+
+// createCodecs returns the codecs of the server, JSON is always available
+// and is the default
+func createCodecs(codecs []Codec) []Codec {
+	res := []Codec{JSONCodec{}}
+
+	for _, codec := range codecs {
+		exists := false
+		for _, c := range res {
+			if c.ContentType() == codec.ContentType() {
+				exists = true
+				break
+			}
+		}
+
+		if !exists {
+			res = append(res, codec)
+		}
+	}
+
+	return res
+}
+
+func requestCodecs(r *http.Request) []Codec {
+	if store := getRequestStore(r); store != nil && len(store.codecs) > 0 {
+		return store.codecs
+	}
+
+	return defaultCodecs
+}
+
+// findCodec returns the codec for the Content-Type of the request body
+func findCodec(r *http.Request) (Codec, bool) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, false
+	}
+
+	for _, codec := range requestCodecs(r) {
+		if codec.ContentType() == mediaType {
+			return codec, true
+		}
+	}
+
+	return nil, false
+}
+
+// negotiateCodec returns the codec with the highest q value in the Accept
+// header, ties are broken by the order of the codecs. Defaults to JSON when
+// the header is missing or no codec is accepted
+func negotiateCodec(r *http.Request) Codec {
+	codecs := requestCodecs(r)
+
+	accept := r.Header.Get("Accept")
+	if accept == "" || len(codecs) == 1 {
+		return codecs[0]
+	}
+
+	best := codecs[0]
+	bestQ := 0.0
+	bestSpecific := -1
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, exists := params["q"]; exists {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+
+		if q <= 0 {
+			continue
+		}
+
+		for _, codec := range codecs {
+			specific := matchMediaRange(mediaType, codec.ContentType())
+			if specific < 0 {
+				continue
+			}
+
+			if q > bestQ || (q == bestQ && specific > bestSpecific) {
+				best = codec
+				bestQ = q
+				bestSpecific = specific
+			}
+
+			// NOTE(patrik): Wildcards only matches the first codec so the
+			// default is used for "*/*"
+			break
+		}
+	}
+
+	return best
+}
+
+// matchMediaRange returns how specific the range matched the media type, -1
+// when it didn't match
+func matchMediaRange(mediaRange, mediaType string) int {
+	switch {
+	case mediaRange == mediaType:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+		return 1
+	}
+
+	return -1
+}
+
+func contentTypeHeader(codec Codec) string {
+	if codec.ContentType() == jsonMimeType {
+		return "application/json; charset=utf-8"
+	}
+
+	return codec.ContentType()
+}
+
+// marshalResponse encodes the data with the codec the client accepts
+func marshalResponse(r *http.Request, data any) ([]byte, string, error) {
+	codec := negotiateCodec(r)
+
+	body, err := codec.Marshal(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return body, contentTypeHeader(codec), nil
+}
+
+func writeBody(w http.ResponseWriter, r *http.Request, code int, contentType string, body []byte) {
+	if len(requestCodecs(r)) > 1 {
+		addVary(w.Header(), "Accept")
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	w.Write(body)
+}
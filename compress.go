@@ -0,0 +1,395 @@
+package pyrin
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+	EncodingZstd    = "zstd"
+	EncodingBrotli  = "br"
+)
+
+const defaultCompressMinSize = 1024
+
+// CompressionConfig enables compression of the responses, the encoding is
+// picked from the Accept-Encoding header of the request
+type CompressionConfig struct {
+	// Encodings is the encodings the server can use in the order of
+	// preference, defaults to gzip and deflate. EncodingZstd can be added
+	Encodings []string
+	// MinSize is the smallest response in bytes that is compressed,
+	// defaults to 1024
+	MinSize int
+	// ContentTypes is the media types that are compressed, a type ending
+	// with "/" matches all the subtypes, defaults to json, text and the
+	// common web asset types
+	ContentTypes []string
+}
+
+var defaultCompressEncodings = []string{EncodingGzip, EncodingDeflate}
+
+var defaultCompressContentTypes = []string{
+	"text/",
+	"application/json",
+	"application/problem+json",
+	"application/msgpack",
+	"application/cbor",
+	"application/javascript",
+	"application/xml",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+type compressEncoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// NOTE(patrik): The encoders allocates large buffers, zstd also starts
+// goroutines, so they are reused between the responses
+var compressEncoderPools = map[string]*sync.Pool{
+	EncodingGzip: {
+		New: func() any {
+			return gzip.NewWriter(nil)
+		},
+	},
+	EncodingDeflate: {
+		New: func() any {
+			// NOTE(patrik): "deflate" in HTTP is the zlib format
+			return zlib.NewWriter(nil)
+		},
+	},
+	EncodingZstd: {
+		New: func() any {
+			encoder, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+			if err != nil {
+				panic(err)
+			}
+
+			return encoder
+		},
+	},
+}
+
+// newCompressEncoder returns a encoder from the pool writing to w, returns
+// nil when the encoding is unknown
+func newCompressEncoder(encoding string, w io.Writer) compressEncoder {
+	pool, exists := compressEncoderPools[encoding]
+	if !exists {
+		return nil
+	}
+
+	encoder := pool.Get().(compressEncoder)
+	encoder.Reset(w)
+
+	return encoder
+}
+
+// releaseCompressEncoder puts the encoder back into the pool, the encoder
+// needs to be closed first
+func releaseCompressEncoder(encoding string, encoder compressEncoder) {
+	encoder.Reset(nil)
+	compressEncoderPools[encoding].Put(encoder)
+}
+
+// parseAcceptEncoding returns the q value of every encoding in the header
+func parseAcceptEncoding(header string) map[string]float64 {
+	res := make(map[string]float64)
+
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		if v, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+
+		res[name] = q
+	}
+
+	return res
+}
+
+// negotiateEncoding returns the encoding with the highest q value, ties are
+// broken by the order of available
+func negotiateEncoding(header string, available []string) string {
+	if header == "" {
+		return ""
+	}
+
+	accepted := parseAcceptEncoding(header)
+
+	best := ""
+	bestQ := 0.0
+	for _, encoding := range available {
+		q, exists := accepted[encoding]
+		if !exists {
+			q, exists = accepted["*"]
+		}
+
+		if exists && q > bestQ {
+			best = encoding
+			bestQ = q
+		}
+	}
+
+	return best
+}
+
+func (c *CompressionConfig) encodings() []string {
+	if len(c.Encodings) > 0 {
+		return c.Encodings
+	}
+
+	return defaultCompressEncodings
+}
+
+func (c *CompressionConfig) minSize() int {
+	if c.MinSize > 0 {
+		return c.MinSize
+	}
+
+	return defaultCompressMinSize
+}
+
+func (c *CompressionConfig) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	types := c.ContentTypes
+	if len(types) == 0 {
+		types = defaultCompressContentTypes
+	}
+
+	for _, t := range types {
+		if strings.HasSuffix(t, "/") {
+			if strings.HasPrefix(mediaType, t) {
+				return true
+			}
+		} else if mediaType == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compressResponseWriter holds back the response until MinSize bytes are
+// written, then the response is either compressed or written as is
+type compressResponseWriter struct {
+	http.ResponseWriter
+
+	config   *CompressionConfig
+	encoding string
+
+	status  int
+	buf     []byte
+	decided bool
+	encoder compressEncoder
+}
+
+func (w *compressResponseWriter) WriteHeader(status int) {
+	if w.decided || w.status != 0 {
+		return
+	}
+
+	w.status = status
+}
+
+func (w *compressResponseWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < w.config.minSize() {
+			return len(p), nil
+		}
+
+		err := w.decide(true)
+		if err != nil {
+			return 0, err
+		}
+
+		return len(p), nil
+	}
+
+	if w.encoder != nil {
+		return w.encoder.Write(p)
+	}
+
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *compressResponseWriter) shouldCompress() bool {
+	header := w.Header()
+
+	switch {
+	case w.status < 200,
+		w.status == http.StatusNoContent,
+		w.status == http.StatusNotModified,
+		header.Get("Content-Encoding") != "",
+		header.Get("Content-Range") != "":
+		return false
+	}
+
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(w.buf)
+	}
+
+	return w.config.compressible(contentType)
+}
+
+func (w *compressResponseWriter) decide(large bool) error {
+	w.decided = true
+
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	header := w.Header()
+	compress := w.shouldCompress()
+
+	if compress {
+		addVary(header, "Accept-Encoding")
+	}
+
+	if compress && large {
+		encoder := newCompressEncoder(w.encoding, w.ResponseWriter)
+		if encoder != nil {
+			header.Set("Content-Encoding", w.encoding)
+			header.Del("Content-Length")
+			// NOTE(patrik): The ranges of the client would be ranges of
+			// the encoded body
+			header.Del("Accept-Ranges")
+			w.encoder = encoder
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buf := w.buf
+	w.buf = nil
+
+	if len(buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+
+	return err
+}
+
+// Flush sends the buffered data, the response is compressed even when it is
+// smaller than MinSize because the size is unknown when streaming
+func (w *compressResponseWriter) Flush() {
+	if !w.decided {
+		w.decide(true)
+	}
+
+	if w.encoder != nil {
+		w.encoder.Flush()
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressResponseWriter) close() error {
+	if !w.decided {
+		if w.status == 0 && len(w.buf) == 0 {
+			// NOTE(patrik): Nothing was written, let net/http send the
+			// default response
+			return nil
+		}
+
+		err := w.decide(false)
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.encoder != nil {
+		err := w.encoder.Close()
+		releaseCompressEncoder(w.encoding, w.encoder)
+		w.encoder = nil
+
+		return err
+	}
+
+	return nil
+}
+
+func addVary(header http.Header, value string) {
+	for _, v := range header.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), value) {
+				return
+			}
+		}
+	}
+
+	header.Add("Vary", value)
+}
+
+func compressMiddleware(config *CompressionConfig) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), config.encodings())
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressResponseWriter{
+				ResponseWriter: w,
+				config:         config,
+				encoding:       encoding,
+			}
+			defer cw.close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+var precompressedEncodings = []struct {
+	encoding string
+	ext      string
+}{
+	{EncodingBrotli, ".br"},
+	{EncodingZstd, ".zst"},
+	{EncodingGzip, ".gz"},
+}
@@ -1,6 +1,7 @@
 package pyrin
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"strings"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/nanoteck137/pyrin/chisel"
 	"github.com/nanoteck137/validate"
 )
 
@@ -20,7 +22,42 @@ type wrapperContext struct {
 	w http.ResponseWriter
 	r *http.Request
 
-	formSpec *FormSpec
+	endpoint   *EndpointInfo
+	formSpec   *FormSpec
+	formStream *FormPartReader
+}
+
+// EndpointInfo describes the handler that serves the request
+type EndpointInfo struct {
+	Name         string
+	Method       string
+	Path         string
+	Summary      string
+	Description  string
+	Tags         []string
+	Deprecated   *Deprecation
+	ResponseType any
+	BodyType     any
+	Security     []*SecurityScheme
+	RateLimits   []*RateLimitPolicy
+	Errors       []ErrorType
+	// Pagination is set for paginated handlers, used by ParsePageParams
+	Pagination *PaginationPolicy
+	// Filter is set for filtered handlers, used by ParseFilter
+	Filter *chisel.Schema
+	// Meta is the metadata added to the group with WithMeta
+	Meta map[string]string
+}
+
+// Endpoint returns the info of the handler that serves the request, used by
+// middlewares to make decisions based on the endpoint
+func Endpoint(c Context) *EndpointInfo {
+	ctx, ok := c.(*wrapperContext)
+	if !ok || ctx.endpoint == nil {
+		return &EndpointInfo{}
+	}
+
+	return ctx.endpoint
 }
 
 func (w *wrapperContext) Response() http.ResponseWriter {
@@ -53,6 +90,23 @@ func (w *wrapperContext) checkContentType(expected string) error {
 	return nil
 }
 
+// checkBodyCodec checks that the server has a codec for the Content-Type of
+// the request
+func (w *wrapperContext) checkBodyCodec() error {
+	_, ok := findCodec(w.r)
+	if ok {
+		return nil
+	}
+
+	codecs := requestCodecs(w.r)
+	types := make([]string, 0, len(codecs))
+	for _, codec := range codecs {
+		types = append(types, codec.ContentType())
+	}
+
+	return BadContentType(strings.Join(types, ", "))
+}
+
 func FormFiles(c Context, key string) ([]*multipart.FileHeader, error) {
 	wrapperContext := c.(*wrapperContext)
 
@@ -67,42 +121,95 @@ func FormFiles(c Context, key string) ([]*multipart.FileHeader, error) {
 		return nil, fmt.Errorf("%s: is not valid, key is not defined in spec", key)
 	}
 
+	if wrapperContext.formStream != nil {
+		return nil, errors.New("handler streams the form use 'FormParts'")
+	}
+
 	form := c.Request().MultipartForm
 	files := form.File[key]
 
 	return files, nil
 }
 
+// FormParts returns the reader of the files for a FormApiHandler with
+// Streaming set
+func FormParts(c Context) (*FormPartReader, error) {
+	wrapperContext := c.(*wrapperContext)
+
+	if wrapperContext.formStream == nil {
+		return nil, errors.New("handler doesn't stream the form set 'Streaming' on the FormApiHandler")
+	}
+
+	return wrapperContext.formStream, nil
+}
+
+func decodeBody(codec Codec, body io.Reader, v any) error {
+	if _, ok := codec.(JSONCodec); ok {
+		decoder := json.NewDecoder(body)
+
+		if !decoder.More() {
+			return EmptyBody()
+		}
+
+		return decoder.Decode(v)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	if len(data) == 0 {
+		return EmptyBody()
+	}
+
+	return codec.Unmarshal(data, v)
+}
+
 func Body[T any](c Context) (T, error) {
 	var res T
 
 	wrapperContext := c.(*wrapperContext)
 
+	// NOTE(patrik): The body of a form is always JSON
+	var codec Codec = JSONCodec{}
+
 	var body io.Reader
-	if wrapperContext.formSpec == nil {
-		body = c.Request().Body
-	} else {
+	switch {
+	case wrapperContext.formStream != nil:
+		body = bytes.NewReader(wrapperContext.formStream.body)
+	case wrapperContext.formSpec != nil:
 		data := c.Request().FormValue(formBodyKey)
 		body = strings.NewReader(data)
-	}
-
-	decoder := json.NewDecoder(body)
+	default:
+		body = c.Request().Body
 
-	if !decoder.More() {
-		return res, EmptyBody()
+		if found, ok := findCodec(c.Request()); ok {
+			codec = found
+		}
 	}
 
-	err := decoder.Decode(&res)
+	err := parseBody(codec, body, &res)
 	if err != nil {
 		return res, err
 	}
 
-	var p any = &res
-	if t, ok := p.(Transformable); ok {
+	return res, nil
+}
+
+// parseBody decodes the body into v and runs the Transform and the Validate
+// of v
+func parseBody(codec Codec, body io.Reader, v any) error {
+	err := decodeBody(codec, body, v)
+	if err != nil {
+		return err
+	}
+
+	if t, ok := v.(Transformable); ok {
 		t.Transform()
 	}
 
-	if v, ok := p.(validate.Validatable); ok {
+	if v, ok := v.(validate.Validatable); ok {
 		err = v.Validate()
 		if err != nil {
 			extra := make(map[string]string)
@@ -113,9 +220,9 @@ func Body[T any](c Context) (T, error) {
 				}
 			}
 
-			return res, ValidationError(extra)
+			return ValidationError(extra)
 		}
 	}
 
-	return res, nil
+	return nil
 }
@@ -0,0 +1,152 @@
+package pyrin
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CorsConfig enables CORS for the server, the allowed methods of the
+// preflight requests are the methods registered on the path
+type CorsConfig struct {
+	// AllowedOrigins can be an exact origin "https://example.com", a
+	// wildcard subdomain "https://*.example.com" or "*" for all origins
+	AllowedOrigins []string
+	// AllowOriginFunc is used when the origin is not in AllowedOrigins
+	AllowOriginFunc func(r *http.Request, origin string) bool
+
+	// AllowedHeaders is the headers the client can send, when empty the
+	// headers requested by the preflight request are allowed
+	AllowedHeaders []string
+	// ExposedHeaders is the response headers the client can read
+	ExposedHeaders []string
+
+	// AllowCredentials can't be used with the "*" origin, any site could
+	// then make requests with the credentials of the user. Use
+	// AllowOriginFunc to allow all origins on purpose
+	AllowCredentials bool
+	// MaxAge is how long the preflight response can be cached, zero does
+	// not send the header
+	MaxAge time.Duration
+}
+
+func matchOrigin(pattern, origin string) bool {
+	if pattern == "*" {
+		return true
+	}
+
+	prefix, suffix, found := strings.Cut(pattern, "*")
+	if !found {
+		return strings.EqualFold(pattern, origin)
+	}
+
+	origin = strings.ToLower(origin)
+	prefix = strings.ToLower(prefix)
+	suffix = strings.ToLower(suffix)
+
+	return len(origin) > len(prefix)+len(suffix) &&
+		strings.HasPrefix(origin, prefix) &&
+		strings.HasSuffix(origin, suffix)
+}
+
+func (c *CorsConfig) validate() error {
+	if !c.AllowCredentials {
+		return nil
+	}
+
+	for _, pattern := range c.AllowedOrigins {
+		if pattern == "*" {
+			return errors.New("pyrin: cors: the \"*\" origin can't be used with AllowCredentials, use AllowOriginFunc to allow every origin")
+		}
+	}
+
+	return nil
+}
+
+func (c *CorsConfig) allowOrigin(r *http.Request, origin string) (string, bool) {
+	for _, pattern := range c.AllowedOrigins {
+		if !matchOrigin(pattern, origin) {
+			continue
+		}
+
+		if pattern == "*" {
+			return "*", true
+		}
+
+		return origin, true
+	}
+
+	if c.AllowOriginFunc != nil && c.AllowOriginFunc(r, origin) {
+		return origin, true
+	}
+
+	return "", false
+}
+
+func (s *Server) corsMiddleware(config *CorsConfig) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Add("Vary", "Origin")
+
+			preflight := r.Method == http.MethodOptions &&
+				r.Header.Get("Access-Control-Request-Method") != ""
+
+			allowedOrigin, ok := config.allowOrigin(r, origin)
+			if !ok {
+				if preflight {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header.Set("Access-Control-Allow-Origin", allowedOrigin)
+			if config.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if len(config.ExposedHeaders) > 0 {
+					header.Set("Access-Control-Expose-Headers", strings.Join(config.ExposedHeaders, ", "))
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+
+			methods := s.allowedMethods(r)
+			if len(methods) == 0 {
+				s.errorHandler(RouteNotFound(), w, r)
+				return
+			}
+
+			header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+
+			if len(config.AllowedHeaders) > 0 {
+				header.Set("Access-Control-Allow-Headers", strings.Join(config.AllowedHeaders, ", "))
+			} else if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+				header.Set("Access-Control-Allow-Headers", requested)
+			}
+
+			if config.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(config.MaxAge.Seconds())))
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
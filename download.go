@@ -0,0 +1,275 @@
+package pyrin
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Download is the file returned by a DownloadHandlerFunc
+type Download struct {
+	// Content is the data of the file, Range requests are supported when
+	// Content implements io.Seeker. Content is closed after the response
+	// is written when it implements io.Closer
+	Content io.Reader
+	// Filename is sent in the Content-Disposition header, defaults to the
+	// Filename of the handler
+	Filename string
+	// ContentType overrides the ContentType of the handler
+	ContentType string
+	// Size is used for the Content-Length when Content is not a io.Seeker,
+	// 0 is unknown
+	Size    int64
+	ModTime time.Time
+	// ID identifies the file when the computed digest is cached, defaults
+	// to the path and the query of the request
+	ID string
+	// Digest is the SHA-256 of the content, sent as the Repr-Digest header
+	// and used as the ETag. Computed when the handler has ComputeDigest set
+	Digest []byte
+}
+
+// FileDownload opens the file from the filesystem as a Download
+func FileDownload(filesystem fs.FS, file string) (*Download, error) {
+	f, err := filesystem.Open(file)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, FileNotFound()
+		}
+
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &Download{
+		Content:  f,
+		ID:       file,
+		Filename: path.Base(file),
+		Size:     fi.Size(),
+		ModTime:  fi.ModTime(),
+	}, nil
+}
+
+type DownloadHandlerFunc func(c Context) (*Download, error)
+
+// DownloadHandler sends a file, the response supports Range requests and
+// the generated clients gets a download method that returns the content as
+// a stream
+type DownloadHandler struct {
+	Name        string
+	Method      string
+	Path        string
+	Summary     string
+	Description string
+	Tags        []string
+	Deprecated  *Deprecation
+	// ContentType is the media type of the files, detected from the
+	// filename when empty
+	ContentType string
+	// Filename is the default filename of the files
+	Filename string
+	// Inline shows the file in the browser instead of saving it
+	Inline bool
+	// ComputeDigest computes the SHA-256 of the content when the Download
+	// has no Digest, requires Content to implement io.Seeker. Hashing reads
+	// the whole file so the digest is cached by the ID of the Download, the
+	// size and the ModTime, without a ModTime the file is hashed on every
+	// request. Set Digest on the Download for large files
+	ComputeDigest bool
+	Security      []*SecurityScheme
+	RateLimit     *RateLimitPolicy
+	Errors        []ErrorType
+	Middlewares   []MiddlewareFunc
+	HandlerFunc   DownloadHandlerFunc
+}
+
+func (h DownloadHandler) handlerType() {}
+
+func (h *DownloadHandler) contentType(d *Download, filename string) string {
+	if d.ContentType != "" {
+		return d.ContentType
+	}
+
+	if h.ContentType != "" {
+		return h.ContentType
+	}
+
+	if t := mime.TypeByExtension(path.Ext(filename)); t != "" {
+		return t
+	}
+
+	return "application/octet-stream"
+}
+
+const maxDigestCacheEntries = 1024
+
+type digestKey struct {
+	id      string
+	size    int64
+	modTime time.Time
+}
+
+// digestCache keeps the digests computed by a DownloadHandler
+type digestCache struct {
+	mu      sync.Mutex
+	entries map[digestKey][]byte
+}
+
+func newDigestCache() *digestCache {
+	return &digestCache{
+		entries: make(map[digestKey][]byte),
+	}
+}
+
+// digest returns the SHA-256 of the content, the content is read from the
+// start and is rewound afterwards
+func (c *digestCache) digest(r *http.Request, d *Download, rs io.ReadSeeker) ([]byte, error) {
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE(patrik): The path alone doesn't identify the file when the
+	// handler picks the file from the query
+	id := d.ID
+	if id == "" {
+		id = r.URL.Path + "?" + r.URL.RawQuery
+	}
+
+	key := digestKey{
+		id:      id,
+		size:    size,
+		modTime: d.ModTime,
+	}
+
+	cache := !d.ModTime.IsZero()
+	if cache {
+		c.mu.Lock()
+		digest, exists := c.entries[key]
+		c.mu.Unlock()
+
+		if exists {
+			_, err = rs.Seek(0, io.SeekStart)
+			if err != nil {
+				return nil, err
+			}
+
+			return digest, nil
+		}
+	}
+
+	_, err = rs.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, rs)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = rs.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := hash.Sum(nil)
+
+	if cache {
+		c.mu.Lock()
+		// NOTE(patrik): Keep the cache bounded, the digests is computed
+		// again when needed
+		if len(c.entries) >= maxDigestCacheEntries {
+			clear(c.entries)
+		}
+		c.entries[key] = digest
+		c.mu.Unlock()
+	}
+
+	return digest, nil
+}
+
+// serveDownload writes the download, Range and conditional requests are
+// handled by http.ServeContent when the content can seek
+func (h *DownloadHandler) serveDownload(ctx *wrapperContext, d *Download, digests *digestCache) error {
+	if closer, ok := d.Content.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	filename := d.Filename
+	if filename == "" {
+		filename = h.Filename
+	}
+
+	header := ctx.w.Header()
+	header.Set("Content-Type", h.contentType(d, filename))
+
+	disposition := "attachment"
+	if h.Inline {
+		disposition = "inline"
+	}
+
+	params := map[string]string{}
+	if filename != "" {
+		params["filename"] = filename
+	}
+
+	// NOTE(patrik): FormatMediaType uses the RFC 2231 encoding for
+	// filenames that are not ASCII
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, params))
+
+	rs, canSeek := d.Content.(io.ReadSeeker)
+
+	digest := d.Digest
+	if digest == nil && h.ComputeDigest && canSeek {
+		var err error
+		digest, err = digests.digest(ctx.r, d, rs)
+		if err != nil {
+			return err
+		}
+	}
+
+	if digest != nil {
+		header.Set("Repr-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(digest)+":")
+		header.Set("ETag", `"`+hex.EncodeToString(digest)+`"`)
+	}
+
+	if canSeek {
+		http.ServeContent(ctx.w, ctx.r, filename, d.ModTime, rs)
+		return nil
+	}
+
+	header.Set("Accept-Ranges", "none")
+
+	if !d.ModTime.IsZero() {
+		header.Set("Last-Modified", d.ModTime.UTC().Format(http.TimeFormat))
+	}
+
+	if d.Size > 0 {
+		header.Set("Content-Length", strconv.FormatInt(d.Size, 10))
+	}
+
+	ctx.w.WriteHeader(http.StatusOK)
+
+	if ctx.r.Method != http.MethodHead {
+		io.Copy(ctx.w, d.Content)
+	}
+
+	return nil
+}
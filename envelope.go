@@ -0,0 +1,147 @@
+package pyrin
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	EnvelopeDefault = "default"
+	EnvelopeProblem = "problem"
+)
+
+const problemJsonMimeType = "application/problem+json"
+
+// Envelope wraps the data and the errors of the ApiHandlers before they are
+// encoded by the codec
+type Envelope interface {
+	// Name is recorded in the ServerDef so the generated clients knows how
+	// to read the responses, the generators supports EnvelopeDefault and
+	// EnvelopeProblem
+	Name() string
+	Success(data any) any
+	Error(r *http.Request, err Error) any
+	// ErrorContentType returns the Content-Type of the error responses
+	// encoded with the codec
+	ErrorContentType(codec Codec) string
+}
+
+var (
+	_ Envelope = DefaultEnvelope{}
+	_ Envelope = ProblemEnvelope{}
+)
+
+// DefaultEnvelope wraps the responses in {success, data, error}
+type DefaultEnvelope struct{}
+
+func (DefaultEnvelope) Name() string {
+	return EnvelopeDefault
+}
+
+func (DefaultEnvelope) Success(data any) any {
+	return SuccessResponse(data)
+}
+
+func (DefaultEnvelope) Error(r *http.Request, err Error) any {
+	return ErrorResponse(err)
+}
+
+func (DefaultEnvelope) ErrorContentType(codec Codec) string {
+	return contentTypeHeader(codec)
+}
+
+// ProblemDetails is the RFC 9457 error response, ErrorType and Extra are
+// extension members with the type and extra of the Error
+type ProblemDetails struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	ErrorType ErrorType `json:"errorType"`
+	Extra     any       `json:"extra,omitempty"`
+}
+
+// ProblemEnvelope sends the data of successful responses as is and the
+// errors as RFC 9457 problem details
+type ProblemEnvelope struct {
+	// TypeBase is the prefix of the type URI of the problems, the error type
+	// is added in lower case, e.g. "https://example.com/problems/" gives
+	// "https://example.com/problems/validation-error". The type is
+	// "about:blank" when empty
+	TypeBase string
+}
+
+func (ProblemEnvelope) Name() string {
+	return EnvelopeProblem
+}
+
+func (ProblemEnvelope) Success(data any) any {
+	return data
+}
+
+func (e ProblemEnvelope) Error(r *http.Request, err Error) any {
+	typ := "about:blank"
+	if e.TypeBase != "" {
+		typ = e.TypeBase + strings.ReplaceAll(strings.ToLower(string(err.Type)), "_", "-")
+	}
+
+	return ProblemDetails{
+		Type:      typ,
+		Title:     http.StatusText(err.Code),
+		Status:    err.Code,
+		Detail:    err.Message,
+		Instance:  r.URL.Path,
+		ErrorType: err.Type,
+		Extra:     err.Extra,
+	}
+}
+
+func (ProblemEnvelope) ErrorContentType(codec Codec) string {
+	// NOTE(patrik): RFC 9457 only defines a media type for JSON
+	if codec.ContentType() == jsonMimeType {
+		return problemJsonMimeType
+	}
+
+	return codec.ContentType()
+}
+
+func requestEnvelope(r *http.Request) Envelope {
+	if store := getRequestStore(r); store != nil && store.envelope != nil {
+		return store.envelope
+	}
+
+	return DefaultEnvelope{}
+}
+
+// marshalSuccess encodes the data in the envelope with the codec the client
+// accepts, used when the body is needed before it's written
+func marshalSuccess(r *http.Request, data any) ([]byte, string, error) {
+	return marshalResponse(r, requestEnvelope(r).Success(data))
+}
+
+func writeSuccess(w http.ResponseWriter, r *http.Request, code int, data any) {
+	body, contentType, err := marshalSuccess(r, data)
+	if err != nil {
+		writeError(w, r, Error{
+			Code:    http.StatusInternalServerError,
+			Type:    ErrTypeUnknownError,
+			Message: "Internal Server Error",
+		})
+		return
+	}
+
+	writeBody(w, r, code, contentType, body)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err Error) {
+	envelope := requestEnvelope(r)
+	codec := negotiateCodec(r)
+
+	// NOTE(patrik): The error types only contains values that can be
+	// encoded
+	body, _ := codec.Marshal(envelope.Error(r, err))
+
+	writeBody(w, r, err.Code, envelope.ErrorContentType(codec), body)
+}
@@ -3,6 +3,7 @@ package pyrin
 import (
 	"fmt"
 	"net/http"
+	"time"
 )
 
 // TODO(patrik): Capture the original error when returning api errors
@@ -13,7 +14,26 @@ const (
 	ErrTypeValidationError     ErrorType = "VALIDATION_ERROR"
 	ErrTypeFormValidationError ErrorType = "FORM_VALIDATION_ERROR"
 	ErrTypeEmptyBody           ErrorType = "EMPTY_BODY_ERROR"
+	ErrTypeBodyTooLarge        ErrorType = "BODY_TOO_LARGE"
 	ErrTypeBadContentType      ErrorType = "BAD_CONTENT_TYPE_ERROR"
+	ErrTypeUnauthorized        ErrorType = "UNAUTHORIZED"
+	ErrTypeMethodNotAllowed    ErrorType = "METHOD_NOT_ALLOWED"
+	ErrTypeRateLimited         ErrorType = "RATE_LIMITED"
+	ErrTypeIdempotencyRequired ErrorType = "IDEMPOTENCY_KEY_REQUIRED"
+	ErrTypeIdempotencyMismatch ErrorType = "IDEMPOTENCY_KEY_MISMATCH"
+	ErrTypeIdempotencyInUse    ErrorType = "IDEMPOTENCY_KEY_IN_USE"
+	ErrTypeFileNotFound        ErrorType = "FILE_NOT_FOUND"
+	ErrTypeUploadNotFound      ErrorType = "UPLOAD_NOT_FOUND"
+	ErrTypeUploadExpired       ErrorType = "UPLOAD_EXPIRED"
+	ErrTypeUploadTooLarge      ErrorType = "UPLOAD_TOO_LARGE"
+	ErrTypeUploadOffset        ErrorType = "UPLOAD_OFFSET_MISMATCH"
+	ErrTypeUploadChecksum      ErrorType = "UPLOAD_CHECKSUM_MISMATCH"
+	ErrTypeUploadIncomplete    ErrorType = "UPLOAD_INCOMPLETE"
+	ErrTypeUploadLocked        ErrorType = "UPLOAD_LOCKED"
+	ErrTypeJobNotFound         ErrorType = "JOB_NOT_FOUND"
+	ErrTypeJobCanceled         ErrorType = "JOB_CANCELED"
+	ErrTypeJobFinished         ErrorType = "JOB_FINISHED"
+	ErrTypeJobQueueFull        ErrorType = "JOB_QUEUE_FULL"
 )
 
 var GlobalErrors = []ErrorType{
@@ -22,7 +42,26 @@ var GlobalErrors = []ErrorType{
 	ErrTypeValidationError,
 	ErrTypeFormValidationError,
 	ErrTypeEmptyBody,
+	ErrTypeBodyTooLarge,
 	ErrTypeBadContentType,
+	ErrTypeUnauthorized,
+	ErrTypeMethodNotAllowed,
+	ErrTypeRateLimited,
+	ErrTypeIdempotencyRequired,
+	ErrTypeIdempotencyMismatch,
+	ErrTypeIdempotencyInUse,
+	ErrTypeFileNotFound,
+	ErrTypeUploadNotFound,
+	ErrTypeUploadExpired,
+	ErrTypeUploadTooLarge,
+	ErrTypeUploadOffset,
+	ErrTypeUploadChecksum,
+	ErrTypeUploadIncomplete,
+	ErrTypeUploadLocked,
+	ErrTypeJobNotFound,
+	ErrTypeJobCanceled,
+	ErrTypeJobFinished,
+	ErrTypeJobQueueFull,
 }
 
 type ErrorType string
@@ -104,6 +143,14 @@ func EmptyBody() *Error {
 	}
 }
 
+func BodyTooLarge(maxSize int64) *Error {
+	return &Error{
+		Code:    http.StatusRequestEntityTooLarge,
+		Type:    ErrTypeBodyTooLarge,
+		Message: fmt.Sprintf("Body is larger than %d bytes", maxSize),
+	}
+}
+
 func BadContentType(expected string) *Error {
 	return &Error{
 		Code:    http.StatusBadRequest,
@@ -112,8 +159,158 @@ func BadContentType(expected string) *Error {
 	}
 }
 
+func Unauthorized() *Error {
+	return &Error{
+		Code:    http.StatusUnauthorized,
+		Type:    ErrTypeUnauthorized,
+		Message: "Unauthorized",
+	}
+}
+
+func MethodNotAllowed() *Error {
+	return &Error{
+		Code:    http.StatusMethodNotAllowed,
+		Type:    ErrTypeMethodNotAllowed,
+		Message: "Method not allowed",
+	}
+}
+
+func RateLimited(retryAfter time.Duration) *Error {
+	return &Error{
+		Code:    http.StatusTooManyRequests,
+		Type:    ErrTypeRateLimited,
+		Message: fmt.Sprintf("Rate limited, retry after %s", retryAfter.Round(time.Second)),
+	}
+}
+
+func IdempotencyKeyRequired() *Error {
+	return &Error{
+		Code:    http.StatusBadRequest,
+		Type:    ErrTypeIdempotencyRequired,
+		Message: "Idempotency-Key header is required",
+	}
+}
+
+func IdempotencyKeyMismatch() *Error {
+	return &Error{
+		Code:    http.StatusUnprocessableEntity,
+		Type:    ErrTypeIdempotencyMismatch,
+		Message: "Idempotency-Key was used for a different request",
+	}
+}
+
+func IdempotencyKeyInUse() *Error {
+	return &Error{
+		Code:    http.StatusConflict,
+		Type:    ErrTypeIdempotencyInUse,
+		Message: "A request with the same Idempotency-Key is in progress",
+	}
+}
+
+func FileNotFound() *Error {
+	return &Error{
+		Code:    http.StatusNotFound,
+		Type:    ErrTypeFileNotFound,
+		Message: "File not found",
+	}
+}
+
+func UploadNotFound() *Error {
+	return &Error{
+		Code:    http.StatusNotFound,
+		Type:    ErrTypeUploadNotFound,
+		Message: "Upload not found",
+	}
+}
+
+func UploadExpired() *Error {
+	return &Error{
+		Code:    http.StatusGone,
+		Type:    ErrTypeUploadExpired,
+		Message: "Upload has expired",
+	}
+}
+
+func UploadTooLarge(maxSize int64) *Error {
+	return &Error{
+		Code:    http.StatusRequestEntityTooLarge,
+		Type:    ErrTypeUploadTooLarge,
+		Message: fmt.Sprintf("Upload is larger than %d bytes", maxSize),
+	}
+}
+
+// UploadOffsetMismatch is returned when a chunk is not sent at the offset
+// of the upload, the offset is in the extra so the client can resume
+func UploadOffsetMismatch(offset int64) *Error {
+	return &Error{
+		Code:    http.StatusConflict,
+		Type:    ErrTypeUploadOffset,
+		Message: "Upload-Offset doesn't match the offset of the upload",
+		Extra: map[string]int64{
+			"offset": offset,
+		},
+	}
+}
+
+func UploadChecksumMismatch() *Error {
+	return &Error{
+		Code:    http.StatusBadRequest,
+		Type:    ErrTypeUploadChecksum,
+		Message: "Checksum of the upload doesn't match",
+	}
+}
+
+func UploadIncomplete(offset, length int64) *Error {
+	return &Error{
+		Code:    http.StatusConflict,
+		Type:    ErrTypeUploadIncomplete,
+		Message: fmt.Sprintf("Upload is incomplete, got %d of %d bytes", offset, length),
+	}
+}
+
+func UploadLocked() *Error {
+	return &Error{
+		Code:    http.StatusLocked,
+		Type:    ErrTypeUploadLocked,
+		Message: "Upload is used by another request",
+	}
+}
+
 func NoContentNotFound() *NoContentError {
 	return &NoContentError{
 		Code: http.StatusNotFound,
 	}
 }
+
+func JobNotFound() *Error {
+	return &Error{
+		Code:    http.StatusNotFound,
+		Type:    ErrTypeJobNotFound,
+		Message: "Job not found",
+	}
+}
+
+// JobCanceled is the error of a job that was canceled
+func JobCanceled() *Error {
+	return &Error{
+		Code:    http.StatusConflict,
+		Type:    ErrTypeJobCanceled,
+		Message: "Job was canceled",
+	}
+}
+
+func JobFinished() *Error {
+	return &Error{
+		Code:    http.StatusConflict,
+		Type:    ErrTypeJobFinished,
+		Message: "Job has already finished",
+	}
+}
+
+func JobQueueFull() *Error {
+	return &Error{
+		Code:    http.StatusServiceUnavailable,
+		Type:    ErrTypeJobQueueFull,
+		Message: "Job queue is full",
+	}
+}
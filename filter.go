@@ -0,0 +1,35 @@
+package pyrin
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nanoteck137/pyrin/chisel"
+)
+
+// ParseFilter reads the filter and sort query params with the Filter schema
+// of the handler, a ValidationError is returned for invalid expressions.
+// Translate the query with chisel.SQL or walk the chisel AST
+func ParseFilter(c Context) (*chisel.Query, error) {
+	schema := Endpoint(c).Filter
+	if schema == nil {
+		// NOTE(patrik): Without a schema nothing can be filtered or sorted
+		schema = &chisel.Schema{}
+	}
+
+	query := c.Request().URL.Query()
+
+	res, err := schema.Parse(query.Get("filter"), query.Get("sort"))
+	if err != nil {
+		var chiselErr *chisel.Error
+		if errors.As(err, &chiselErr) {
+			return nil, ValidationError(map[string]string{
+				chiselErr.Param: fmt.Sprintf("%s at position %d", chiselErr.Message, chiselErr.Pos),
+			})
+		}
+
+		return nil, err
+	}
+
+	return res, nil
+}
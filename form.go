@@ -0,0 +1,461 @@
+package pyrin
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// sniffLen is the number of bytes http.DetectContentType looks at
+const sniffLen = 512
+
+// detectFileType returns the media type of the file from the content,
+// falls back to the Content-Type of the part when the content is not
+// recognized
+func detectFileType(file *multipart.FileHeader) (string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	return sniffMediaType(buf[:n], file.Header.Get("Content-Type")), nil
+}
+
+// textMediaTypes is the types outside of text/* that are text, the content
+// of them sniffs as text/plain
+var textMediaTypes = map[string]bool{
+	"application/json":       true,
+	"application/xml":        true,
+	"application/yaml":       true,
+	"application/x-yaml":     true,
+	"application/toml":       true,
+	"application/javascript": true,
+	"application/x-ndjson":   true,
+	"application/sql":        true,
+	"application/graphql":    true,
+}
+
+func isTextMediaType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+json") ||
+		strings.HasSuffix(mediaType, "+xml") ||
+		textMediaTypes[mediaType]
+}
+
+// sniffMediaType returns the media type of the file, the sniffed type is
+// only used when it's more specific than the declared type or conflicts
+// with it
+func sniffMediaType(head []byte, declared string) string {
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+
+	mediaType, _, err := mime.ParseMediaType(declared)
+	if err != nil || mediaType == "application/octet-stream" {
+		return sniffed
+	}
+
+	switch {
+	case sniffed == "application/octet-stream":
+		return mediaType
+	// NOTE(patrik): Text is only detected as text/plain or text/xml, e.g.
+	// JSON, CSV and SVG files, so the declared type is more specific
+	case (sniffed == "text/plain" || sniffed == "text/xml") && isTextMediaType(mediaType):
+		return mediaType
+	}
+
+	return sniffed
+}
+
+func mimeTypeAllowed(allowed []string, mediaType string) bool {
+	for _, a := range allowed {
+		if matchMediaRange(strings.ToLower(a), mediaType) >= 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateFiles checks the files of a field against the spec, returns the
+// validation message or "" when the files are valid
+func validateFiles(spec FormFileSpec, files []*multipart.FileHeader) (string, error) {
+	if len(files) == 0 && spec.Optional {
+		return "", nil
+	}
+
+	if len(files) < spec.NumExpected {
+		return fmt.Sprintf(
+			"expected %d or more files, got %d",
+			spec.NumExpected,
+			len(files),
+		), nil
+	}
+
+	if spec.MaxFiles > 0 && len(files) > spec.MaxFiles {
+		return fmt.Sprintf(
+			"expected at most %d files, got %d",
+			spec.MaxFiles,
+			len(files),
+		), nil
+	}
+
+	for _, file := range files {
+		if spec.MaxFileSize > 0 && file.Size > spec.MaxFileSize {
+			return fmt.Sprintf(
+				"file %q is larger than %d bytes",
+				file.Filename,
+				spec.MaxFileSize,
+			), nil
+		}
+
+		if len(spec.AllowedMimeTypes) > 0 {
+			mediaType, err := detectFileType(file)
+			if err != nil {
+				return "", err
+			}
+
+			if !mimeTypeAllowed(spec.AllowedMimeTypes, mediaType) {
+				return fmt.Sprintf(
+					"file %q has type %q, expected one of: %s",
+					file.Filename,
+					mediaType,
+					strings.Join(spec.AllowedMimeTypes, ", "),
+				), nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+func validateForm(spec *FormSpec, form *multipart.Form) error {
+	extra := make(map[string]string)
+
+	if spec.BodyType != nil && !spec.OptionalBody {
+		data := form.Value[formBodyKey]
+		if len(data) < 1 || strings.TrimSpace(data[0]) == "" {
+			extra[formBodyKey] = "contains no data"
+		}
+	}
+
+	// NOTE(patrik): Sorted so the field that goes over MaxTotalSize is
+	// the same for every request
+	fields := make([]string, 0, len(spec.Files))
+	for field := range spec.Files {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var total int64
+	for _, field := range fields {
+		files := form.File[field]
+
+		msg, err := validateFiles(spec.Files[field], files)
+		if err != nil {
+			return err
+		}
+
+		if msg != "" {
+			extra[field] = msg
+			continue
+		}
+
+		for _, file := range files {
+			total += file.Size
+		}
+
+		if spec.MaxTotalSize > 0 && total > spec.MaxTotalSize {
+			extra[field] = fmt.Sprintf(
+				"total size of the files is larger than %d bytes",
+				spec.MaxTotalSize,
+			)
+		}
+	}
+
+	if len(extra) > 0 {
+		return FormValidationError(extra)
+	}
+
+	return nil
+}
+
+// formTooLargeError is returned when the form is larger than MaxTotalSize
+// before the files could be read, the error is set on every file field
+// because it's unknown which field went over the limit
+func formTooLargeError(spec *FormSpec) *Error {
+	extra := make(map[string]string)
+	for field := range spec.Files {
+		extra[field] = fmt.Sprintf(
+			"total size of the files is larger than %d bytes",
+			spec.MaxTotalSize,
+		)
+	}
+
+	return FormValidationError(extra)
+}
+
+func fieldError(field, format string, args ...any) *Error {
+	return FormValidationError(map[string]string{
+		field: fmt.Sprintf(format, args...),
+	})
+}
+
+// FormPart is a file of a streamed form, the content of the file is read
+// from the part and the limits of the spec are checked while it's read
+type FormPart struct {
+	Field    string
+	Filename string
+	// ContentType is the type sniffed from the content when the spec has
+	// AllowedMimeTypes, otherwise the Content-Type of the part
+	ContentType string
+	Header      textproto.MIMEHeader
+
+	reader  *FormPartReader
+	spec    FormFileSpec
+	content io.Reader
+	size    int64
+	err     error
+}
+
+func (p *FormPart) Read(b []byte) (int, error) {
+	if p.err != nil {
+		return 0, p.err
+	}
+
+	n, err := p.content.Read(b)
+	p.size += int64(n)
+	p.reader.total += int64(n)
+
+	switch {
+	case p.spec.MaxFileSize > 0 && p.size > p.spec.MaxFileSize:
+		p.err = fieldError(p.Field, "file %q is larger than %d bytes", p.Filename, p.spec.MaxFileSize)
+	case p.reader.spec.MaxTotalSize > 0 && p.reader.total > p.reader.spec.MaxTotalSize:
+		p.err = fieldError(p.Field, "total size of the files is larger than %d bytes", p.reader.spec.MaxTotalSize)
+	}
+
+	if p.err != nil {
+		return n, p.err
+	}
+
+	return n, err
+}
+
+// FormPartReader reads the files of a streamed form in the order the client
+// sent them, the form is not buffered so every part needs to be read before
+// the next part
+type FormPartReader struct {
+	spec *FormSpec
+	mr   *multipart.Reader
+
+	body []byte
+	// next is the part read while looking for the body
+	next *multipart.Part
+	eof  bool
+
+	counts map[string]int
+	total  int64
+}
+
+// newFormPartReader reads the body of the form, the body needs to be the
+// first part so it's decoded and validated before the files are read
+func newFormPartReader(r *http.Request, spec *FormSpec) (*FormPartReader, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &FormPartReader{
+		spec:   spec,
+		mr:     mr,
+		counts: make(map[string]int),
+	}
+
+	if spec.BodyType == nil {
+		return res, nil
+	}
+
+	part, err := mr.NextPart()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if part == nil || part.FormName() != formBodyKey || part.FileName() != "" {
+		res.next = part
+		res.eof = part == nil
+
+		if !spec.OptionalBody {
+			return nil, fieldError(formBodyKey, "expected as the first part of the form")
+		}
+
+		return res, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(part, defaultMemory+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) > defaultMemory {
+		return nil, fieldError(formBodyKey, "is larger than %d bytes", defaultMemory)
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if !spec.OptionalBody {
+			return nil, fieldError(formBodyKey, "contains no data")
+		}
+
+		return res, nil
+	}
+
+	res.body = body
+
+	// NOTE(patrik): Validated here so the handler can trust the body
+	// before it starts to read the files
+	t := reflect.TypeOf(spec.BodyType)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	v := reflect.New(t).Interface()
+	err = parseBody(JSONCodec{}, bytes.NewReader(body), v)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Next returns the next file of the form, returns io.EOF after the last
+// file. Parts that are not in the spec are rejected with a
+// FORM_VALIDATION_ERROR
+func (r *FormPartReader) Next() (*FormPart, error) {
+	part := r.next
+	r.next = nil
+
+	if part == nil {
+		if r.eof {
+			return nil, r.finish()
+		}
+
+		var err error
+		part, err = r.mr.NextPart()
+		if err == io.EOF {
+			r.eof = true
+			return nil, r.finish()
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	field := part.FormName()
+
+	spec, exists := r.spec.Files[field]
+	if !exists || part.FileName() == "" {
+		if field == formBodyKey {
+			return nil, fieldError(field, "expected as the first part of the form")
+		}
+
+		return nil, fieldError(field, "is not defined in the spec")
+	}
+
+	r.counts[field]++
+	if spec.MaxFiles > 0 && r.counts[field] > spec.MaxFiles {
+		return nil, fieldError(field, "expected at most %d files", spec.MaxFiles)
+	}
+
+	res := &FormPart{
+		Field:       field,
+		Filename:    part.FileName(),
+		ContentType: part.Header.Get("Content-Type"),
+		Header:      part.Header,
+		reader:      r,
+		spec:        spec,
+		content:     part,
+	}
+
+	if len(spec.AllowedMimeTypes) > 0 {
+		br := bufio.NewReaderSize(part, sniffLen)
+
+		head, err := br.Peek(sniffLen)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		res.ContentType = sniffMediaType(head, part.Header.Get("Content-Type"))
+		res.content = br
+
+		if !mimeTypeAllowed(spec.AllowedMimeTypes, res.ContentType) {
+			return nil, fieldError(
+				field,
+				"file %q has type %q, expected one of: %s",
+				res.Filename,
+				res.ContentType,
+				strings.Join(spec.AllowedMimeTypes, ", "),
+			)
+		}
+	}
+
+	return res, nil
+}
+
+// drain reads the parts the handler didn't read, so the limits and the
+// number of files are checked when the handler stops before the last part
+func (r *FormPartReader) drain() error {
+	for {
+		part, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(io.Discard, part)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// finish checks the number of files after the last part
+func (r *FormPartReader) finish() error {
+	extra := make(map[string]string)
+
+	for field, spec := range r.spec.Files {
+		count := r.counts[field]
+		if count == 0 && spec.Optional {
+			continue
+		}
+
+		if count < spec.NumExpected {
+			extra[field] = fmt.Sprintf(
+				"expected %d or more files, got %d",
+				spec.NumExpected,
+				count,
+			)
+		}
+	}
+
+	if len(extra) > 0 {
+		return FormValidationError(extra)
+	}
+
+	return io.EOF
+}
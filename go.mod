@@ -1,16 +1,18 @@
 module github.com/nanoteck137/pyrin
 
-go 1.21.0
-
-toolchain go1.21.7
+go 1.22.0
 
 require (
+	github.com/fxamacker/cbor/v2 v2.9.2
 	github.com/go-chi/chi/v5 v5.2.1
 	github.com/iancoleman/strcase v0.3.0
+	github.com/klauspost/compress v1.18.0
 	github.com/kr/pretty v0.3.1
 	github.com/maruel/natural v1.1.1
 	github.com/nanoteck137/validate v0.0.0-20241129211421-90ceb11de343
 	github.com/spf13/cobra v1.8.0
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	golang.org/x/tools v0.26.0
 )
 
 require (
@@ -20,4 +22,8 @@ require (
 	github.com/rogpeppe/go-internal v1.9.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/stretchr/testify v1.7.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/mod v0.21.0 // indirect
+	golang.org/x/sync v0.8.0 // indirect
 )
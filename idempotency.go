@@ -0,0 +1,325 @@
+package pyrin
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+const defaultIdempotencyWindow = 24 * time.Hour
+
+// IdempotencyPolicy makes an ApiHandler replay the stored response when a
+// request is repeated with the same Idempotency-Key header
+type IdempotencyPolicy struct {
+	// Window is how long the responses are stored, defaults to 24 hours
+	Window time.Duration
+	// Required rejects the requests without a Idempotency-Key header
+	Required bool
+	// Store defaults to the store of the server
+	Store IdempotencyStore
+}
+
+func (p *IdempotencyPolicy) window() time.Duration {
+	if p.Window > 0 {
+		return p.Window
+	}
+
+	return defaultIdempotencyWindow
+}
+
+// IdempotencyRecord is the stored response of a request
+type IdempotencyRecord struct {
+	// Fingerprint is the hash of the request, used to detect when the key
+	// is reused for a different request
+	Fingerprint string
+	// Completed is false while the first request is still running
+	Completed bool
+
+	StatusCode int
+	Header     http.Header
+	// Bodies is the response encoded with every codec of the server, keyed
+	// by the Content-Type, so a replay can use another codec than the first
+	// request
+	Bodies map[string][]byte
+}
+
+// IdempotencyStore stores the responses of the idempotent requests,
+// implement it to share the responses between multiple servers
+type IdempotencyStore interface {
+	// Begin locks the key for the request, when the key already exists the
+	// existing record is returned and acquired is false
+	Begin(ctx context.Context, key string, fingerprint string, ttl time.Duration) (record *IdempotencyRecord, acquired bool, err error)
+	// Complete stores the response and unlocks the key
+	Complete(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) error
+	// Release removes the lock without storing a response so the request
+	// can be retried
+	Release(ctx context.Context, key string) error
+}
+
+type idempotencyEntry struct {
+	record  IdempotencyRecord
+	expires time.Time
+}
+
+var _ IdempotencyStore = (*MemoryIdempotencyStore)(nil)
+
+// MemoryIdempotencyStore keeps the responses in memory
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	nextSweep time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+
+	for key, entry := range s.entries {
+		if now.After(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+
+	s.nextSweep = now.Add(time.Minute)
+}
+
+func (s *MemoryIdempotencyStore) Begin(ctx context.Context, key string, fingerprint string, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	if entry, exists := s.entries[key]; exists && now.Before(entry.expires) {
+		record := entry.record
+		return &record, false, nil
+	}
+
+	s.entries[key] = &idempotencyEntry{
+		record: IdempotencyRecord{
+			Fingerprint: fingerprint,
+		},
+		expires: now.Add(ttl),
+	}
+
+	return nil, true, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record.Completed = true
+	s.entries[key] = &idempotencyEntry{
+		record:  record,
+		expires: time.Now().Add(ttl),
+	}
+
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+
+	return nil
+}
+
+// NOTE(patrik): The body is read so it can be part of the fingerprint, the
+// request body is replaced so the handler can still read it. The body is
+// kept in memory so it's limited like the body of a form
+func requestFingerprint(ctx *wrapperContext) (string, error) {
+	body, err := io.ReadAll(io.LimitReader(ctx.r.Body, defaultMemory+1))
+	if err != nil {
+		return "", err
+	}
+
+	if len(body) > defaultMemory {
+		return "", BodyTooLarge(defaultMemory)
+	}
+	ctx.r.Body = io.NopCloser(bytes.NewReader(body))
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", ctx.r.Method, ctx.r.URL.RequestURI())
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func writeIdempotencyRecord(w http.ResponseWriter, r *http.Request, record *IdempotencyRecord) {
+	for k, v := range record.Header {
+		w.Header()[k] = v
+	}
+
+	w.Header().Set("Idempotent-Replayed", "true")
+
+	if !hasResponseBody(record.StatusCode) {
+		w.WriteHeader(record.StatusCode)
+		return
+	}
+
+	contentType := contentTypeHeader(negotiateCodec(r))
+	body, exists := record.Bodies[contentType]
+	if !exists {
+		// NOTE(patrik): The codecs of the server changed since the
+		// response was stored, fallback to any of the stored encodings
+		for ct, b := range record.Bodies {
+			contentType, body = ct, b
+			break
+		}
+	}
+
+	writeBody(w, r, record.StatusCode, contentType, body)
+}
+
+// marshalAllCodecs encodes the success response with every codec of the
+// server, keyed by the Content-Type
+func marshalAllCodecs(r *http.Request, data any) (map[string][]byte, error) {
+	res := make(map[string][]byte)
+
+	v := requestEnvelope(r).Success(data)
+	for _, codec := range requestCodecs(r) {
+		body, err := codec.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		res[contentTypeHeader(codec)] = body
+	}
+
+	return res, nil
+}
+
+// runIdempotent runs the handler once per Idempotency-Key, only successful
+// responses are stored, errors releases the key so the request can be
+// retried
+func runIdempotent(ctx *wrapperContext, policy *IdempotencyPolicy, defaultStore IdempotencyStore, status int, handler ApiHandlerFunc) error {
+	idempotencyKey := ctx.r.Header.Get(idempotencyKeyHeader)
+	if idempotencyKey == "" {
+		if policy.Required {
+			return IdempotencyKeyRequired()
+		}
+
+		data, err := handler(ctx)
+		if err != nil {
+			return err
+		}
+
+		writeApiResult(ctx, status, data)
+
+		return nil
+	}
+
+	store := policy.Store
+	if store == nil {
+		store = defaultStore
+	}
+
+	fingerprint, err := requestFingerprint(ctx)
+	if err != nil {
+		return err
+	}
+
+	key := ctx.endpoint.Method + " " + ctx.endpoint.Path + "|"
+	if principal := Principal(ctx); principal != nil {
+		key += fmt.Sprint(principal) + "|"
+	}
+	key += idempotencyKey
+
+	reqCtx := ctx.r.Context()
+	ttl := policy.window()
+
+	record, acquired, err := store.Begin(reqCtx, key, fingerprint, ttl)
+	if err != nil {
+		return err
+	}
+
+	if !acquired {
+		if record.Fingerprint != fingerprint {
+			return IdempotencyKeyMismatch()
+		}
+
+		if !record.Completed {
+			ctx.w.Header().Set("Retry-After", "1")
+			return IdempotencyKeyInUse()
+		}
+
+		writeIdempotencyRecord(ctx.w, ctx.r, record)
+
+		return nil
+	}
+
+	// NOTE(patrik): Only the headers set by the handler are stored, the
+	// headers set by the server are written again on replay
+	before := ctx.w.Header().Clone()
+
+	completed := false
+	defer func() {
+		// NOTE(patrik): Release the key if the handler fails or panics
+		if !completed {
+			store.Release(context.WithoutCancel(reqCtx), key)
+		}
+	}()
+
+	data, err := handler(ctx)
+	if err != nil {
+		return err
+	}
+
+	// NOTE(patrik): The headers of the result, e.g. the Link header of a
+	// page, are written before the headers are stored so they are replayed
+	status, data = resolveApiResult(ctx, status, data)
+
+	var bodies map[string][]byte
+	if hasResponseBody(status) {
+		bodies, err = marshalAllCodecs(ctx.r, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	header := http.Header{}
+	for k, v := range ctx.w.Header() {
+		if !slices.Equal(before[k], v) {
+			header[k] = slices.Clone(v)
+		}
+	}
+
+	err = store.Complete(context.WithoutCancel(reqCtx), key, IdempotencyRecord{
+		Fingerprint: fingerprint,
+		StatusCode:  status,
+		Header:      header,
+		Bodies:      bodies,
+	}, ttl)
+	if err != nil {
+		return err
+	}
+	completed = true
+
+	if hasResponseBody(status) {
+		contentType := contentTypeHeader(negotiateCodec(ctx.r))
+		writeBody(ctx.w, ctx.r, status, contentType, bodies[contentType])
+	} else {
+		ctx.w.WriteHeader(status)
+	}
+
+	return nil
+}
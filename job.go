@@ -0,0 +1,191 @@
+package pyrin
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultJobPollInterval = time.Second
+
+type JobState string
+
+const (
+	JobStatePending   JobState = "pending"
+	JobStateRunning   JobState = "running"
+	JobStateCompleted JobState = "completed"
+	JobStateFailed    JobState = "failed"
+	JobStateCanceled  JobState = "canceled"
+)
+
+// Finished returns true when the job will not change anymore
+func (s JobState) Finished() bool {
+	return s == JobStateCompleted || s == JobStateFailed || s == JobStateCanceled
+}
+
+// Job is the resource returned by the routes of a JobHandler
+type Job struct {
+	Id    string   `json:"id"`
+	State JobState `json:"state"`
+	// Result is the data returned by the JobFunc, set when the job is
+	// completed
+	Result any `json:"result,omitempty"`
+	// Error is set when the job is failed or canceled
+	Error      *Error     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// JobFunc is the work of a job, ctx is canceled when the job is canceled.
+// Return a *Error to send the error to the client
+type JobFunc func(ctx context.Context) (any, error)
+
+// JobHandlerFunc validates the request and returns the work of the job.
+// The JobFunc runs after the response is sent so it can't use the Context
+// of the request
+type JobHandlerFunc func(c Context) (JobFunc, error)
+
+// JobHandler runs the work in the background on a JobPool, the request
+// returns 202 Accepted with the Job. Registers the routes:
+//
+//	Method Path               enqueues the job, Location is the path of
+//	                          the job
+//	GET    Path/:jobId        returns the Job
+//	POST   Path/:jobId/cancel cancels the job
+//
+// The unfinished jobs are sent with a Retry-After header, the clients polls
+// the job until it is finished
+type JobHandler struct {
+	Name        string
+	Method      string
+	Path        string
+	Summary     string
+	Description string
+	Tags        []string
+	Deprecated  *Deprecation
+	BodyType    any
+	// ResultType is the type of the Result of the Job
+	ResultType any
+	// PollInterval is sent in the Retry-After header of the unfinished
+	// jobs, defaults to 1 second
+	PollInterval time.Duration
+	// Pool defaults to the JobPool of the server
+	Pool        *JobPool
+	Security    []*SecurityScheme
+	RateLimit   *RateLimitPolicy
+	Errors      []ErrorType
+	Middlewares []MiddlewareFunc
+	HandlerFunc JobHandlerFunc
+}
+
+func (h JobHandler) handlerType() {}
+
+func (h *JobHandler) pollInterval() time.Duration {
+	if h.PollInterval > 0 {
+		return h.PollInterval
+	}
+
+	return defaultJobPollInterval
+}
+
+func (h *JobHandler) writeJob(ctx *wrapperContext, status int, job Job) {
+	if !job.State.Finished() {
+		ctx.w.Header().Set("Retry-After", ceilSeconds(h.pollInterval()))
+	}
+
+	writeApiResult(ctx, status, job)
+}
+
+func (h *JobHandler) enqueue(ctx *wrapperContext, pool *JobPool) error {
+	if h.BodyType != nil {
+		err := ctx.checkBodyCodec()
+		if err != nil {
+			return err
+		}
+	}
+
+	run, err := h.HandlerFunc(ctx)
+	if err != nil {
+		return err
+	}
+
+	job, err := pool.Enqueue(h.Name, run)
+	if err != nil {
+		return err
+	}
+
+	location := strings.TrimSuffix(ctx.r.URL.Path, "/") + "/" + job.Id
+	ctx.w.Header().Set("Location", location)
+
+	h.writeJob(ctx, http.StatusAccepted, job)
+
+	return nil
+}
+
+func (h *JobHandler) status(ctx *wrapperContext, pool *JobPool) error {
+	job, err := pool.Get(h.Name, ctx.Param("jobId"))
+	if err != nil {
+		return err
+	}
+
+	ctx.w.Header().Set("Cache-Control", "no-store")
+	h.writeJob(ctx, 0, job)
+
+	return nil
+}
+
+func (h *JobHandler) cancel(ctx *wrapperContext, pool *JobPool) error {
+	job, err := pool.Cancel(h.Name, ctx.Param("jobId"))
+	if err != nil {
+		return err
+	}
+
+	h.writeJob(ctx, 0, job)
+
+	return nil
+}
+
+func (g *serverGroup) handleJob(h JobHandler) {
+	pool := h.Pool
+	if pool == nil {
+		pool = g.server.jobPool
+	}
+
+	routes := []struct {
+		method   string
+		path     string
+		bodyType any
+		run      func(ctx *wrapperContext, pool *JobPool) error
+	}{
+		{h.Method, h.Path, h.BodyType, h.enqueue},
+		{http.MethodGet, joinPaths(h.Path, "/:jobId"), nil, h.status},
+		{http.MethodPost, joinPaths(h.Path, "/:jobId/cancel"), nil, h.cancel},
+	}
+
+	for _, r := range routes {
+		run := r.run
+
+		g.handle(route{
+			endpoint: EndpointInfo{
+				Name:         h.Name,
+				Method:       r.method,
+				Path:         r.path,
+				Summary:      h.Summary,
+				Description:  h.Description,
+				Tags:         h.Tags,
+				Deprecated:   h.Deprecated,
+				ResponseType: Job{},
+				BodyType:     r.bodyType,
+				Security:     h.Security,
+				Errors:       h.Errors,
+			},
+			rateLimit:   h.RateLimit,
+			middlewares: h.Middlewares,
+			run: func(ctx *wrapperContext) error {
+				return run(ctx, pool)
+			},
+		})
+	}
+}
@@ -0,0 +1,389 @@
+package pyrin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const defaultJobRetention = time.Hour
+
+// QueuedJob is a job waiting for a worker of a JobPool
+type QueuedJob struct {
+	Id string
+	// Name is the name of the JobHandler that created the job
+	Name string
+	Run  JobFunc
+}
+
+// JobQueue holds the jobs waiting for a worker, implement it to change the
+// order the jobs are run in
+type JobQueue interface {
+	// Push adds the job to the queue, returns JobQueueFull when the queue
+	// can't take more jobs
+	Push(job *QueuedJob) error
+	// Pop blocks until a job is available, returns the error of ctx when
+	// ctx is done
+	Pop(ctx context.Context) (*QueuedJob, error)
+	// Remove removes a job that hasn't been popped, returns false when the
+	// job isn't in the queue
+	Remove(id string) bool
+}
+
+var _ JobQueue = (*MemoryJobQueue)(nil)
+
+// MemoryJobQueue runs the jobs in the order they were added
+type MemoryJobQueue struct {
+	mu      sync.Mutex
+	jobs    []*QueuedJob
+	maxSize int
+
+	// NOTE(patrik): Wakes one of the workers waiting in Pop, the worker
+	// wakes the next one when there is more jobs
+	notify chan struct{}
+}
+
+// NewMemoryJobQueue creates a queue that holds at most maxSize jobs, 0 is
+// unlimited
+func NewMemoryJobQueue(maxSize int) *MemoryJobQueue {
+	return &MemoryJobQueue{
+		maxSize: maxSize,
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+func (q *MemoryJobQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *MemoryJobQueue) Push(job *QueuedJob) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.maxSize > 0 && len(q.jobs) >= q.maxSize {
+		return JobQueueFull()
+	}
+
+	q.jobs = append(q.jobs, job)
+	q.signal()
+
+	return nil
+}
+
+func (q *MemoryJobQueue) Pop(ctx context.Context) (*QueuedJob, error) {
+	for {
+		q.mu.Lock()
+		if len(q.jobs) > 0 {
+			job := q.jobs[0]
+			q.jobs[0] = nil
+			q.jobs = q.jobs[1:]
+
+			if len(q.jobs) > 0 {
+				q.signal()
+			}
+
+			q.mu.Unlock()
+			return job, nil
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.notify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (q *MemoryJobQueue) Remove(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, job := range q.jobs {
+		if job.Id == id {
+			q.jobs = append(q.jobs[:i], q.jobs[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+type JobPoolConfig struct {
+	// Workers is the number of jobs run at the same time, defaults to the
+	// number of CPUs
+	Workers int
+	// Queue defaults to a MemoryJobQueue without a limit
+	Queue JobQueue
+	// Retention is how long the finished jobs can be read, defaults to 1
+	// hour
+	Retention time.Duration
+	// ErrorCallback is called with the errors of the failed jobs that is
+	// not a *Error
+	ErrorCallback ErrorCallback
+}
+
+type jobEntry struct {
+	job  Job
+	name string
+
+	cancel   context.CancelFunc
+	canceled bool
+}
+
+// JobPool runs the jobs of the JobHandlers in the background, the state of
+// the jobs is kept in memory. The workers are started when the first job
+// is added
+type JobPool struct {
+	workers   int
+	queue     JobQueue
+	retention time.Duration
+	callback  ErrorCallback
+
+	ctx   context.Context
+	stop  context.CancelFunc
+	start sync.Once
+	wg    sync.WaitGroup
+
+	mu        sync.Mutex
+	jobs      map[string]*jobEntry
+	nextSweep time.Time
+}
+
+func NewJobPool(config JobPoolConfig) *JobPool {
+	workers := config.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	queue := config.Queue
+	if queue == nil {
+		queue = NewMemoryJobQueue(0)
+	}
+
+	retention := config.Retention
+	if retention <= 0 {
+		retention = defaultJobRetention
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+
+	return &JobPool{
+		workers:   workers,
+		queue:     queue,
+		retention: retention,
+		callback:  config.ErrorCallback,
+		ctx:       ctx,
+		stop:      stop,
+		jobs:      make(map[string]*jobEntry),
+	}
+}
+
+func (p *JobPool) sweep(now time.Time) {
+	if now.Before(p.nextSweep) {
+		return
+	}
+
+	p.nextSweep = now.Add(time.Minute)
+
+	for id, entry := range p.jobs {
+		finished := entry.job.FinishedAt
+		if finished != nil && now.Sub(*finished) > p.retention {
+			delete(p.jobs, id)
+		}
+	}
+}
+
+// Enqueue adds a job to the queue, name is the name of the JobHandler
+func (p *JobPool) Enqueue(name string, run JobFunc) (Job, error) {
+	p.start.Do(func() {
+		p.wg.Add(p.workers)
+		for range p.workers {
+			go p.worker()
+		}
+	})
+
+	id, err := newRandomId()
+	if err != nil {
+		return Job{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	p.sweep(now)
+
+	entry := &jobEntry{
+		job: Job{
+			Id:        id,
+			State:     JobStatePending,
+			CreatedAt: now,
+		},
+		name: name,
+	}
+
+	// NOTE(patrik): Added before the push so a worker always finds the
+	// job
+	p.jobs[id] = entry
+
+	err = p.queue.Push(&QueuedJob{Id: id, Name: name, Run: run})
+	if err != nil {
+		delete(p.jobs, id)
+		return Job{}, err
+	}
+
+	return entry.job, nil
+}
+
+// Get returns the job, returns JobNotFound when the job doesn't exist or
+// was created by another handler
+func (p *JobPool) Get(name, id string) (Job, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry := p.jobs[id]
+	if entry == nil || entry.name != name {
+		return Job{}, JobNotFound()
+	}
+
+	return entry.job, nil
+}
+
+// Cancel cancels the job, a pending job is removed from the queue and a
+// running job is canceled when the JobFunc returns
+func (p *JobPool) Cancel(name, id string) (Job, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry := p.jobs[id]
+	if entry == nil || entry.name != name {
+		return Job{}, JobNotFound()
+	}
+
+	switch entry.job.State {
+	case JobStatePending:
+		// NOTE(patrik): The job can already be popped by a worker, the
+		// worker skips the jobs that is not pending
+		p.queue.Remove(id)
+
+		now := time.Now()
+		entry.job.State = JobStateCanceled
+		entry.job.Error = JobCanceled()
+		entry.job.FinishedAt = &now
+	case JobStateRunning:
+		entry.canceled = true
+		entry.cancel()
+	default:
+		return Job{}, JobFinished()
+	}
+
+	return entry.job, nil
+}
+
+// Close stops the workers and cancels the running jobs
+func (p *JobPool) Close() {
+	p.stop()
+	p.wg.Wait()
+}
+
+func (p *JobPool) worker() {
+	defer p.wg.Done()
+
+	for {
+		queued, err := p.queue.Pop(p.ctx)
+		if err != nil {
+			if p.ctx.Err() != nil {
+				return
+			}
+
+			if p.callback != nil {
+				p.callback(err)
+			}
+
+			// NOTE(patrik): Backoff so a broken queue doesn't spin
+			select {
+			case <-time.After(time.Second):
+			case <-p.ctx.Done():
+				return
+			}
+
+			continue
+		}
+
+		p.run(queued)
+	}
+}
+
+func (p *JobPool) run(queued *QueuedJob) {
+	p.mu.Lock()
+	entry := p.jobs[queued.Id]
+	if entry == nil || entry.job.State != JobStatePending {
+		p.mu.Unlock()
+		return
+	}
+
+	ctx, cancel := context.WithCancel(p.ctx)
+	defer cancel()
+
+	now := time.Now()
+	entry.cancel = cancel
+	entry.job.State = JobStateRunning
+	entry.job.StartedAt = &now
+	p.mu.Unlock()
+
+	result, err := runJobFunc(ctx, queued.Run)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	finished := time.Now()
+	entry.cancel = nil
+	entry.job.FinishedAt = &finished
+
+	switch {
+	case entry.canceled:
+		entry.job.State = JobStateCanceled
+		entry.job.Error = JobCanceled()
+	case err != nil:
+		entry.job.State = JobStateFailed
+		entry.job.Error = p.jobError(err)
+	default:
+		entry.job.State = JobStateCompleted
+		entry.job.Result = result
+	}
+}
+
+// jobError returns the error sent to the client, the errors that is not a
+// *Error are hidden like the errors of the handlers
+func (p *JobPool) jobError(err error) *Error {
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+
+	if p.callback != nil {
+		p.callback(err)
+	}
+
+	return &Error{
+		Code:    http.StatusInternalServerError,
+		Type:    ErrTypeUnknownError,
+		Message: "Internal Server Error",
+	}
+}
+
+func runJobFunc(ctx context.Context, run JobFunc) (result any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("pyrin: job panicked: %v", r)
+		}
+	}()
+
+	return run(ctx)
+}
@@ -0,0 +1,285 @@
+package pyrin
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// The perPage limits of a PaginationPolicy without limits
+const (
+	DefaultPageLimit    = 20
+	DefaultMaxPageLimit = 100
+)
+
+type PaginationStyle string
+
+const (
+	// PaginationOffset reads the page with the page and perPage query
+	// params
+	PaginationOffset PaginationStyle = "offset"
+	// PaginationCursor reads the page with the cursor and perPage query
+	// params, the cursor is the NextCursor of the previous page
+	PaginationCursor PaginationStyle = "cursor"
+)
+
+// PaginationPolicy marks a ApiHandler as a paginated list, the handler
+// reads the request with ParsePageParams and returns a Page created with
+// NewOffsetPage or NewCursorPage
+type PaginationPolicy struct {
+	// Style defaults to PaginationOffset
+	Style PaginationStyle
+	// DefaultLimit is the perPage used when the request has none, defaults
+	// to 20
+	DefaultLimit int
+	// MaxLimit is the largest perPage allowed, defaults to 100
+	MaxLimit int
+}
+
+func (p *PaginationPolicy) style() PaginationStyle {
+	if p == nil || p.Style == "" {
+		return PaginationOffset
+	}
+
+	return p.Style
+}
+
+func (p *PaginationPolicy) defaultLimit() int {
+	if p == nil || p.DefaultLimit <= 0 {
+		return min(DefaultPageLimit, p.maxLimit())
+	}
+
+	return min(p.DefaultLimit, p.maxLimit())
+}
+
+func (p *PaginationPolicy) maxLimit() int {
+	if p == nil || p.MaxLimit <= 0 {
+		return DefaultMaxPageLimit
+	}
+
+	return p.MaxLimit
+}
+
+// PageParams is the page requested by the client
+type PageParams struct {
+	// Page starts at 1, only used by PaginationOffset
+	Page    int
+	PerPage int
+	// Cursor is empty for the first page, only used by PaginationCursor
+	Cursor string
+}
+
+// Offset returns the number of items before the page
+func (p PageParams) Offset() int {
+	return (p.Page - 1) * p.PerPage
+}
+
+// ParsePageParams reads the page from the query with the PaginationPolicy
+// of the handler, the limits are checked and a ValidationError is
+// returned for the invalid params
+func ParsePageParams(c Context) (PageParams, error) {
+	policy := Endpoint(c).Pagination
+	query := c.Request().URL.Query()
+
+	res := PageParams{
+		Page:    1,
+		PerPage: policy.defaultLimit(),
+	}
+
+	errs := make(map[string]string)
+
+	if s := query.Get("perPage"); s != "" {
+		perPage, err := strconv.Atoi(s)
+		if err != nil || perPage < 1 || perPage > policy.maxLimit() {
+			errs["perPage"] = fmt.Sprintf("must be a number between 1 and %d", policy.maxLimit())
+		} else {
+			res.PerPage = perPage
+		}
+	}
+
+	switch policy.style() {
+	case PaginationOffset:
+		if s := query.Get("page"); s != "" {
+			// NOTE(patrik): Larger pages would overflow Offset
+			maxPage := math.MaxInt/res.PerPage + 1
+
+			page, err := strconv.Atoi(s)
+			if err != nil || page < 1 || page > maxPage {
+				errs["page"] = fmt.Sprintf("must be a number between 1 and %d", maxPage)
+			} else {
+				res.Page = page
+			}
+		}
+	case PaginationCursor:
+		res.Cursor = query.Get("cursor")
+	}
+
+	if len(errs) > 0 {
+		return PageParams{}, ValidationError(errs)
+	}
+
+	return res, nil
+}
+
+// EncodeCursor encodes v as a opaque cursor, use DecodeCursor to read it
+func EncodeCursor(v any) (string, error) {
+	d, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(d), nil
+}
+
+// DecodeCursor decodes a cursor created with EncodeCursor into v, returns a
+// ValidationError when the cursor is invalid
+func DecodeCursor(cursor string, v any) error {
+	invalid := ValidationError(map[string]string{
+		"cursor": "invalid cursor",
+	})
+
+	d, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return invalid
+	}
+
+	err = json.Unmarshal(d, v)
+	if err != nil {
+		return invalid
+	}
+
+	return nil
+}
+
+// Page is the response of a paginated handler, the server sends a Link
+// header with the first, prev, next and last pages
+type Page[T any] struct {
+	Items   []T `json:"items"`
+	PerPage int `json:"perPage"`
+	// Page, TotalItems and TotalPages is only set by NewOffsetPage, they
+	// are sent for every offset page also when the page is empty
+	Page       *int `json:"page,omitempty"`
+	TotalItems *int `json:"totalItems,omitempty"`
+	TotalPages *int `json:"totalPages,omitempty"`
+	// NextCursor is set by NewCursorPage, empty on the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// NewOffsetPage creates the page for params, total is the number of items
+// in the whole list
+func NewOffsetPage[T any](params PageParams, items []T, total int) Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+
+	totalPages := 0
+	if params.PerPage > 0 {
+		totalPages = (total + params.PerPage - 1) / params.PerPage
+	}
+
+	return Page[T]{
+		Items:      items,
+		PerPage:    params.PerPage,
+		Page:       &params.Page,
+		TotalItems: &total,
+		TotalPages: &totalPages,
+	}
+}
+
+// NewCursorPage creates the page for params, next is the cursor of the next
+// page and empty when this is the last page
+func NewCursorPage[T any](params PageParams, items []T, next string) Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+
+	return Page[T]{
+		Items:      items,
+		PerPage:    params.PerPage,
+		NextCursor: next,
+	}
+}
+
+type pageInfo struct {
+	perPage    int
+	page       int
+	totalPages int
+	nextCursor string
+}
+
+type pager interface {
+	pageInfo() pageInfo
+}
+
+func (p Page[T]) pageInfo() pageInfo {
+	res := pageInfo{
+		perPage:    p.PerPage,
+		nextCursor: p.NextCursor,
+	}
+
+	if p.Page != nil {
+		res.page = *p.Page
+	}
+
+	if p.TotalPages != nil {
+		res.totalPages = *p.TotalPages
+	}
+
+	return res
+}
+
+// writePageLinks writes the RFC 8288 Link header of a page, the links keeps
+// the query of the request
+func writePageLinks(w http.ResponseWriter, r *http.Request, info pageInfo) {
+	var links []string
+
+	addLink := func(rel string, set func(q url.Values)) {
+		q := r.URL.Query()
+		q.Set("perPage", strconv.Itoa(info.perPage))
+		set(q)
+
+		links = append(links, fmt.Sprintf("<%s?%s>; rel=%q", r.URL.Path, q.Encode(), rel))
+	}
+
+	setPage := func(page int) func(q url.Values) {
+		return func(q url.Values) {
+			q.Set("page", strconv.Itoa(page))
+		}
+	}
+
+	// NOTE(patrik): Only offset pages has a page number
+	if info.page > 0 {
+		addLink("first", setPage(1))
+
+		if info.page > 1 {
+			addLink("prev", setPage(min(info.page-1, max(info.totalPages, 1))))
+		}
+
+		if info.page < info.totalPages {
+			addLink("next", setPage(info.page+1))
+		}
+
+		if info.totalPages > 0 {
+			addLink("last", setPage(info.totalPages))
+		}
+	} else {
+		addLink("first", func(q url.Values) {
+			q.Del("cursor")
+		})
+
+		if info.nextCursor != "" {
+			addLink("next", func(q url.Values) {
+				q.Set("cursor", info.nextCursor)
+			})
+		}
+	}
+
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
@@ -0,0 +1,398 @@
+package pyrin
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type RateLimitAlgorithm string
+
+const (
+	RateLimitTokenBucket   RateLimitAlgorithm = "tokenBucket"
+	RateLimitSlidingWindow RateLimitAlgorithm = "slidingWindow"
+)
+
+// RateLimitPolicy limits the number of requests a client can make, the
+// policy is added to a handler with the RateLimit field or to a group with
+// Group.With
+type RateLimitPolicy struct {
+	// Name identifies the policy inside the store and the server def
+	Name      string
+	Algorithm RateLimitAlgorithm
+
+	// Limit is the number of requests allowed inside Window
+	Limit  int
+	Window time.Duration
+	// Burst is the size of the bucket for RateLimitTokenBucket, defaults
+	// to Limit
+	Burst int
+
+	// Shared makes all the endpoints using the policy share the same limit,
+	// by default every endpoint has a limit of its own
+	Shared bool
+
+	// KeyFunc returns the key of the client, defaults to the principal of
+	// the request and the IP address when there is no principal. KeyFunc
+	// is required when the principal is not a string, a integer or a
+	// RateLimitKeyer
+	KeyFunc func(c Context) string
+
+	// Store defaults to the store of the server
+	Store RateLimitStore
+}
+
+func (p *RateLimitPolicy) middlewareType() {}
+
+func (p *RateLimitPolicy) validate() error {
+	if p.Limit <= 0 || p.Window <= 0 {
+		return fmt.Errorf("pyrin: rate limit policy %q: limit and window needs to be positive", p.Name)
+	}
+
+	if p.Burst < 0 {
+		return fmt.Errorf("pyrin: rate limit policy %q: burst can't be negative", p.Name)
+	}
+
+	switch p.Algorithm {
+	case "", RateLimitTokenBucket, RateLimitSlidingWindow:
+	default:
+		return fmt.Errorf("pyrin: rate limit policy %q: unknown algorithm %q", p.Name, p.Algorithm)
+	}
+
+	return nil
+}
+
+// quota is the number of requests the policy allows at once, the size of
+// the bucket for RateLimitTokenBucket
+func (p *RateLimitPolicy) quota() int {
+	if p.Algorithm == RateLimitSlidingWindow {
+		return p.Limit
+	}
+
+	return p.burst()
+}
+
+func (p *RateLimitPolicy) burst() int {
+	if p.Burst > 0 {
+		return p.Burst
+	}
+
+	return p.Limit
+}
+
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the limit is fully restored
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, only set
+	// when the request is not allowed
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keeps the state of the limits, implement it to share the
+// limits between multiple servers
+type RateLimitStore interface {
+	// Take uses one request from the limit of the key
+	Take(ctx context.Context, key string, policy *RateLimitPolicy) (RateLimitResult, error)
+}
+
+type rateLimitEntry struct {
+	// NOTE(patrik): Used by RateLimitTokenBucket
+	tokens float64
+	last   time.Time
+
+	// NOTE(patrik): Used by RateLimitSlidingWindow
+	windowStart time.Time
+	current     int
+	previous    int
+
+	expires time.Time
+}
+
+// RateLimitPeeker is implemented by the stores that can read the limit of
+// a key without using a request, the store of ServerConfig.AuthFailureLimit
+// needs to implement it
+type RateLimitPeeker interface {
+	// Peek returns the result a Take would return without using a request
+	Peek(ctx context.Context, key string, policy *RateLimitPolicy) (RateLimitResult, error)
+}
+
+var _ RateLimitStore = (*MemoryRateLimitStore)(nil)
+var _ RateLimitPeeker = (*MemoryRateLimitStore)(nil)
+
+// MemoryRateLimitStore keeps the limits in memory, the limits are not
+// shared between multiple servers
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	entries   map[string]*rateLimitEntry
+	nextSweep time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		entries: make(map[string]*rateLimitEntry),
+	}
+}
+
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, policy *RateLimitPolicy) (RateLimitResult, error) {
+	return s.take(key, policy, true)
+}
+
+func (s *MemoryRateLimitStore) Peek(ctx context.Context, key string, policy *RateLimitPolicy) (RateLimitResult, error) {
+	return s.take(key, policy, false)
+}
+
+// take uses a request from the limit of the key, the entry is left as is
+// when commit is false
+func (s *MemoryRateLimitStore) take(key string, policy *RateLimitPolicy, commit bool) (RateLimitResult, error) {
+	if policy.Limit <= 0 || policy.Window <= 0 {
+		return RateLimitResult{}, fmt.Errorf("rate limit policy %q: limit and window needs to be positive", policy.Name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	entry, exists := s.entries[key]
+	if !exists {
+		entry = &rateLimitEntry{
+			tokens:      float64(policy.burst()),
+			last:        now,
+			windowStart: now.Truncate(policy.Window),
+		}
+	}
+
+	if commit {
+		s.entries[key] = entry
+	} else {
+		copied := *entry
+		entry = &copied
+	}
+
+	var res RateLimitResult
+	switch policy.Algorithm {
+	case RateLimitSlidingWindow:
+		res = takeSlidingWindow(entry, policy, now)
+	default:
+		res = takeTokenBucket(entry, policy, now)
+	}
+
+	entry.expires = now.Add(res.Reset)
+
+	return res, nil
+}
+
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+
+	for key, entry := range s.entries {
+		if now.After(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+
+	s.nextSweep = now.Add(time.Minute)
+}
+
+func takeTokenBucket(entry *rateLimitEntry, policy *RateLimitPolicy, now time.Time) RateLimitResult {
+	capacity := float64(policy.burst())
+	// NOTE(patrik): Tokens per second
+	rate := float64(policy.Limit) / policy.Window.Seconds()
+
+	elapsed := now.Sub(entry.last).Seconds()
+	entry.tokens = math.Min(capacity, entry.tokens+elapsed*rate)
+	entry.last = now
+
+	res := RateLimitResult{
+		Limit: policy.burst(),
+	}
+
+	if entry.tokens >= 1 {
+		entry.tokens -= 1
+		res.Allowed = true
+	} else {
+		res.RetryAfter = secondsToDuration((1 - entry.tokens) / rate)
+	}
+
+	res.Remaining = int(math.Floor(entry.tokens))
+	res.Reset = secondsToDuration((capacity - entry.tokens) / rate)
+
+	return res
+}
+
+// NOTE(patrik): Approximation of the sliding window using the counts of the
+// current and previous fixed windows, the previous count is weighted by how
+// much of the previous window is still inside the sliding window
+func takeSlidingWindow(entry *rateLimitEntry, policy *RateLimitPolicy, now time.Time) RateLimitResult {
+	window := policy.Window
+	limit := policy.Limit
+
+	start := now.Truncate(window)
+	if !start.Equal(entry.windowStart) {
+		if start.Sub(entry.windowStart) == window {
+			entry.previous = entry.current
+		} else {
+			entry.previous = 0
+		}
+
+		entry.current = 0
+		entry.windowStart = start
+	}
+
+	elapsed := now.Sub(start)
+	weight := 1 - elapsed.Seconds()/window.Seconds()
+	estimate := float64(entry.previous)*weight + float64(entry.current)
+
+	res := RateLimitResult{
+		Limit: limit,
+	}
+
+	if estimate+1 <= float64(limit) {
+		entry.current++
+		estimate++
+		res.Allowed = true
+	} else {
+		if entry.current+1 > limit || entry.previous == 0 {
+			res.RetryAfter = window - elapsed
+		} else {
+			// NOTE(patrik): Time until the weight of the previous window
+			// is low enough for one more request
+			target := 1 - float64(limit-entry.current-1)/float64(entry.previous)
+			res.RetryAfter = max(secondsToDuration(target*window.Seconds())-elapsed, 0)
+		}
+	}
+
+	res.Remaining = max(limit-int(math.Ceil(estimate)), 0)
+	// NOTE(patrik): The requests of the current window leaves the sliding
+	// window at the end of the next window
+	res.Reset = window - elapsed
+	if entry.current > 0 {
+		res.Reset += window
+	}
+
+	return res
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// RateLimitKeyer is implemented by the principals that are not a string or
+// a integer, the key needs to be the same for every request of the
+// principal and unique between principals
+type RateLimitKeyer interface {
+	RateLimitKey() string
+}
+
+// principalRateLimitKey returns the key of the principal, other principals
+// than strings, integers and RateLimitKeyers needs a KeyFunc on the policy
+func principalRateLimitKey(principal any) (string, error) {
+	switch p := principal.(type) {
+	case RateLimitKeyer:
+		return p.RateLimitKey(), nil
+	case string:
+		return p, nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(p), nil
+	}
+
+	return "", fmt.Errorf("pyrin: principal of type %T can't be used as a rate limit key, implement RateLimitKeyer or set a KeyFunc on the policy", principal)
+}
+
+func rateLimitClientKey(c Context) (string, error) {
+	if principal := Principal(c); principal != nil {
+		key, err := principalRateLimitKey(principal)
+		if err != nil {
+			return "", err
+		}
+
+		return "principal:" + key, nil
+	}
+
+	addr := c.Request().RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+
+	return "ip:" + addr, nil
+}
+
+func (p *RateLimitPolicy) clientKey(c Context) (string, error) {
+	if p.KeyFunc != nil {
+		return p.KeyFunc(c), nil
+	}
+
+	return rateLimitClientKey(c)
+}
+
+// checkRateLimits takes a request from every policy, the headers are
+// written for the policy with the fewest remaining requests
+func checkRateLimits(ctx *wrapperContext, policies []*RateLimitPolicy, defaultStore RateLimitStore) error {
+	if len(policies) == 0 {
+		return nil
+	}
+
+	var (
+		reported *RateLimitPolicy
+		result   RateLimitResult
+	)
+
+	for _, policy := range policies {
+		store := policy.Store
+		if store == nil {
+			store = defaultStore
+		}
+
+		clientKey, err := policy.clientKey(ctx)
+		if err != nil {
+			return err
+		}
+
+		key := policy.Name + "|"
+		if !policy.Shared {
+			key += ctx.endpoint.Method + " " + ctx.endpoint.Path + "|"
+		}
+		key += clientKey
+
+		res, err := store.Take(ctx.r.Context(), key, policy)
+		if err != nil {
+			return err
+		}
+
+		if reported == nil || !res.Allowed || (result.Allowed && res.Remaining < result.Remaining) {
+			reported = policy
+			result = res
+		}
+
+		if !res.Allowed {
+			break
+		}
+	}
+
+	header := ctx.w.Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("RateLimit-Reset", ceilSeconds(result.Reset))
+	header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", reported.quota(), ceilSeconds(reported.Window)))
+
+	if !result.Allowed {
+		header.Set("Retry-After", ceilSeconds(result.RetryAfter))
+		return RateLimited(result.RetryAfter)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package pyrin
+
+import (
+	"net/http"
+)
+
+// Result can be returned by a ApiHandlerFunc to set the status and the
+// headers of the response, Data is sent in the envelope like the data
+// returned without a Result
+type Result struct {
+	// Status defaults to the Status of the handler
+	Status int
+	Header http.Header
+	Data   any
+}
+
+// Created returns a 201 Created result with the Location header set
+func Created(data any, location string) Result {
+	header := http.Header{}
+	if location != "" {
+		header.Set("Location", location)
+	}
+
+	return Result{
+		Status: http.StatusCreated,
+		Header: header,
+		Data:   data,
+	}
+}
+
+// Accepted returns a 202 Accepted result
+func Accepted(data any) Result {
+	return Result{
+		Status: http.StatusAccepted,
+		Data:   data,
+	}
+}
+
+// NoContent returns a 204 No Content result, the response has no body
+func NoContent() Result {
+	return Result{
+		Status: http.StatusNoContent,
+	}
+}
+
+// resolveResult writes the headers of a Result and returns the status and
+// the data of the response
+func resolveResult(w http.ResponseWriter, status int, data any) (int, any) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	var res *Result
+	switch d := data.(type) {
+	case Result:
+		res = &d
+	case *Result:
+		res = d
+	}
+
+	if res == nil {
+		return status, data
+	}
+
+	header := w.Header()
+	for k, v := range res.Header {
+		header[k] = v
+	}
+
+	if res.Status != 0 {
+		status = res.Status
+	}
+
+	return status, res.Data
+}
+
+func hasResponseBody(status int) bool {
+	return status != http.StatusNoContent
+}
+
+// writeApiResult writes the data returned by a ApiHandlerFunc, status is
+// the default status of the handler
+// resolveApiResult resolves the result and writes the headers of it, the
+// status and the data to send is returned
+func resolveApiResult(ctx *wrapperContext, status int, data any) (int, any) {
+	status, data = resolveResult(ctx.w, status, data)
+
+	if p, ok := data.(pager); ok {
+		writePageLinks(ctx.w, ctx.r, p.pageInfo())
+	}
+
+	return status, data
+}
+
+func writeApiResult(ctx *wrapperContext, status int, data any) {
+	status, data = resolveApiResult(ctx, status, data)
+
+	if !hasResponseBody(status) {
+		ctx.w.WriteHeader(status)
+		return
+	}
+
+	writeSuccess(ctx.w, ctx.r, status, data)
+}
@@ -1,126 +1,526 @@
 package pyrin
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
-	"mime/multipart"
+	"mime"
 	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type serverGroup struct {
-	router       chi.Router
-	errorHandler func(err error, w http.ResponseWriter, r *http.Request)
+	server             *Server
+	prefix             string
+	middlewares        []MiddlewareFunc
+	contextMiddlewares []ContextMiddlewareFunc
+	security           []*SecurityScheme
+	rateLimits         []*RateLimitPolicy
+	meta               map[string]string
 }
 
-func (g *serverGroup) Register(handlers ...Handler) {
-	for _, h := range handlers {
-		switch h := h.(type) {
-		case ApiHandler:
-			handlerFn := func(w http.ResponseWriter, r *http.Request) {
-				ctx := &wrapperContext{
-					w: w,
-					r: r,
-				}
+func (g *serverGroup) Group(prefix string, middlewares ...MiddlewareFunc) Group {
+	mws := make([]MiddlewareFunc, 0, len(g.middlewares)+len(middlewares))
+	mws = append(mws, g.middlewares...)
+	mws = append(mws, middlewares...)
 
-				if h.BodyType != nil {
-					err := ctx.checkContentType(jsonMimeType)
-					if err != nil {
-						g.errorHandler(err, w, r)
-						return
-					}
-				}
+	fullPrefix := joinPaths(g.prefix, prefix)
+	if len(middlewares) > 0 {
+		g.server.registerFallback(fullPrefix, mws)
+	}
 
-				data, err := h.HandlerFunc(ctx)
-				if err != nil {
-					g.errorHandler(err, w, r)
-					return
-				}
+	return &serverGroup{
+		server:             g.server,
+		prefix:             fullPrefix,
+		middlewares:        mws,
+		contextMiddlewares: g.contextMiddlewares,
+		security:           g.security,
+		rateLimits:         g.rateLimits,
+		meta:               g.meta,
+	}
+}
 
-				writeJSON(w, http.StatusOK, SuccessResponse(data))
+func (g *serverGroup) With(middlewares ...Middleware) Group {
+	mws := make([]MiddlewareFunc, 0, len(g.middlewares)+len(middlewares))
+	mws = append(mws, g.middlewares...)
+
+	contextMws := make([]ContextMiddlewareFunc, 0, len(g.contextMiddlewares))
+	contextMws = append(contextMws, g.contextMiddlewares...)
+
+	security := g.security
+
+	rateLimits := make([]*RateLimitPolicy, 0, len(g.rateLimits))
+	rateLimits = append(rateLimits, g.rateLimits...)
+
+	var meta map[string]string
+	if g.meta != nil {
+		meta = make(map[string]string, len(g.meta))
+		for k, v := range g.meta {
+			meta[k] = v
+		}
+	}
+
+	for _, m := range middlewares {
+		switch m := m.(type) {
+		case MiddlewareFunc:
+			mws = append(mws, m)
+		case ContextMiddlewareFunc:
+			contextMws = append(contextMws, m)
+		case MetaMiddleware:
+			if meta == nil {
+				meta = make(map[string]string, len(m.Meta))
 			}
 
-			var handler http.Handler = http.HandlerFunc(handlerFn)
-			for i := len(h.Middlewares) - 1; i >= 0; i-- {
-				handler = h.Middlewares[i](handler)
+			for k, v := range m.Meta {
+				meta[k] = v
 			}
 
-			g.router.Method(h.Method, convertPath(h.Path), handler)
+			if m.Middleware != nil {
+				mws = append(mws, m.Middleware)
+			}
+		case SecurityMiddleware:
+			security = m.Schemes
+		case *RateLimitPolicy:
+			rateLimits = append(rateLimits, m)
+		}
+	}
 
-		case FormApiHandler:
-			handlerFn := func(w http.ResponseWriter, r *http.Request) {
-				ctx := &wrapperContext{
-					w:        w,
-					r:        r,
-					formSpec: &h.Spec,
-				}
+	return &serverGroup{
+		server:             g.server,
+		prefix:             g.prefix,
+		middlewares:        mws,
+		contextMiddlewares: contextMws,
+		security:           security,
+		rateLimits:         rateLimits,
+		meta:               meta,
+	}
+}
 
-				err := ctx.checkContentType(multipartFormMimeType)
-				if err != nil {
-					g.errorHandler(err, w, r)
-					return
-				}
+func (g *serverGroup) errorHandler(err error, w http.ResponseWriter, r *http.Request) {
+	g.server.errorHandler(err, w, r)
+}
 
-				err = r.ParseMultipartForm(defaultMemory)
-				if err != nil {
-					g.errorHandler(err, w, r)
-					return
-				}
+// route is the part of a handler that is shared by all the handler types
+type route struct {
+	endpoint    EndpointInfo
+	rateLimit   *RateLimitPolicy
+	middlewares []MiddlewareFunc
+	formSpec    *FormSpec
 
-				err = validateForm(ctx.formSpec, r.MultipartForm)
-				if err != nil {
-					g.errorHandler(err, w, r)
-					return
-				}
+	run func(ctx *wrapperContext) error
+}
 
-				data, err := h.HandlerFunc(ctx)
-				if err != nil {
-					g.errorHandler(err, w, r)
-					return
-				}
+func (g *serverGroup) handle(rt route) {
+	endpoint := rt.endpoint
+	endpoint.Path = joinPaths(g.prefix, endpoint.Path)
+	endpoint.Meta = g.meta
+	if endpoint.Security == nil {
+		endpoint.Security = g.security
+	}
+
+	endpoint.RateLimits = g.rateLimits
+	if rt.rateLimit != nil {
+		endpoint.RateLimits = append(slices.Clip(endpoint.RateLimits), rt.rateLimit)
+	}
 
-				writeJSON(w, http.StatusOK, SuccessResponse(data))
+	// NOTE(patrik): Invalid policies would fail every request so they are
+	// rejected when the handler is registered
+	for _, policy := range endpoint.RateLimits {
+		err := policy.validate()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	contextMiddlewares := g.contextMiddlewares
+
+	handlerFn := func(w http.ResponseWriter, r *http.Request) {
+		if endpoint.Deprecated != nil {
+			writeDeprecationHeaders(w, endpoint.Deprecated)
+		}
+
+		ctx := &wrapperContext{
+			w:        w,
+			r:        r,
+			endpoint: &endpoint,
+			formSpec: rt.formSpec,
+		}
+
+		limitFailures := len(endpoint.Security) > 0 && g.server.authFailureLimit != nil
+		if limitFailures {
+			err := g.server.checkAuthFailures(ctx)
+			if err != nil {
+				g.errorHandler(err, w, ctx.r)
+				return
 			}
+		}
 
-			var handler http.Handler = http.HandlerFunc(handlerFn)
-			for i := len(h.Middlewares) - 1; i >= 0; i-- {
-				handler = h.Middlewares[i](handler)
+		err := authenticate(ctx, endpoint.Security)
+		if err != nil {
+			if limitFailures {
+				if ferr := g.server.recordAuthFailure(ctx); ferr != nil {
+					err = ferr
+				}
 			}
 
-			g.router.Method(h.Method, convertPath(h.Path), handler)
+			g.errorHandler(err, w, ctx.r)
+			return
+		}
 
-		case NormalHandler:
-			handlerFn := func(w http.ResponseWriter, r *http.Request) {
-				ctx := &wrapperContext{
-					w: w,
-					r: r,
-				}
+		err = checkRateLimits(ctx, endpoint.RateLimits, g.server.rateLimitStore)
+		if err != nil {
+			g.errorHandler(err, w, ctx.r)
+			return
+		}
+
+		err = runContextMiddlewares(ctx, contextMiddlewares, rt.run)
+		if err != nil {
+			g.errorHandler(err, w, ctx.r)
+			return
+		}
+	}
+
+	var handler http.Handler = http.HandlerFunc(handlerFn)
+	handler = applyMiddlewares(handler, rt.middlewares)
+	handler = applyMiddlewares(handler, g.middlewares)
+
+	g.server.register(endpoint.Method, convertPath(endpoint.Path), handler)
+}
+
+func runContextMiddlewares(ctx *wrapperContext, middlewares []ContextMiddlewareFunc, run func(ctx *wrapperContext) error) error {
+	if len(middlewares) == 0 {
+		return run(ctx)
+	}
+
+	return middlewares[0](ctx, func() error {
+		return runContextMiddlewares(ctx, middlewares[1:], run)
+	})
+}
+
+func applyMiddlewares(handler http.Handler, middlewares []MiddlewareFunc) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	return handler
+}
 
-				err := h.HandlerFunc(ctx)
+func (g *serverGroup) Register(handlers ...Handler) {
+	for _, h := range handlers {
+		switch h := h.(type) {
+		case ApiHandler:
+			// NOTE(patrik): Checked here so a invalid schema fails when the
+			// server starts and not only when the clients is generated
+			if h.Filter != nil {
+				err := h.Filter.Validate()
 				if err != nil {
-					g.errorHandler(err, w, r)
-					return
+					panic(fmt.Sprintf("pyrin: %s has a invalid filter: %v", h.Name, err))
 				}
 			}
 
-			var handler http.Handler = http.HandlerFunc(handlerFn)
-			for i := len(h.Middlewares) - 1; i >= 0; i-- {
-				handler = h.Middlewares[i](handler)
-			}
+			g.handle(route{
+				endpoint: EndpointInfo{
+					Name:         h.Name,
+					Method:       h.Method,
+					Path:         h.Path,
+					Summary:      h.Summary,
+					Description:  h.Description,
+					Tags:         h.Tags,
+					Deprecated:   h.Deprecated,
+					ResponseType: h.ResponseType,
+					BodyType:     h.BodyType,
+					Security:     h.Security,
+					Errors:       h.Errors,
+					Pagination:   h.Pagination,
+					Filter:       h.Filter,
+				},
+				rateLimit:   h.RateLimit,
+				middlewares: h.Middlewares,
+				run: func(ctx *wrapperContext) error {
+					if h.BodyType != nil {
+						err := ctx.checkBodyCodec()
+						if err != nil {
+							return err
+						}
+					}
+
+					if h.Idempotency != nil {
+						return runIdempotent(ctx, h.Idempotency, g.server.idempotencyStore, h.Status, h.HandlerFunc)
+					}
+
+					if h.Cache != nil && (ctx.r.Method == http.MethodGet || ctx.r.Method == http.MethodHead) {
+						return runCached(ctx, h.Cache, h.Status, h.HandlerFunc)
+					}
+
+					data, err := h.HandlerFunc(ctx)
+					if err != nil {
+						return err
+					}
 
-			g.router.Method(h.Method, convertPath(h.Path), handler)
+					writeApiResult(ctx, h.Status, data)
+
+					return nil
+				},
+			})
+
+		case FormApiHandler:
+			g.handle(route{
+				endpoint: EndpointInfo{
+					Name:         h.Name,
+					Method:       h.Method,
+					Path:         h.Path,
+					Summary:      h.Summary,
+					Description:  h.Description,
+					Tags:         h.Tags,
+					Deprecated:   h.Deprecated,
+					ResponseType: h.ResponseType,
+					BodyType:     h.Spec.BodyType,
+					Security:     h.Security,
+					Errors:       h.Errors,
+				},
+				rateLimit:   h.RateLimit,
+				middlewares: h.Middlewares,
+				formSpec:    &h.Spec,
+				run: func(ctx *wrapperContext) error {
+					err := ctx.checkContentType(multipartFormMimeType)
+					if err != nil {
+						return err
+					}
+
+					if h.Streaming {
+						ctx.formStream, err = newFormPartReader(ctx.r, ctx.formSpec)
+						if err != nil {
+							return err
+						}
+					} else {
+						// NOTE(patrik): ParseMultipartForm writes the whole
+						// form to disk before it's validated, the body is
+						// limited so a large form is rejected while it's read
+						if ctx.formSpec.MaxTotalSize > 0 {
+							ctx.r.Body = http.MaxBytesReader(ctx.w, ctx.r.Body, ctx.formSpec.MaxTotalSize+defaultMemory)
+						}
+
+						err = ctx.r.ParseMultipartForm(defaultMemory)
+						if err != nil {
+							var maxErr *http.MaxBytesError
+							if errors.As(err, &maxErr) {
+								return formTooLargeError(ctx.formSpec)
+							}
+
+							return err
+						}
+
+						err = validateForm(ctx.formSpec, ctx.r.MultipartForm)
+						if err != nil {
+							return err
+						}
+					}
+
+					data, err := h.HandlerFunc(ctx)
+					if err != nil {
+						return err
+					}
+
+					if ctx.formStream != nil {
+						err = ctx.formStream.drain()
+						if err != nil {
+							return err
+						}
+					}
+
+					writeApiResult(ctx, h.Status, data)
+
+					return nil
+				},
+			})
+
+		case UploadHandler:
+			g.handleUpload(h)
+
+		case JobHandler:
+			g.handleJob(h)
+
+		case DownloadHandler:
+			digests := newDigestCache()
+
+			g.handle(route{
+				endpoint: EndpointInfo{
+					Name:        h.Name,
+					Method:      h.Method,
+					Path:        h.Path,
+					Summary:     h.Summary,
+					Description: h.Description,
+					Tags:        h.Tags,
+					Deprecated:  h.Deprecated,
+					Security:    h.Security,
+					Errors:      h.Errors,
+				},
+				rateLimit:   h.RateLimit,
+				middlewares: h.Middlewares,
+				run: func(ctx *wrapperContext) error {
+					d, err := h.HandlerFunc(ctx)
+					if err != nil {
+						return err
+					}
+
+					if d == nil {
+						return FileNotFound()
+					}
+
+					return h.serveDownload(ctx, d, digests)
+				},
+			})
+
+		case NormalHandler:
+			g.handle(route{
+				endpoint: EndpointInfo{
+					Name:        h.Name,
+					Method:      h.Method,
+					Path:        h.Path,
+					Summary:     h.Summary,
+					Description: h.Description,
+					Tags:        h.Tags,
+					Deprecated:  h.Deprecated,
+					Security:    h.Security,
+				},
+				rateLimit:   h.RateLimit,
+				middlewares: h.Middlewares,
+				run: func(ctx *wrapperContext) error {
+					return h.HandlerFunc(ctx)
+				},
+			})
 		}
 	}
 }
 
 type Server struct {
-	mux          *chi.Mux
-	errorHandler func(err error, w http.ResponseWriter, r *http.Request)
+	mux           *chi.Mux
+	errorHandler  func(err error, w http.ResponseWriter, r *http.Request)
+	errorCallback ErrorCallback
+
+	// NOTE(patrik): The methods used by the registered handlers, used to
+	// find the allowed methods of a path
+	methods      map[string]bool
+	explicitHead map[string]bool
+	// NOTE(patrik): The catch-all patterns of the groups, they answers the
+	// unmatched requests and is not counted as allowed methods
+	fallbacks map[string]bool
+
+	rateLimitStore   RateLimitStore
+	authFailureLimit *RateLimitPolicy
+	authFailureStore RateLimitStore
+	idempotencyStore IdempotencyStore
+	uploadStore      UploadStore
+	jobPool          *JobPool
+}
+
+func (s *Server) register(method, pattern string, handler http.Handler) {
+	s.methods[method] = true
+	s.mux.Method(method, pattern, handler)
+
+	switch method {
+	case http.MethodHead:
+		s.explicitHead[pattern] = true
+	case http.MethodGet:
+		// NOTE(patrik): GET handlers also answers HEAD requests unless the
+		// path has a HEAD handler of its own
+		if !s.explicitHead[pattern] {
+			s.methods[http.MethodHead] = true
+			s.mux.Method(http.MethodHead, pattern, headHandler(handler))
+		}
+	}
+}
+
+// registerFallback makes the unmatched requests below prefix go through the
+// middlewares of the group, e.g. so CORS and logging also runs for 404, 405
+// and OPTIONS. The first group with middlewares on a prefix owns it
+func (s *Server) registerFallback(prefix string, middlewares []MiddlewareFunc) {
+	pattern := joinPaths(prefix, "*")
+	if s.fallbacks[pattern] {
+		return
+	}
+
+	s.fallbacks[pattern] = true
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(s.allowedMethods(r)) > 0 {
+			s.methodNotAllowed(w, r)
+			return
+		}
+
+		s.notFound(w, r)
+	})
+
+	s.mux.Handle(pattern, applyMiddlewares(handler, middlewares))
+}
+
+func (s *Server) notFound(w http.ResponseWriter, r *http.Request) {
+	s.errorHandler(RouteNotFound(), w, r)
+}
+
+func (s *Server) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", s.allowHeader(r))
+
+	if r.Method == http.MethodOptions {
+		writeSuccess(w, r, http.StatusOK, nil)
+		return
+	}
+
+	s.errorHandler(MethodNotAllowed(), w, r)
+}
+
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w *headResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func headHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&headResponseWriter{ResponseWriter: w}, r)
+	})
+}
+
+// allowHeader returns the value for the Allow header, OPTIONS is always
+// allowed because the server answers it for every registered path
+func (s *Server) allowHeader(r *http.Request) string {
+	methods := s.allowedMethods(r)
+	if !slices.Contains(methods, http.MethodOptions) {
+		methods = append(methods, http.MethodOptions)
+	}
+
+	return strings.Join(methods, ", ")
+}
+
+// allowedMethods returns the methods registered on the path of the request
+func (s *Server) allowedMethods(r *http.Request) []string {
+	path := r.URL.RawPath
+	if path == "" {
+		path = r.URL.Path
+	}
+
+	var res []string
+	for method := range s.methods {
+		rctx := chi.NewRouteContext()
+		if s.mux.Match(rctx, method, path) && !s.fallbacks[rctx.RoutePattern()] {
+			res = append(res, method)
+		}
+	}
+
+	sort.Strings(res)
+
+	return res
 }
 
 type ErrorCallback func(err error)
@@ -132,7 +532,7 @@ func errorHandler(err error, w http.ResponseWriter, r *http.Request, errorCallba
 			errorCallback(e)
 		}
 
-		writeJSON(w, e.Code, ErrorResponse(*e))
+		writeError(w, r, *e)
 	case *NoContentError:
 		w.WriteHeader(e.Code)
 	default:
@@ -140,11 +540,11 @@ func errorHandler(err error, w http.ResponseWriter, r *http.Request, errorCallba
 			errorCallback(e)
 		}
 
-		writeJSON(w, http.StatusInternalServerError, ErrorResponse(Error{
+		writeError(w, r, Error{
 			Code:    http.StatusInternalServerError,
 			Type:    ErrTypeUnknownError,
 			Message: "Internal Server Error",
-		}))
+		})
 	}
 }
 
@@ -152,6 +552,37 @@ type ServerConfig struct {
 	RegisterHandlers func(router Router)
 	ErrorCallback    ErrorCallback
 	Middlewares      []MiddlewareFunc
+	// Cors enables CORS, nil disables it. NewServer panics when the config
+	// is invalid
+	Cors *CorsConfig
+	// RateLimitStore is used by the rate limit policies without a store,
+	// defaults to a MemoryRateLimitStore
+	RateLimitStore RateLimitStore
+	// AuthFailureLimit limits the failed authentications of a client on
+	// the secured endpoints, the requests with valid credentials is not
+	// counted. The limit is shared by all the endpoints and the KeyFunc is
+	// called without a principal, it defaults to the IP address. The store
+	// needs to implement RateLimitPeeker, nil disables the limit
+	AuthFailureLimit *RateLimitPolicy
+	// IdempotencyStore is used by the idempotency policies without a
+	// store, defaults to a MemoryIdempotencyStore
+	IdempotencyStore IdempotencyStore
+	// UploadStore is used by the UploadHandlers without a store, defaults
+	// to a FileUploadStore in the temporary directory
+	UploadStore UploadStore
+	// JobPool runs the jobs of the JobHandlers without a pool, defaults to
+	// a JobPool with a worker for every CPU
+	JobPool *JobPool
+	// Compression enables compression of the responses, nil disables it
+	Compression *CompressionConfig
+	// Codecs is the encodings the ApiHandlers can use in addition to JSON,
+	// e.g. MsgPackCodec and CBORCodec. JSON is used when the client doesn't
+	// ask for another encoding
+	Codecs []Codec
+	// Envelope is the shape of the responses of the ApiHandlers, defaults
+	// to DefaultEnvelope. The same envelope needs to be set on the
+	// spark.Router so the generated clients can read the responses
+	Envelope Envelope
 }
 
 func NewServer(config *ServerConfig) *Server {
@@ -161,18 +592,99 @@ func NewServer(config *ServerConfig) *Server {
 		errorHandler(err, w, r, config.ErrorCallback)
 	}
 
-	mux.NotFound(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		errHandler(RouteNotFound(), w, r)
-	}))
+	s := &Server{
+		mux:           mux,
+		errorHandler:  errHandler,
+		errorCallback: config.ErrorCallback,
+		methods:       map[string]bool{},
+		explicitHead:  map[string]bool{},
+		fallbacks:     map[string]bool{},
+
+		rateLimitStore:   config.RateLimitStore,
+		idempotencyStore: config.IdempotencyStore,
+		uploadStore:      config.UploadStore,
+		jobPool:          config.JobPool,
+	}
+
+	if s.rateLimitStore == nil {
+		s.rateLimitStore = NewMemoryRateLimitStore()
+	}
+
+	if config.AuthFailureLimit != nil {
+		err := config.AuthFailureLimit.validate()
+		if err != nil {
+			panic(err)
+		}
+
+		store := config.AuthFailureLimit.Store
+		if store == nil {
+			store = s.rateLimitStore
+		}
+
+		if _, ok := store.(RateLimitPeeker); !ok {
+			panic(fmt.Sprintf("pyrin: the store of AuthFailureLimit %q needs to implement RateLimitPeeker", config.AuthFailureLimit.Name))
+		}
+
+		s.authFailureLimit = config.AuthFailureLimit
+		s.authFailureStore = store
+	}
+
+	if s.idempotencyStore == nil {
+		s.idempotencyStore = NewMemoryIdempotencyStore()
+	}
+
+	if s.uploadStore == nil {
+		s.uploadStore = NewFileUploadStore(filepath.Join(os.TempDir(), "pyrin-uploads"))
+	}
+
+	if s.jobPool == nil {
+		s.jobPool = NewJobPool(JobPoolConfig{
+			ErrorCallback: config.ErrorCallback,
+		})
+	}
+
+	codecs := createCodecs(config.Codecs)
+
+	envelope := config.Envelope
+	if envelope == nil {
+		envelope = DefaultEnvelope{}
+	}
+
+	mux.NotFound(http.HandlerFunc(s.notFound))
+	mux.MethodNotAllowed(http.HandlerFunc(s.methodNotAllowed))
+
+	// NOTE(patrik): Added first so every middleware can use the values of
+	// the request and WriteError
+	mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			store := &requestStore{
+				errorHandler: errHandler,
+				codecs:       codecs,
+				envelope:     envelope,
+			}
+
+			next.ServeHTTP(w, withRequestStore(r, store))
+		})
+	})
+
+	if config.Compression != nil {
+		mux.Use(compressMiddleware(config.Compression))
+	}
+
+	if config.Cors != nil {
+		err := config.Cors.validate()
+		if err != nil {
+			panic(err)
+		}
+
+		mux.Use(s.corsMiddleware(config.Cors))
+	}
 
 	for _, m := range config.Middlewares {
 		mux.Use(m)
 	}
 
-	return &Server{
-		mux:          mux,
-		errorHandler: errHandler,
-	}
+	return s
 }
 
 func (s *Server) Start(addr string) error {
@@ -183,47 +695,33 @@ func (s *Server) Group(
 	prefix string,
 	middlewares ...MiddlewareFunc,
 ) Group {
-	sub := chi.NewRouter()
-
-	for _, middleware := range middlewares {
-		sub.Use(middleware)
+	if len(middlewares) > 0 {
+		s.registerFallback(prefix, middlewares)
 	}
 
-	s.mux.Mount(prefix, sub)
-
 	return &serverGroup{
-		router:       sub,
-		errorHandler: s.errorHandler,
+		server:      s,
+		prefix:      prefix,
+		middlewares: middlewares,
 	}
 }
 
-func validateForm(spec *FormSpec, form *multipart.Form) error {
-	extra := make(map[string]string)
-
-	if spec.BodyType != nil {
-		data, exists := form.Value[formBodyKey]
-		if !exists && len(data) < 1 {
-			extra[formBodyKey] = "contains no data"
-		}
-	}
-
-	for field, spec := range spec.Files {
-		files := form.File[field]
-		if len(files) < spec.NumExpected {
-			extra[field] = fmt.Sprintf(
-				"expected %d or more files, got %d",
-				spec.NumExpected,
-				len(files),
-			)
-			continue
-		}
+func writeDeprecationHeaders(w http.ResponseWriter, d *Deprecation) {
+	// NOTE(patrik): RFC 9745 wants the date of the deprecation, fallback
+	// to the older "true" value when no date is set
+	if d.Since.IsZero() {
+		w.Header().Set("Deprecation", "true")
+	} else {
+		w.Header().Set("Deprecation", "@"+strconv.FormatInt(d.Since.Unix(), 10))
 	}
 
-	if len(extra) > 0 {
-		return FormValidationError(extra)
+	if !d.Sunset.IsZero() {
+		w.Header().Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
 	}
+}
 
-	return nil
+func joinPaths(prefix, path string) string {
+	return strings.TrimRight(prefix, "/") + "/" + strings.TrimLeft(path, "/")
 }
 
 func convertPath(path string) string {
@@ -249,12 +747,6 @@ func convertPath(path string) string {
 	return b.String()
 }
 
-func writeJSON(w http.ResponseWriter, code int, data any) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(data)
-}
-
 type hookedResponseWriter struct {
 	http.ResponseWriter
 	got404 bool
@@ -281,6 +773,18 @@ func SpaHandler(root fs.FS, indexFilename string) Handler {
 		Method: http.MethodGet,
 		Path:   "/*",
 		HandlerFunc: func(c Context) error {
+			name := strings.TrimPrefix(path.Clean(c.Request().URL.Path), "/")
+			if name != "" {
+				served, err := servePrecompressed(c, root, name)
+				if err != nil {
+					return err
+				}
+
+				if served {
+					return nil
+				}
+			}
+
 			fs := http.FileServer(http.FS(root))
 
 			hookedWriter := &hookedResponseWriter{ResponseWriter: c.Response()}
@@ -302,7 +806,72 @@ func SpaHandler(root fs.FS, indexFilename string) Handler {
 	}
 }
 
+// servePrecompressed serves a precompressed sibling of the file, e.g.
+// "app.js.br" or "app.js.gz", when the client accepts the encoding. Returns
+// false when the file has no sibling the client accepts
+func servePrecompressed(c Context, filesystem fs.FS, file string) (bool, error) {
+	fi, err := fs.Stat(filesystem, file)
+	if err != nil || fi.IsDir() {
+		return false, nil
+	}
+
+	var available []string
+	exts := make(map[string]string)
+	for _, p := range precompressedEncodings {
+		if _, err := fs.Stat(filesystem, file+p.ext); err == nil {
+			available = append(available, p.encoding)
+			exts[p.encoding] = p.ext
+		}
+	}
+
+	if len(available) == 0 {
+		return false, nil
+	}
+
+	header := c.Response().Header()
+	addVary(header, "Accept-Encoding")
+
+	encoding := negotiateEncoding(c.Request().Header.Get("Accept-Encoding"), available)
+	if encoding == "" {
+		return false, nil
+	}
+
+	f, err := filesystem.Open(file + exts[encoding])
+	if err != nil {
+		return false, nil
+	}
+	defer f.Close()
+
+	ff, ok := f.(io.ReadSeeker)
+	if !ok {
+		return false, errors.New("file does not implement io.ReadSeeker")
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(file))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Encoding", encoding)
+
+	http.ServeContent(c.Response(), c.Request(), fi.Name(), fi.ModTime(), ff)
+
+	return true, nil
+}
+
+// ServeFile serves the file from the filesystem, a precompressed sibling of
+// the file is served instead when the client accepts the encoding
 func ServeFile(c Context, filesystem fs.FS, file string) error {
+	served, err := servePrecompressed(c, filesystem, file)
+	if err != nil {
+		return err
+	}
+
+	if served {
+		return nil
+	}
+
 	f, err := filesystem.Open(file)
 	if err != nil {
 		return NoContentNotFound()
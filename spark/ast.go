@@ -27,13 +27,16 @@ func (ty *PtrTypespec) typespecType()   {}
 func (ty *MapTypespec) typespecType()   {}
 
 type FieldDecl struct {
-	Name      string
-	Type      Typespec
-	OmitEmpty bool
+	Name     string
+	Type     Typespec
+	Optional bool
+	Nullable bool
+	Doc      string
 }
 
 type StructDecl struct {
 	Name   string
 	Extend string
+	Doc    string
 	Fields []*FieldDecl
 }
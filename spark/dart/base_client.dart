@@ -1,16 +1,24 @@
+import 'dart:async';
 import 'dart:convert';
+import 'dart:math';
+import 'dart:typed_data';
 
+import 'package:crypto/crypto.dart';
 import 'package:result_dart/result_dart.dart';
 import 'package:dio/dio.dart';
 
 typedef FormDataType = FormData;
 
 class ApiError {
-  const ApiError(this.type, this.code, this.message);
+  const ApiError(this.type, this.code, this.message, {this.extra});
 
   final String type;
   final int code;
   final String message;
+
+  /// Extra data of the error, e.g. the messages of the fields for
+  /// FORM_VALIDATION_ERROR
+  final dynamic extra;
 }
 
 class NoBody {}
@@ -22,6 +30,379 @@ class RequestOptions {
   RequestOptions({this.query, this.headers});
 }
 
+/// Builds the multipart form of a form endpoint, the body is sent as JSON in
+/// the "body" field before the files
+FormData createFormData(
+  Map<String, dynamic>? body,
+  Map<String, List<MultipartFile>> files,
+) {
+  final form = FormData();
+
+  if (body != null) {
+    form.fields.add(MapEntry("body", jsonEncode(body)));
+  }
+
+  for (final entry in files.entries) {
+    for (final file in entry.value) {
+      form.files.add(MapEntry(entry.key, file));
+    }
+  }
+
+  return form;
+}
+
+class FormFileSpec {
+  const FormFileSpec(
+    this.name, {
+    this.minFiles = 0,
+    this.optional = false,
+    this.maxFiles = 0,
+    this.maxFileSize = 0,
+    this.allowedMimeTypes = const [],
+  });
+
+  final String name;
+  final int minFiles;
+  final bool optional;
+  final int maxFiles;
+  final int maxFileSize;
+  final List<String> allowedMimeTypes;
+}
+
+/// Constraints of a form endpoint, the files are checked before the request
+/// is sent
+class FormSpec {
+  const FormSpec({this.maxTotalSize = 0, this.files = const []});
+
+  final int maxTotalSize;
+  final List<FormFileSpec> files;
+}
+
+bool _mimeTypeAllowed(List<String> allowed, String mimeType) {
+  return allowed.any((a) {
+    a = a.toLowerCase();
+    return a == mimeType ||
+        a == "*/*" ||
+        (a.endsWith("/*") &&
+            mimeType.startsWith(a.substring(0, a.length - 1)));
+  });
+}
+
+String? _validateFormFiles(FormFileSpec spec, List<MultipartFile> files) {
+  if (files.isEmpty && spec.optional) {
+    return null;
+  }
+
+  if (files.length < spec.minFiles) {
+    return "expected ${spec.minFiles} or more files, got ${files.length}";
+  }
+
+  if (spec.maxFiles > 0 && files.length > spec.maxFiles) {
+    return "expected at most ${spec.maxFiles} files, got ${files.length}";
+  }
+
+  for (final file in files) {
+    if (spec.maxFileSize > 0 && file.length > spec.maxFileSize) {
+      return "file \"${file.filename}\" is larger than ${spec.maxFileSize} bytes";
+    }
+
+    // NOTE: The type is the content type of the MultipartFile, the server
+    // checks the content of the file
+    final mimeType =
+        file.contentType?.mimeType.toLowerCase() ?? "application/octet-stream";
+    if (spec.allowedMimeTypes.isNotEmpty &&
+        !_mimeTypeAllowed(spec.allowedMimeTypes, mimeType)) {
+      return "file \"${file.filename}\" has type \"$mimeType\", expected one of: ${spec.allowedMimeTypes.join(", ")}";
+    }
+  }
+
+  return null;
+}
+
+/// Checks the files of the form against the spec, returns the same
+/// FORM_VALIDATION_ERROR as the server when the form is invalid
+ApiError? validateFormData(FormData body, FormSpec spec) {
+  final extra = <String, String>{};
+
+  var total = 0;
+  for (final fileSpec in spec.files) {
+    final files = body.files
+        .where((e) => e.key == fileSpec.name)
+        .map((e) => e.value)
+        .toList();
+
+    final msg = _validateFormFiles(fileSpec, files);
+    if (msg != null) {
+      extra[fileSpec.name] = msg;
+      continue;
+    }
+
+    for (final file in files) {
+      total += file.length;
+    }
+
+    if (spec.maxTotalSize > 0 && total > spec.maxTotalSize) {
+      extra[fileSpec.name] =
+          "total size of the files is larger than ${spec.maxTotalSize} bytes";
+    }
+  }
+
+  if (extra.isEmpty) {
+    return null;
+  }
+
+  return ApiError(
+    "FORM_VALIDATION_ERROR",
+    400,
+    "Form Validation error",
+    extra: extra,
+  );
+}
+
+/// File from a download endpoint, the content is read from [stream]
+class DownloadResponse {
+  const DownloadResponse(
+    this.stream, {
+    this.statusCode = 200,
+    this.contentType,
+    this.filename,
+    this.size,
+    this.digest,
+  });
+
+  final Stream<Uint8List> stream;
+  final int statusCode;
+  final String? contentType;
+  final String? filename;
+  final int? size;
+
+  /// SHA-256 of the whole file from the Repr-Digest header as base64
+  final String? digest;
+}
+
+/// Returns the filename from a Content-Disposition header, the RFC 5987
+/// "filename*" parameter is used when the server sent it
+String? parseContentDispositionFilename(String? header) {
+  if (header == null) {
+    return null;
+  }
+
+  final extended = RegExp(
+    r"filename\*\s*=\s*[^']*'[^']*'([^;]+)",
+    caseSensitive: false,
+  ).firstMatch(header);
+  if (extended != null) {
+    try {
+      return Uri.decodeComponent(extended.group(1)!.trim());
+    } catch (_) {
+      // NOTE: Fallback to the plain filename
+    }
+  }
+
+  final plain = RegExp(
+    r'filename\s*=\s*(?:"((?:\\.|[^"\\])*)"|([^;]+))',
+    caseSensitive: false,
+  ).firstMatch(header);
+  if (plain != null) {
+    final quoted = plain.group(1);
+    if (quoted != null) {
+      return quoted.replaceAllMapped(RegExp(r"\\(.)"), (m) => m.group(1)!);
+    }
+
+    return plain.group(2)!.trim();
+  }
+
+  return null;
+}
+
+/// Reads [length] bytes of the file at [offset]
+typedef UploadChunkReader = Future<Uint8List> Function(int offset, int length);
+
+class UploadOptions {
+  const UploadOptions({
+    this.chunkSize = 8 * 1024 * 1024,
+    this.metadata = const {},
+    this.retries = 3,
+    this.uploadUrl,
+    this.onCreated,
+    this.onProgress,
+  });
+
+  final int chunkSize;
+
+  /// Sent with the upload, e.g. the filename
+  final Map<String, String> metadata;
+
+  /// Number of times a chunk is retried after a failure
+  final int retries;
+
+  /// Continues an existing upload instead of creating a new one
+  final String? uploadUrl;
+
+  /// Called with the url of the new upload, store it to continue the upload
+  /// later with [uploadUrl]
+  final void Function(String uploadUrl)? onCreated;
+
+  /// Called after every chunk
+  final void Function(int offset, int length)? onProgress;
+}
+
+/// Encodes the metadata as the Upload-Metadata header, the values are base64
+/// encoded UTF-8
+String _encodeUploadMetadata(Map<String, String> metadata) {
+  final keys = metadata.keys.toList()..sort();
+  return keys
+      .map((key) => "$key ${base64.encode(utf8.encode(metadata[key]!))}")
+      .join(",");
+}
+
+/// Returns true when the chunk can be sent again after the offset has been
+/// read from the server
+bool _retryableUploadError(ApiError error) {
+  switch (error.code) {
+    case 409:
+    case 423:
+      return error.type != "UPLOAD_INCOMPLETE";
+    case 400:
+      return error.type == "UPLOAD_CHECKSUM_MISMATCH";
+  }
+
+  return error.code >= 500;
+}
+
+/// Background job of a job endpoint, [result] is set when the job is
+/// completed and [error] when the job is failed or canceled
+class Job<T> {
+  const Job(
+    this.id,
+    this.state, {
+    this.result,
+    this.error,
+    required this.createdAt,
+    this.startedAt,
+    this.finishedAt,
+  });
+
+  factory Job.fromJson(
+    Map<String, dynamic> json,
+    T Function(dynamic json) fromResult,
+  ) {
+    final error = json["error"] as Map<String, dynamic>?;
+
+    return Job(
+      json["id"] as String,
+      json["state"] as String,
+      result: json["result"] != null ? fromResult(json["result"]) : null,
+      error: error != null
+          ? ApiError(
+              error["type"] as String,
+              error["code"] as int,
+              error["message"] as String,
+              extra: error["extra"],
+            )
+          : null,
+      createdAt: DateTime.parse(json["createdAt"] as String),
+      startedAt: DateTime.tryParse(json["startedAt"] as String? ?? ""),
+      finishedAt: DateTime.tryParse(json["finishedAt"] as String? ?? ""),
+    );
+  }
+
+  final String id;
+
+  /// "pending", "running", "completed", "failed" or "canceled"
+  final String state;
+  final T? result;
+  final ApiError? error;
+  final DateTime createdAt;
+  final DateTime? startedAt;
+  final DateTime? finishedAt;
+
+  bool get finished =>
+      state == "completed" || state == "failed" || state == "canceled";
+}
+
+class JobOptions {
+  const JobOptions({this.pollInterval, this.timeout});
+
+  /// Used when the server doesn't send a Retry-After header, defaults to 1
+  /// second
+  final Duration? pollInterval;
+
+  /// How long to wait for the job, a [TimeoutException] is thrown when the
+  /// job isn't finished before the timeout
+  final Duration? timeout;
+}
+
+/// Position of a page, used by [paginate] to request the next page
+class PageInfo<T> {
+  const PageInfo(this.items, {this.page, this.totalPages, this.nextCursor});
+
+  final List<T> items;
+  final int? page;
+  final int? totalPages;
+  final String? nextCursor;
+}
+
+typedef PageFetcher<T> = Future<ResultDart<PageInfo<T>, ApiError>> Function(
+    RequestOptions options);
+
+/// Walks every page of a paginated endpoint starting at the page requested
+/// by the query of [options], the [ApiError] of a failed page is added to
+/// the stream as a error
+Stream<T> paginate<T>(
+  String style,
+  RequestOptions? options,
+  PageFetcher<T> fetchPage,
+) async* {
+  final query = <String, dynamic>{...?options?.query};
+
+  while (true) {
+    final res = await fetchPage(
+      RequestOptions(query: Map.of(query), headers: options?.headers),
+    );
+
+    final error = res.exceptionOrNull();
+    if (error != null) {
+      throw error;
+    }
+
+    final page = res.getOrThrow();
+    for (final item in page.items) {
+      yield item;
+    }
+
+    if (style == "cursor") {
+      final next = page.nextCursor;
+      if (next == null || next.isEmpty) {
+        return;
+      }
+
+      query["cursor"] = next;
+    } else {
+      final current = page.page ?? 1;
+      if (current >= (page.totalPages ?? 0)) {
+        return;
+      }
+
+      query["page"] = "${current + 1}";
+    }
+  }
+}
+
+class SecurityScheme {
+  const SecurityScheme(this.type, {this.location = "", this.paramName = ""});
+
+  final String type;
+  final String location;
+  final String paramName;
+}
+
+String createIdempotencyKey() {
+  final random = Random.secure();
+  final bytes = List.generate(16, (_) => random.nextInt(256));
+  return bytes.map((b) => b.toRadixString(16).padLeft(2, "0")).join();
+}
+
 String createUrl(String baseUrl, String path) {
   return baseUrl + path;
 }
@@ -44,25 +425,104 @@ class BaseApiClient {
   late Dio _dio;
   late Map<String, String> headers;
 
-  AsyncResultDart<Map<String, dynamic>, ApiError> request(
-    String method,
-    String path, {
-    RequestOptions? options,
-    Map<String, dynamic>? body,
-  }) async {
-    final headers = <String, dynamic>{...this.headers};
-    headers["Content-Type"] = "application/json";
+  /// Shape of the responses sent by the server, "problem" sends the data as
+  /// is and the errors as RFC 9457 problem details
+  String envelope = "default";
 
-    if (options?.headers != null) {
-      headers.addAll(options!.headers!);
+  Map<String, SecurityScheme> securitySchemes = {};
+  final Map<String, String> _credentials = {};
+
+  /// Number of times a rate limited request is retried
+  int rateLimitRetries = 3;
+
+  /// Longest Retry-After delay in seconds the client waits for
+  int maxRetryAfter = 60;
+
+  /// Sets the credential used for the scheme, null removes the credential
+  void setCredential(String scheme, String? value) {
+    if (value == null) {
+      _credentials.remove(scheme);
+    } else {
+      _credentials[scheme] = value;
     }
+  }
 
-    final res = await _dio.request(
-      path,
-      options: Options(method: method, headers: headers),
-      queryParameters: options?.query,
-      data: body != null ? jsonEncode(body) : null,
-    );
+  void _applySecurity(
+    List<String> security,
+    Map<String, dynamic> headers,
+    Map<String, dynamic> query,
+  ) {
+    for (final name in security) {
+      final value = _credentials[name];
+      final scheme = securitySchemes[name];
+      if (value == null || scheme == null) {
+        continue;
+      }
+
+      switch (scheme.type) {
+        case "bearer":
+          headers["Authorization"] = "Bearer $value";
+        case "basic":
+          headers["Authorization"] = "Basic $value";
+        case "apiKey":
+          if (scheme.location == "query") {
+            query[scheme.paramName] = value;
+          } else {
+            headers[scheme.paramName] = value;
+          }
+        case "cookie":
+          headers["Cookie"] = "${scheme.paramName}=$value";
+      }
+
+      return;
+    }
+  }
+
+  Future<Response<dynamic>> _requestWithBackoff(
+    Future<Response<dynamic>> Function() send,
+    bool rateLimited,
+  ) async {
+    for (var attempt = 0; ; attempt++) {
+      final res = await send();
+      if (res.statusCode != 429 ||
+          !rateLimited ||
+          attempt >= rateLimitRetries) {
+        return res;
+      }
+
+      final retryAfter = int.tryParse(res.headers.value("retry-after") ?? "1");
+      if (retryAfter == null || retryAfter > maxRetryAfter) {
+        return res;
+      }
+
+      await Future.delayed(Duration(seconds: retryAfter));
+    }
+  }
+
+  ResultDart<Map<String, dynamic>, ApiError> _parseResponse(
+    Response<dynamic> res,
+  ) {
+    // NOTE: 204 has no body
+    if (res.statusCode == 204) {
+      return Success(<String, dynamic>{});
+    }
+
+    if (envelope == "problem") {
+      final status = res.statusCode ?? 0;
+      if (status >= 200 && status < 300) {
+        return Success(res.data);
+      }
+
+      final problem = res.data as Map<String, dynamic>;
+      return Failure(
+        ApiError(
+          (problem["errorType"] ?? problem["type"]) as String,
+          status,
+          (problem["detail"] ?? problem["title"]) as String,
+          extra: problem["extra"],
+        ),
+      );
+    }
 
     final data = res.data as Map<String, dynamic>;
 
@@ -75,6 +535,7 @@ class BaseApiClient {
           error["type"] as String,
           error["code"] as int,
           error["message"] as String,
+          extra: error["extra"],
         ),
       );
     }
@@ -82,41 +543,384 @@ class BaseApiClient {
     return Success(data["data"]);
   }
 
+  AsyncResultDart<Map<String, dynamic>, ApiError> request(
+    String method,
+    String path, {
+    RequestOptions? options,
+    Map<String, dynamic>? body,
+    List<String> security = const [],
+    bool rateLimited = false,
+    bool idempotent = false,
+  }) async {
+    final headers = <String, dynamic>{...this.headers};
+    headers["Content-Type"] = "application/json";
+
+    if (idempotent) {
+      headers["Idempotency-Key"] = createIdempotencyKey();
+    }
+
+    final query = <String, dynamic>{...?options?.query};
+    _applySecurity(security, headers, query);
+
+    if (options?.headers != null) {
+      headers.addAll(options!.headers!);
+    }
+
+    final res = await _requestWithBackoff(
+      () => _dio.request(
+        path,
+        options: Options(method: method, headers: headers),
+        queryParameters: query,
+        data: body != null ? jsonEncode(body) : null,
+      ),
+      rateLimited,
+    );
+
+    return _parseResponse(res);
+  }
+
   AsyncResultDart<Map<String, dynamic>, ApiError> requestForm(
     String method,
     String path, {
     RequestOptions? options,
     FormData? body,
+    List<String> security = const [],
+    bool rateLimited = false,
+    FormSpec? form,
+    ProgressCallback? onSendProgress,
   }) async {
+    if (form != null && body != null) {
+      final formError = validateFormData(body, form);
+      if (formError != null) {
+        return Failure(formError);
+      }
+    }
+
     final headers = <String, dynamic>{...this.headers};
     headers["Content-Type"] = "multipart/form-data";
 
+    final query = <String, dynamic>{...?options?.query};
+    _applySecurity(security, headers, query);
+
     if (options?.headers != null) {
       headers.addAll(options!.headers!);
     }
 
-    final res = await _dio.request(
-      path,
-      options: Options(method: method, headers: headers),
-      queryParameters: options?.query,
-      data: body,
+    // NOTE: FormData can only be sent once so retries sends a copy
+    final res = await _requestWithBackoff(
+      () => _dio.request(
+        path,
+        options: Options(method: method, headers: headers),
+        queryParameters: query,
+        data: rateLimited ? body?.clone() : body,
+        onSendProgress: onSendProgress,
+      ),
+      rateLimited,
     );
 
-    final data = res.data as Map<String, dynamic>;
+    return _parseResponse(res);
+  }
 
-    final success = data["success"] as bool;
+  /// Downloads the file of a download endpoint, set the Range header in the
+  /// options to download a part of the file
+  AsyncResultDart<DownloadResponse, ApiError> download(
+    String method,
+    String path, {
+    RequestOptions? options,
+    List<String> security = const [],
+    bool rateLimited = false,
+  }) async {
+    final headers = <String, dynamic>{...this.headers};
 
-    if (!success) {
-      final error = data["error"] as Map<String, dynamic>;
+    final query = <String, dynamic>{...?options?.query};
+    _applySecurity(security, headers, query);
+
+    if (options?.headers != null) {
+      headers.addAll(options!.headers!);
+    }
+
+    final res = await _requestWithBackoff(
+      () => _dio.request(
+        path,
+        options: Options(
+          method: method,
+          headers: headers,
+          responseType: ResponseType.stream,
+        ),
+        queryParameters: query,
+      ),
+      rateLimited,
+    );
+
+    final body = res.data as ResponseBody;
+    final status = res.statusCode ?? 0;
+
+    if (status >= 400) {
+      // NOTE: Errors are sent in the envelope so the body is read and
+      // parsed like the other requests
+      final bytes = <int>[];
+      await for (final chunk in body.stream) {
+        bytes.addAll(chunk);
+      }
+
+      final errorRes = Response<dynamic>(
+        requestOptions: res.requestOptions,
+        statusCode: status,
+        headers: res.headers,
+        data: jsonDecode(utf8.decode(bytes)),
+      );
+
+      final parsed = _parseResponse(errorRes);
       return Failure(
-        ApiError(
-          error["type"] as String,
-          error["code"] as int,
-          error["message"] as String,
+        parsed.exceptionOrNull() ??
+            ApiError("UNKNOWN_ERROR", status, "unexpected status $status"),
+      );
+    }
+
+    final digest = RegExp(
+      r"sha-256=:([^:]*):",
+    ).firstMatch(res.headers.value("repr-digest") ?? "");
+
+    return Success(
+      DownloadResponse(
+        body.stream,
+        statusCode: status,
+        contentType: res.headers.value("content-type"),
+        filename: parseContentDispositionFilename(
+          res.headers.value("content-disposition"),
+        ),
+        size: int.tryParse(res.headers.value("content-length") ?? ""),
+        digest: digest?.group(1),
+      ),
+    );
+  }
+
+  /// Sends the file to a upload endpoint in chunks, failed chunks are retried
+  /// from the offset the server has. The upload is finalized after the last
+  /// chunk and the response of the finalize request is returned
+  AsyncResultDart<Map<String, dynamic>, ApiError> resumableUpload(
+    String path, {
+    required int length,
+    required UploadChunkReader read,
+    UploadOptions upload = const UploadOptions(),
+    RequestOptions? options,
+    List<String> security = const [],
+    bool rateLimited = false,
+  }) async {
+    final headers = <String, dynamic>{...this.headers};
+
+    final query = <String, dynamic>{...?options?.query};
+    _applySecurity(security, headers, query);
+
+    if (options?.headers != null) {
+      headers.addAll(options!.headers!);
+    }
+
+    Future<Response<dynamic>> send(
+      String method,
+      String url,
+      Map<String, dynamic> extraHeaders, [
+      Uint8List? body,
+    ]) {
+      return _requestWithBackoff(
+        () => _dio.request(
+          url,
+          options: Options(
+            method: method,
+            headers: {...headers, ...extraHeaders},
+          ),
+          queryParameters: query,
+          data: body != null ? Stream.value(body) : null,
         ),
+        rateLimited,
       );
     }
 
-    return Success(data["data"]);
+    // NOTE: HEAD responses has no body so the error is built from the
+    // status
+    Future<ResultDart<int, ApiError>> readOffset(String uploadUrl) async {
+      final res = await send("HEAD", uploadUrl, {});
+      final status = res.statusCode ?? 0;
+      if (status != 200) {
+        return Failure(
+          ApiError(
+            "UNKNOWN_ERROR",
+            status,
+            res.statusMessage ?? "unexpected status $status",
+          ),
+        );
+      }
+
+      return Success(int.parse(res.headers.value("upload-offset") ?? "0"));
+    }
+
+    var uploadUrl = upload.uploadUrl;
+    var offset = 0;
+
+    if (uploadUrl != null) {
+      final current = await readOffset(uploadUrl);
+      if (current.isError()) {
+        return Failure(current.exceptionOrNull()!);
+      }
+
+      offset = current.getOrThrow();
+    } else {
+      late Digest hash;
+      final input = sha256.startChunkedConversion(
+        ChunkedConversionSink<Digest>.withCallback((d) => hash = d.single),
+      );
+      for (var i = 0; i < length; i += upload.chunkSize) {
+        input.add(await read(i, min(upload.chunkSize, length - i)));
+      }
+      input.close();
+
+      final digest = base64.encode(hash.bytes);
+
+      final res = await send("POST", path, {
+        "Upload-Length": length.toString(),
+        "Upload-Metadata": _encodeUploadMetadata(upload.metadata),
+        "Repr-Digest": "sha-256=:$digest:",
+      });
+
+      final created = _parseResponse(res);
+      if (created.isError()) {
+        return created;
+      }
+
+      // NOTE: Location is relative to the url of the request
+      uploadUrl = Uri.parse(createUrl(baseUrl, path))
+          .resolve(res.headers.value("location") ?? "")
+          .toString();
+      upload.onCreated?.call(uploadUrl);
+    }
+
+    var failures = 0;
+
+    while (offset < length) {
+      final chunk = await read(offset, min(upload.chunkSize, length - offset));
+      final checksum = base64.encode(sha256.convert(chunk).bytes);
+
+      Response<dynamic> res;
+      try {
+        res = await send("PATCH", uploadUrl, {
+          "Content-Type": "application/offset+octet-stream",
+          "Content-Length": chunk.length,
+          "Upload-Offset": offset.toString(),
+          "Upload-Checksum": "sha256 $checksum",
+        }, chunk);
+      } on DioException {
+        // NOTE: Network errors
+        failures++;
+        if (failures > upload.retries) {
+          rethrow;
+        }
+
+        final current = await readOffset(uploadUrl);
+        if (current.isError()) {
+          return Failure(current.exceptionOrNull()!);
+        }
+
+        offset = current.getOrThrow();
+        continue;
+      }
+
+      if (res.statusCode == 204) {
+        failures = 0;
+        offset = int.parse(res.headers.value("upload-offset") ?? "0");
+        upload.onProgress?.call(offset, length);
+        continue;
+      }
+
+      final parsed = _parseResponse(res);
+      final error = parsed.exceptionOrNull();
+      failures++;
+      if (error == null ||
+          failures > upload.retries ||
+          !_retryableUploadError(error)) {
+        return parsed;
+      }
+
+      final current = await readOffset(uploadUrl);
+      if (current.isError()) {
+        return Failure(current.exceptionOrNull()!);
+      }
+
+      offset = current.getOrThrow();
+    }
+
+    final res = await send("POST", "$uploadUrl/finalize", {});
+    return _parseResponse(res);
+  }
+
+  /// Polls the job until it is finished, returns the completed job and the
+  /// error of a failed or canceled job
+  AsyncResultDart<Map<String, dynamic>, ApiError> awaitJob(
+    String path, {
+    RequestOptions? options,
+    JobOptions job = const JobOptions(),
+    List<String> security = const [],
+    bool rateLimited = false,
+  }) async {
+    final deadline = job.timeout != null
+        ? DateTime.now().add(job.timeout!)
+        : null;
+
+    while (true) {
+      final headers = <String, dynamic>{...this.headers};
+
+      final query = <String, dynamic>{...?options?.query};
+      _applySecurity(security, headers, query);
+
+      if (options?.headers != null) {
+        headers.addAll(options!.headers!);
+      }
+
+      final res = await _requestWithBackoff(
+        () => _dio.request(
+          path,
+          options: Options(method: "GET", headers: headers),
+          queryParameters: query,
+        ),
+        rateLimited,
+      );
+
+      final parsed = _parseResponse(res);
+      final data = parsed.getOrNull();
+      if (data == null) {
+        return parsed;
+      }
+
+      final state = data["state"] as String;
+      if (state == "completed") {
+        return Success(data);
+      }
+
+      if (state == "failed" || state == "canceled") {
+        final error = data["error"] as Map<String, dynamic>;
+        return Failure(
+          ApiError(
+            error["type"] as String,
+            error["code"] as int,
+            error["message"] as String,
+            extra: error["extra"],
+          ),
+        );
+      }
+
+      var wait = job.pollInterval ?? const Duration(seconds: 1);
+      final retryAfter = int.tryParse(res.headers.value("retry-after") ?? "");
+      if (retryAfter != null && retryAfter > 0) {
+        wait = Duration(seconds: retryAfter);
+      }
+
+      if (deadline != null && DateTime.now().add(wait).isAfter(deadline)) {
+        throw TimeoutException(
+          "job did not finish before the timeout",
+          job.timeout,
+        );
+      }
+
+      await Future.delayed(wait);
+    }
   }
 }
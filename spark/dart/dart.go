@@ -7,8 +7,10 @@ import (
 	"io"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/iancoleman/strcase"
+	"github.com/nanoteck137/pyrin"
 	"github.com/nanoteck137/pyrin/spark"
 	"github.com/nanoteck137/pyrin/utils"
 )
@@ -39,7 +41,7 @@ func (g *DartGenerator) Generate(serverDef *spark.ServerDef, resolver *spark.Res
 	}
 
 	buf = &bytes.Buffer{}
-	err = g.generateClientCode(buf, serverDef)
+	err = g.generateClientCode(buf, serverDef, resolver)
 	if err != nil {
 		return err
 	}
@@ -83,6 +85,47 @@ func (g *DartGenerator) mapFieldName(field *spark.ResolvedField) string {
 	return field.Name
 }
 
+// writeDoc writes doc as a DartDoc comment
+func writeDoc(w *spark.CodeWriter, doc string) {
+	if doc == "" {
+		return
+	}
+
+	for _, line := range strings.Split(doc, "\n") {
+		if line == "" {
+			w.IndentWritef("///\n")
+		} else {
+			w.IndentWritef("/// %s\n", line)
+		}
+	}
+}
+
+// dartString returns s as a double quoted Dart string literal
+func dartString(s string) string {
+	r := strings.NewReplacer(
+		"\\", "\\\\",
+		"\"", "\\\"",
+		"$", "\\$",
+		"\n", "\\n",
+	)
+
+	return "\"" + r.Replace(s) + "\""
+}
+
+func (g *DartGenerator) writeEndpointDoc(w *spark.CodeWriter, e *spark.Endpoint) {
+	writeDoc(w, e.FullDoc())
+
+	if e.Deprecated != nil {
+		replacement := ""
+		if e.Deprecated.Replacement != "" {
+			replacement = g.mapName(strcase.ToLowerCamel(e.Deprecated.Replacement))
+		}
+
+		msg := e.Deprecated.DeprecationMessage(replacement)
+		w.IndentWritef("@Deprecated(%s)\n", dartString(msg))
+	}
+}
+
 func (g *DartGenerator) generateTypeDefinitionCode(out io.Writer, resolver *spark.Resolver) error {
 	w := spark.NewCodeWriter(out, indent)
 
@@ -109,6 +152,7 @@ func (g *DartGenerator) generateStruct(w *spark.CodeWriter, rs *spark.ResolvedSt
 	name := g.mapName(rs.Name)
 
 	w.IndentWritef("// Name: %s\n", rs.Name)
+	writeDoc(w, rs.Doc)
 	w.IndentWritef("@JsonSerializable()\n")
 	w.IndentWritef("class %s {\n", name)
 	w.Indent()
@@ -127,7 +171,7 @@ func (g *DartGenerator) generateStruct(w *spark.CodeWriter, rs *spark.ResolvedSt
 			w.Writef(", ")
 		}
 
-		if !f.OmitEmpty {
+		if !f.Optional {
 			w.Writef("required ")
 		}
 
@@ -184,11 +228,18 @@ func (g *DartGenerator) generateField(w *spark.CodeWriter, field *spark.Resolved
 	name := g.mapFieldName(field)
 
 	w.IndentWritef("// Name: %s\n", field.FullyQualifiedName)
-	w.IndentWritef("@JsonKey(name: \"%s\")\n", field.Name)
+	writeDoc(w, field.Doc)
+	if field.Optional {
+		w.IndentWritef("@JsonKey(name: \"%s\", includeIfNull: false)\n", field.Name)
+	} else {
+		w.IndentWritef("@JsonKey(name: \"%s\")\n", field.Name)
+	}
 	w.IndentWritef("final ")
-	g.generateFieldType(w, field.Type)
+	g.generateFieldType(w, field.BaseType())
 
-	if field.OmitEmpty && !isPointer(field.Type) {
+	// NOTE(patrik): Dart has no way to tell a missing key from a null
+	// value so both end up as a nullable type
+	if field.Optional || field.Nullable {
 		w.Writef("?")
 	}
 	w.Writef(" %s;\n", name)
@@ -207,6 +258,7 @@ func (g *DartGenerator) generateApiEndpoint(w *spark.CodeWriter, e *spark.Endpoi
 		response = "NoBody"
 	}
 
+	g.writeEndpointDoc(w, e)
 	w.IndentWritef("AsyncResultDart<%s, ApiError> %s(", response, name)
 	for _, arg := range args {
 		w.Writef("String %s, ", arg)
@@ -228,6 +280,15 @@ func (g *DartGenerator) generateApiEndpoint(w *spark.CodeWriter, e *spark.Endpoi
 	if e.Body != "" {
 		w.Writef(", body: body.toJson()")
 	}
+	if len(e.Security) > 0 {
+		w.Writef(", security: %s", securityList(e.Security))
+	}
+	if len(e.RateLimits) > 0 {
+		w.Writef(", rateLimited: true")
+	}
+	if e.Idempotency != nil {
+		w.Writef(", idempotent: true")
+	}
 	w.Writef(");\n")
 
 	if response != "NoBody" {
@@ -242,6 +303,145 @@ func (g *DartGenerator) generateApiEndpoint(w *spark.CodeWriter, e *spark.Endpoi
 	return nil
 }
 
+// generatePageIterator generates a method that returns a stream of the
+// items of every page of a paginated endpoint
+func (g *DartGenerator) generatePageIterator(w *spark.CodeWriter, e *spark.Endpoint, resolver *spark.Resolver) error {
+	_, args := utils.ReplacePathArgs(e.Path, g.mapName, func(name string) string {
+		return "$" + name
+	})
+
+	page, err := spark.ResolvePageFields(resolver, e.Response)
+	if err != nil {
+		return err
+	}
+
+	itemBuf := &strings.Builder{}
+	itemWriter := spark.NewCodeWriter(itemBuf, indent)
+	g.generateFieldType(&itemWriter, page.ItemType())
+	item := itemBuf.String()
+
+	name := g.mapName(strcase.ToLowerCamel(e.Name))
+	body := g.mapName(e.Body)
+
+	params := strings.Builder{}
+	callArgs := strings.Builder{}
+
+	for _, arg := range args {
+		fmt.Fprintf(&params, "String %s, ", arg)
+		fmt.Fprintf(&callArgs, "%s, ", arg)
+	}
+
+	if body != "" {
+		fmt.Fprintf(&params, "%s body, ", body)
+		fmt.Fprintf(&callArgs, "body, ")
+	}
+
+	writeDoc(w, fmt.Sprintf("Walks every page of [%s]", name))
+	w.IndentWritef("Stream<%s> iterate%s(%s{RequestOptions? options}) {\n", item, strcase.ToCamel(name), params.String())
+	w.Indent()
+
+	w.IndentWritef("return paginate<%s>(%s, options, (options) async {\n", item, dartString(e.Pagination.Style))
+	w.Indent()
+
+	w.IndentWritef("final res = await %s(%soptions: options);\n", name, callArgs.String())
+	w.IndentWritef("return res.map((page) => PageInfo<%s>(\n", item)
+	w.Indent()
+	w.IndentWritef("page.%s ?? [],\n", g.mapFieldName(&page.Items))
+	w.IndentWritef("page: page.%s,\n", g.mapFieldName(&page.Page))
+	w.IndentWritef("totalPages: page.%s,\n", g.mapFieldName(&page.TotalPages))
+	w.IndentWritef("nextCursor: page.%s,\n", g.mapFieldName(&page.NextCursor))
+	w.Unindent()
+	w.IndentWritef("));\n")
+
+	w.Unindent()
+	w.IndentWritef("});\n")
+
+	w.Unindent()
+	w.IndentWritef("}\n")
+
+	return nil
+}
+
+var dartKeywords = map[string]bool{
+	"abstract": true, "as": true, "assert": true, "async": true, "await": true,
+	"break": true, "case": true, "catch": true, "class": true, "const": true,
+	"continue": true, "default": true, "do": true, "else": true, "enum": true,
+	"extends": true, "false": true, "final": true, "finally": true, "for": true,
+	"if": true, "in": true, "is": true, "new": true, "null": true, "rethrow": true,
+	"return": true, "super": true, "switch": true, "this": true, "throw": true,
+	"true": true, "try": true, "var": true, "void": true, "while": true, "with": true,
+}
+
+// formFileArgs returns the names of the arguments for the files of the
+// form, the names can't collide with the other arguments of the method
+func formFileArgs(files []spark.FormFileDef, pathArgs []string) []string {
+	used := map[string]bool{
+		"body": true, "options": true, "onSendProgress": true, "res": true,
+	}
+
+	for _, arg := range pathArgs {
+		used[arg] = true
+	}
+
+	res := make([]string, 0, len(files))
+	for _, file := range files {
+		name := strcase.ToLowerCamel(file.Name)
+		if name == "" || dartKeywords[name] || used[name] {
+			name += "Files"
+		}
+
+		used[name] = true
+		res = append(res, name)
+	}
+
+	return res
+}
+
+func formSpec(form *spark.FormDef) string {
+	var files []string
+	for _, file := range form.Files {
+		args := []string{dartString(file.Name)}
+
+		if file.MinFiles > 0 {
+			args = append(args, fmt.Sprintf("minFiles: %d", file.MinFiles))
+		}
+
+		if file.Optional {
+			args = append(args, "optional: true")
+		}
+
+		if file.MaxFiles > 0 {
+			args = append(args, fmt.Sprintf("maxFiles: %d", file.MaxFiles))
+		}
+
+		if file.MaxFileSize > 0 {
+			args = append(args, fmt.Sprintf("maxFileSize: %d", file.MaxFileSize))
+		}
+
+		if len(file.AllowedMimeTypes) > 0 {
+			var types []string
+			for _, t := range file.AllowedMimeTypes {
+				types = append(types, dartString(t))
+			}
+
+			args = append(args, "allowedMimeTypes: ["+strings.Join(types, ", ")+"]")
+		}
+
+		files = append(files, "FormFileSpec("+strings.Join(args, ", ")+")")
+	}
+
+	var args []string
+	if form.MaxTotalSize > 0 {
+		args = append(args, fmt.Sprintf("maxTotalSize: %d", form.MaxTotalSize))
+	}
+
+	if len(files) > 0 {
+		args = append(args, "files: ["+strings.Join(files, ", ")+"]")
+	}
+
+	return "const FormSpec(" + strings.Join(args, ", ") + ")"
+}
+
 func (g *DartGenerator) generateFormEndpoint(w *spark.CodeWriter, e *spark.Endpoint) error {
 	newPath, args := utils.ReplacePathArgs(e.Path, g.mapName, func(name string) string {
 		return "$" + name
@@ -249,33 +449,69 @@ func (g *DartGenerator) generateFormEndpoint(w *spark.CodeWriter, e *spark.Endpo
 
 	name := g.mapName(strcase.ToLowerCamel(e.Name))
 	response := g.mapName(e.Response)
-	// body := g.mapName(e.Body)
+	body := g.mapName(e.Body)
 
 	if response == "" {
 		response = "NoBody"
 	}
 
+	var files []spark.FormFileDef
+	if e.Form != nil {
+		files = e.Form.Files
+	}
+
+	fileArgs := formFileArgs(files, args)
+
+	g.writeEndpointDoc(w, e)
 	w.IndentWritef("AsyncResultDart<%s, ApiError> %s(", response, name)
 	for _, arg := range args {
 		w.Writef("String %s, ", arg)
 	}
 
-	w.Writef("FormDataType body, ")
-
-	// if body != "" {
-	// 	w.Writef("%s body, ", body)
-	// }
+	if body != "" {
+		w.Writef("%s body, ", body)
+	}
 
 	w.Writef("{")
-	w.Writef("RequestOptions? options")
+	for i, file := range files {
+		// NOTE(patrik): The field can be left out when the server accepts
+		// no files
+		if file.Optional || file.MinFiles == 0 {
+			w.Writef("List<MultipartFile> %s = const [], ", fileArgs[i])
+		} else {
+			w.Writef("required List<MultipartFile> %s, ", fileArgs[i])
+		}
+	}
+	w.Writef("RequestOptions? options, ")
+	w.Writef("ProgressCallback? onSendProgress")
 	w.Writef("}")
 
 	w.Writef(") async {\n")
 	w.Indent()
 
+	bodyArg := "null"
+	if body != "" {
+		bodyArg = "body.toJson()"
+	}
+
+	var filesArg []string
+	for i, file := range files {
+		filesArg = append(filesArg, fmt.Sprintf("%s: %s", dartString(file.Name), fileArgs[i]))
+	}
+
 	w.IndentWritef("final res = await requestForm(\"%s\", \"%s\"", e.Method, newPath)
 	w.Writef(", options: options")
-	w.Writef(", body: body")
+	w.Writef(", body: createFormData(%s, {%s})", bodyArg, strings.Join(filesArg, ", "))
+	w.Writef(", onSendProgress: onSendProgress")
+	if len(e.Security) > 0 {
+		w.Writef(", security: %s", securityList(e.Security))
+	}
+	if len(e.RateLimits) > 0 {
+		w.Writef(", rateLimited: true")
+	}
+	if e.Form.HasConstraints() {
+		w.Writef(", form: %s", formSpec(e.Form))
+	}
 	w.Writef(");\n")
 
 	if response != "NoBody" {
@@ -290,6 +526,196 @@ func (g *DartGenerator) generateFormEndpoint(w *spark.CodeWriter, e *spark.Endpo
 	return nil
 }
 
+func (g *DartGenerator) generateDownloadEndpoint(w *spark.CodeWriter, e *spark.Endpoint) error {
+	newPath, args := utils.ReplacePathArgs(e.Path, g.mapName, func(name string) string {
+		return "$" + name
+	})
+
+	name := g.mapName(strcase.ToLowerCamel(e.Name))
+
+	g.writeEndpointDoc(w, e)
+	w.IndentWritef("AsyncResultDart<DownloadResponse, ApiError> %s(", name)
+	for _, arg := range args {
+		w.Writef("String %s, ", arg)
+	}
+
+	w.Writef("{")
+	w.Writef("RequestOptions? options")
+	w.Writef("}")
+
+	w.Writef(") {\n")
+	w.Indent()
+
+	w.IndentWritef("return download(\"%s\", \"%s\"", e.Method, newPath)
+	w.Writef(", options: options")
+	if len(e.Security) > 0 {
+		w.Writef(", security: %s", securityList(e.Security))
+	}
+	if len(e.RateLimits) > 0 {
+		w.Writef(", rateLimited: true")
+	}
+	w.Writef(");\n")
+
+	w.Unindent()
+	w.IndentWritef("}\n")
+
+	return nil
+}
+
+func (g *DartGenerator) generateUploadEndpoint(w *spark.CodeWriter, e *spark.Endpoint) error {
+	newPath, args := utils.ReplacePathArgs(e.Path, g.mapName, func(name string) string {
+		return "$" + name
+	})
+
+	name := g.mapName(strcase.ToLowerCamel(e.Name))
+	response := g.mapName(e.Response)
+
+	g.writeEndpointDoc(w, e)
+
+	// NOTE(patrik): The response of OnComplete is untyped when the handler
+	// has no ResponseType
+	if response != "" {
+		w.IndentWritef("AsyncResultDart<%s, ApiError> %s(", response, name)
+	} else {
+		w.IndentWritef("AsyncResultDart<Map<String, dynamic>, ApiError> %s(", name)
+	}
+
+	for _, arg := range args {
+		w.Writef("String %s, ", arg)
+	}
+
+	w.Writef("{")
+	w.Writef("required int length, ")
+	w.Writef("required UploadChunkReader read, ")
+	w.Writef("UploadOptions upload = const UploadOptions(), ")
+	w.Writef("RequestOptions? options")
+	w.Writef("}")
+
+	w.Writef(") async {\n")
+	w.Indent()
+
+	w.IndentWritef("final res = await resumableUpload(\"%s\"", newPath)
+	w.Writef(", length: length, read: read, upload: upload")
+	w.Writef(", options: options")
+	if len(e.Security) > 0 {
+		w.Writef(", security: %s", securityList(e.Security))
+	}
+	if len(e.RateLimits) > 0 {
+		w.Writef(", rateLimited: true")
+	}
+	w.Writef(");\n")
+
+	if response != "" {
+		w.IndentWritef("return res.map((success) => %s.fromJson(success));\n", response)
+	} else {
+		w.IndentWritef("return res;\n")
+	}
+
+	w.Unindent()
+	w.IndentWritef("}\n")
+
+	return nil
+}
+
+// generateJobEndpoint generates the method that starts the job and the
+// methods that reads, cancels and awaits the jobs of the endpoint
+func (g *DartGenerator) generateJobEndpoint(w *spark.CodeWriter, e *spark.Endpoint) error {
+	newPath, args := utils.ReplacePathArgs(e.Path, g.mapName, func(name string) string {
+		return "$" + name
+	})
+
+	name := g.mapName(strcase.ToLowerCamel(e.Name))
+	typeName := strcase.ToCamel(name)
+	result := g.mapName(e.Response)
+	body := g.mapName(e.Body)
+
+	fromResult := "(_) => NoBody()"
+	if result != "" {
+		fromResult = fmt.Sprintf("(json) => %s.fromJson(json)", result)
+	} else {
+		result = "NoBody"
+	}
+
+	job := fmt.Sprintf("Job<%s>", result)
+
+	writeMethod := func(returnType, methodName, params, namedParams string) {
+		w.IndentWritef("AsyncResultDart<%s, ApiError> %s(", returnType, methodName)
+		for _, arg := range args {
+			w.Writef("String %s, ", arg)
+		}
+
+		w.Writef("%s", params)
+
+		w.Writef("{")
+		w.Writef("RequestOptions? options%s", namedParams)
+		w.Writef("}")
+
+		w.Writef(") async {\n")
+		w.Indent()
+	}
+
+	writeCall := func(call, method, path, extra string) {
+		w.IndentWritef("final res = await %s(", call)
+		if method != "" {
+			w.Writef("\"%s\", ", method)
+		}
+		w.Writef("\"%s\"", path)
+		w.Writef(", options: options%s", extra)
+		if len(e.Security) > 0 {
+			w.Writef(", security: %s", securityList(e.Security))
+		}
+		if len(e.RateLimits) > 0 {
+			w.Writef(", rateLimited: true")
+		}
+		w.Writef(");\n")
+	}
+
+	end := func() {
+		w.Unindent()
+		w.IndentWritef("}\n")
+	}
+
+	bodyParam := ""
+	bodyArg := ""
+	if body != "" {
+		bodyParam = fmt.Sprintf("%s body, ", body)
+		bodyArg = ", body: body.toJson()"
+	}
+
+	g.writeEndpointDoc(w, e)
+	writeMethod(job, name, bodyParam, "")
+	writeCall("request", e.Method, newPath, bodyArg)
+	w.IndentWritef("return res.map((success) => Job.fromJson(success, %s));\n", fromResult)
+	end()
+
+	w.Writef("\n")
+	writeDoc(w, fmt.Sprintf("Returns a job started by [%s]", name))
+	writeMethod(job, "get"+typeName+"Job", "String jobId, ", "")
+	writeCall("request", "GET", newPath+"/$jobId", "")
+	w.IndentWritef("return res.map((success) => Job.fromJson(success, %s));\n", fromResult)
+	end()
+
+	w.Writef("\n")
+	writeDoc(w, fmt.Sprintf("Cancels a job started by [%s]", name))
+	writeMethod(job, "cancel"+typeName+"Job", "String jobId, ", "")
+	writeCall("request", "POST", newPath+"/$jobId/cancel", "")
+	w.IndentWritef("return res.map((success) => Job.fromJson(success, %s));\n", fromResult)
+	end()
+
+	w.Writef("\n")
+	writeDoc(w, fmt.Sprintf("Waits for a job started by [%s] and returns the result", name))
+	writeMethod(result, "await"+typeName+"Job", "String jobId, ", ", JobOptions job = const JobOptions()")
+	writeCall("awaitJob", "", newPath+"/$jobId", ", job: job")
+	if result != "NoBody" {
+		w.IndentWritef("return res.map((success) => %s.fromJson(success[\"result\"]));\n", result)
+	} else {
+		w.IndentWritef("return res.map((success) => NoBody());\n")
+	}
+	end()
+
+	return nil
+}
+
 func (g *DartGenerator) generateUrlForEndpoint(w *spark.CodeWriter, e *spark.Endpoint) error {
 	newPath, args := utils.ReplacePathArgs(e.Path, g.mapName, func(name string) string {
 		return "$" + name
@@ -297,6 +723,7 @@ func (g *DartGenerator) generateUrlForEndpoint(w *spark.CodeWriter, e *spark.End
 
 	name := g.mapName(strcase.ToLowerCamel(e.Name))
 
+	g.writeEndpointDoc(w, e)
 	w.IndentWritef("String %s(", name)
 	for i, arg := range args {
 		if i > 0 {
@@ -319,10 +746,56 @@ func (g *DartGenerator) generateUrlForEndpoint(w *spark.CodeWriter, e *spark.End
 	return nil
 }
 
-func (g *DartGenerator) generateClientCode(out io.Writer, serverDef *spark.ServerDef) error {
+func securityList(security []string) string {
+	var items []string
+	for _, name := range security {
+		items = append(items, dartString(name))
+	}
+
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+func (g *DartGenerator) generateSecurityHelper(w *spark.CodeWriter, scheme *spark.SecuritySchemeDef) {
+	name := g.mapName(strcase.ToCamel(scheme.Name))
+	key := dartString(scheme.Name)
+
+	switch scheme.Type {
+	case "bearer":
+		w.IndentWritef("void set%sToken(String? token) {\n", name)
+		w.Indent()
+		w.IndentWritef("setCredential(%s, token);\n", key)
+	case "apiKey":
+		w.IndentWritef("void set%sApiKey(String? apiKey) {\n", name)
+		w.Indent()
+		w.IndentWritef("setCredential(%s, apiKey);\n", key)
+	case "basic":
+		w.IndentWritef("void set%sCredentials(String? username, String? password) {\n", name)
+		w.Indent()
+		w.IndentWritef("if (username == null || password == null) {\n")
+		w.Indent()
+		w.IndentWritef("setCredential(%s, null);\n", key)
+		w.IndentWritef("return;\n")
+		w.Unindent()
+		w.IndentWritef("}\n")
+		w.IndentWritef("setCredential(%s, base64Encode(utf8.encode(\"$username:$password\")));\n", key)
+	case "cookie":
+		w.IndentWritef("void set%sCookie(String? value) {\n", name)
+		w.Indent()
+		w.IndentWritef("setCredential(%s, value);\n", key)
+	default:
+		return
+	}
+
+	w.Unindent()
+	w.IndentWritef("}\n")
+}
+
+func (g *DartGenerator) generateClientCode(out io.Writer, serverDef *spark.ServerDef, resolver *spark.Resolver) error {
 	w := spark.NewCodeWriter(out, indent)
 
 	w.Writef("// %s\n", warningMessage)
+	w.IndentWritef("import 'dart:convert';\n")
+	w.IndentWritef("\n")
 	w.IndentWritef("import 'package:result_dart/result_dart.dart';\n")
 	w.IndentWritef("\n")
 
@@ -338,6 +811,25 @@ func (g *DartGenerator) generateClientCode(out io.Writer, serverDef *spark.Serve
 
 	w.IndentWritef("url = ClientUrls(baseUrl);\n")
 
+	envelope, err := serverDef.ResponseEnvelope()
+	if err != nil {
+		return err
+	}
+
+	if envelope != pyrin.EnvelopeDefault {
+		w.IndentWritef("envelope = %s;\n", dartString(envelope))
+	}
+
+	if len(serverDef.SecuritySchemes) > 0 {
+		w.IndentWritef("securitySchemes = {\n")
+		w.Indent()
+		for _, scheme := range serverDef.SecuritySchemes {
+			w.IndentWritef("%s: SecurityScheme(%s, location: %s, paramName: %s),\n", dartString(scheme.Name), dartString(scheme.Type), dartString(scheme.In), dartString(scheme.ParamName))
+		}
+		w.Unindent()
+		w.IndentWritef("};\n")
+	}
+
 	w.Unindent()
 	w.IndentWritef("}\n")
 
@@ -345,6 +837,11 @@ func (g *DartGenerator) generateClientCode(out io.Writer, serverDef *spark.Serve
 
 	w.IndentWritef("late ClientUrls url;")
 
+	for _, scheme := range serverDef.SecuritySchemes {
+		w.IndentWritef("\n")
+		g.generateSecurityHelper(&w, &scheme)
+	}
+
 	for _, endpoint := range serverDef.Endpoints {
 		w.IndentWritef("\n")
 
@@ -354,11 +851,35 @@ func (g *DartGenerator) generateClientCode(out io.Writer, serverDef *spark.Serve
 			if err != nil {
 				return err
 			}
+
+			if endpoint.Pagination != nil {
+				w.Writef("\n")
+
+				err := g.generatePageIterator(&w, &endpoint, resolver)
+				if err != nil {
+					return err
+				}
+			}
 		case spark.EndpointTypeForm:
 			err := g.generateFormEndpoint(&w, &endpoint)
 			if err != nil {
 				return err
 			}
+		case spark.EndpointTypeDownload:
+			err := g.generateDownloadEndpoint(&w, &endpoint)
+			if err != nil {
+				return err
+			}
+		case spark.EndpointTypeUpload:
+			err := g.generateUploadEndpoint(&w, &endpoint)
+			if err != nil {
+				return err
+			}
+		case spark.EndpointTypeJob:
+			err := g.generateJobEndpoint(&w, &endpoint)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
@@ -389,14 +910,3 @@ func (g *DartGenerator) generateClientCode(out io.Writer, serverDef *spark.Serve
 
 	return nil
 }
-
-func isPointer(ty spark.FieldType) bool {
-	switch t := ty.(type) {
-	case *spark.FieldTypeArray:
-		return isPointer(t.ElementType)
-	case *spark.FieldTypePtr:
-		return true
-	}
-
-	return false
-}
@@ -0,0 +1,397 @@
+package spark
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/nanoteck137/pyrin"
+	"golang.org/x/tools/go/packages"
+)
+
+var pyrinPkgPath = reflect.TypeOf(pyrin.ApiHandler{}).PkgPath()
+
+var handlerTypeNames = map[string]bool{
+	"ApiHandler":      true,
+	"FormApiHandler":  true,
+	"DownloadHandler": true,
+	"UploadHandler":   true,
+	"JobHandler":      true,
+	"NormalHandler":   true,
+}
+
+type structDocs struct {
+	Doc    string
+	Fields map[string]string
+	// NOTE(patrik): Embedded structs keyed like docCollector.structs, used
+	// to find the docs for fields that are inherited
+	Embedded []string
+}
+
+type handlerDocs struct {
+	Doc string
+	// NOTE(patrik): Position of the function used as HandlerFunc, the doc
+	// of the function is used when the handler itself has no doc
+	FuncPos token.Pos
+}
+
+type docCollector struct {
+	fset *token.FileSet
+
+	// NOTE(patrik): Keyed by "pkgpath.Name"
+	structs  map[string]*structDocs
+	handlers map[string]handlerDocs
+	funcs    map[token.Pos]string
+}
+
+func formatDoc(groups ...*ast.CommentGroup) string {
+	for _, g := range groups {
+		if g == nil {
+			continue
+		}
+
+		text := strings.TrimSpace(g.Text())
+		if text != "" {
+			return text
+		}
+	}
+
+	return ""
+}
+
+func fieldJsonName(field *ast.Field, name string) (string, bool) {
+	if field.Tag == nil {
+		return name, true
+	}
+
+	tag, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return name, true
+	}
+
+	j := reflect.StructTag(tag).Get("json")
+	if j == "-" {
+		return "", false
+	}
+
+	jname, _, _ := strings.Cut(j, ",")
+	if jname != "" {
+		return jname, true
+	}
+
+	return name, true
+}
+
+func (c *docCollector) collectStruct(pkgPath string, info *types.Info, spec *ast.TypeSpec, decl *ast.GenDecl, st *ast.StructType) {
+	docs := &structDocs{
+		Fields: map[string]string{},
+	}
+
+	docs.Doc = formatDoc(spec.Doc)
+	if docs.Doc == "" && len(decl.Specs) == 1 {
+		docs.Doc = formatDoc(decl.Doc)
+	}
+
+	for _, field := range st.Fields.List {
+		doc := formatDoc(field.Doc, field.Comment)
+
+		if len(field.Names) == 0 {
+			ty := field.Type
+			if star, ok := ty.(*ast.StarExpr); ok {
+				ty = star.X
+			}
+
+			switch ty := ty.(type) {
+			case *ast.Ident:
+				docs.Embedded = append(docs.Embedded, pkgPath+"."+ty.Name)
+			case *ast.SelectorExpr:
+				// NOTE(patrik): Structs from other packages is resolved
+				// with the type info, the docs of the other package is
+				// collected by AttachDocs
+				if info == nil {
+					break
+				}
+
+				if named, ok := info.TypeOf(ty).(*types.Named); ok && named.Obj().Pkg() != nil {
+					obj := named.Obj()
+					docs.Embedded = append(docs.Embedded, obj.Pkg().Path()+"."+obj.Name())
+				}
+			}
+
+			continue
+		}
+
+		if doc == "" {
+			continue
+		}
+
+		for _, name := range field.Names {
+			if !name.IsExported() {
+				continue
+			}
+
+			jname, ok := fieldJsonName(field, name.Name)
+			if !ok {
+				continue
+			}
+
+			docs.Fields[jname] = doc
+		}
+	}
+
+	c.structs[pkgPath+"."+spec.Name.Name] = docs
+}
+
+func (c *docCollector) isHandlerLiteral(info *types.Info, lit *ast.CompositeLit) bool {
+	t := info.TypeOf(lit)
+	if t == nil {
+		return false
+	}
+
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+
+	obj := named.Obj()
+	if obj.Pkg() == nil || obj.Pkg().Path() != pyrinPkgPath {
+		return false
+	}
+
+	return handlerTypeNames[obj.Name()]
+}
+
+func (c *docCollector) collectHandler(info *types.Info, comments map[int]*ast.CommentGroup, lit *ast.CompositeLit) {
+	name := ""
+	var docs handlerDocs
+
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+
+		key, ok := kv.Key.(*ast.Ident)
+		if !ok {
+			continue
+		}
+
+		switch key.Name {
+		case "Name":
+			tv, ok := info.Types[kv.Value]
+			if ok && tv.Value != nil && tv.Value.Kind() == constant.String {
+				name = constant.StringVal(tv.Value)
+			}
+		case "HandlerFunc":
+			var ident *ast.Ident
+			switch v := kv.Value.(type) {
+			case *ast.Ident:
+				ident = v
+			case *ast.SelectorExpr:
+				ident = v.Sel
+			}
+
+			if ident != nil {
+				if fn, ok := info.Uses[ident].(*types.Func); ok {
+					docs.FuncPos = fn.Pos()
+				}
+			}
+		}
+	}
+
+	if name == "" {
+		return
+	}
+
+	line := c.fset.Position(lit.Pos()).Line
+	if cg, exists := comments[line-1]; exists {
+		docs.Doc = formatDoc(cg)
+	}
+
+	c.handlers[name] = docs
+}
+
+// collectStructs collects the docs of the structs declared at the top level
+// of a dependency
+func (c *docCollector) collectStructs(pkg *packages.Package) {
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if st, ok := ts.Type.(*ast.StructType); ok {
+					c.collectStruct(pkg.PkgPath, pkg.TypesInfo, ts, gen, st)
+				}
+			}
+		}
+	}
+}
+
+func (c *docCollector) collectPackage(pkg *packages.Package) {
+	pkgPaths := []string{pkg.PkgPath}
+
+	// NOTE(patrik): reflect reports "main" as the package path for types
+	// declared inside a main package, except when running as a test
+	if pkg.Name == "main" {
+		pkgPaths = append(pkgPaths, "main")
+	}
+
+	for _, file := range pkg.Syntax {
+		comments := make(map[int]*ast.CommentGroup)
+		for _, cg := range file.Comments {
+			comments[c.fset.Position(cg.End()).Line] = cg
+		}
+
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.GenDecl:
+				if n.Tok != token.TYPE {
+					return true
+				}
+
+				for _, spec := range n.Specs {
+					ts := spec.(*ast.TypeSpec)
+					if st, ok := ts.Type.(*ast.StructType); ok {
+						for _, pkgPath := range pkgPaths {
+							c.collectStruct(pkgPath, pkg.TypesInfo, ts, n, st)
+						}
+					}
+				}
+			case *ast.FuncDecl:
+				if doc := formatDoc(n.Doc); doc != "" {
+					c.funcs[n.Name.Pos()] = doc
+				}
+			case *ast.CompositeLit:
+				if c.isHandlerLiteral(pkg.TypesInfo, n) {
+					c.collectHandler(pkg.TypesInfo, comments, n)
+				}
+			}
+
+			return true
+		})
+	}
+}
+
+func (c *docCollector) handlerDoc(name string) string {
+	docs, exists := c.handlers[name]
+	if !exists {
+		return ""
+	}
+
+	if docs.Doc == "" && docs.FuncPos.IsValid() {
+		return c.funcs[docs.FuncPos]
+	}
+
+	return docs.Doc
+}
+
+func (c *docCollector) fieldDoc(goType string, field string, depth int) string {
+	s, exists := c.structs[goType]
+	if !exists || depth > 8 {
+		return ""
+	}
+
+	if doc, exists := s.Fields[field]; exists {
+		return doc
+	}
+
+	for _, embedded := range s.Embedded {
+		if doc := c.fieldDoc(embedded, field, depth+1); doc != "" {
+			return doc
+		}
+	}
+
+	return ""
+}
+
+// AttachDocs loads the Go packages matching patterns from dir and copies the
+// doc comments of the structures, fields and handlers into the server def.
+// Structures are matched with GoType and endpoints with the handler name.
+// The fields of embedded structs is documented from the package declaring
+// the struct, also when it is a dependency outside of patterns.
+func AttachDocs(serverDef *ServerDef, dir string, patterns ...string) error {
+	fset := token.NewFileSet()
+
+	cfg := &packages.Config{
+		Mode: packages.NeedName |
+			packages.NeedFiles |
+			packages.NeedSyntax |
+			packages.NeedTypes |
+			packages.NeedTypesInfo |
+			packages.NeedImports |
+			packages.NeedDeps,
+		Dir:  dir,
+		Fset: fset,
+	}
+
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return fmt.Errorf("failed to load packages: %w", err)
+	}
+
+	var errs []error
+	packages.Visit(pkgs, nil, func(p *packages.Package) {
+		for _, e := range p.Errors {
+			errs = append(errs, e)
+		}
+	})
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	collector := &docCollector{
+		fset:     fset,
+		structs:  map[string]*structDocs{},
+		handlers: map[string]handlerDocs{},
+		funcs:    map[token.Pos]string{},
+	}
+
+	initial := make(map[*packages.Package]bool)
+	for _, pkg := range pkgs {
+		initial[pkg] = true
+		collector.collectPackage(pkg)
+	}
+
+	// NOTE(patrik): The structs of the dependencies is needed for embedded
+	// structs from other packages, the handlers is only collected from the
+	// packages matching patterns
+	packages.Visit(pkgs, nil, func(p *packages.Package) {
+		if !initial[p] {
+			collector.collectStructs(p)
+		}
+	})
+
+	for i := range serverDef.Structures {
+		s := &serverDef.Structures[i]
+		if s.GoType == "" {
+			continue
+		}
+
+		if docs, exists := collector.structs[s.GoType]; exists {
+			s.Doc = docs.Doc
+		}
+
+		for j := range s.Fields {
+			f := &s.Fields[j]
+			f.Doc = collector.fieldDoc(s.GoType, f.Name, 0)
+		}
+	}
+
+	for i := range serverDef.Endpoints {
+		e := &serverDef.Endpoints[i]
+		e.Doc = collector.handlerDoc(e.Name)
+	}
+
+	return nil
+}
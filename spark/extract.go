@@ -0,0 +1,267 @@
+package spark
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"golang.org/x/tools/go/packages"
+)
+
+const extractOutputEnv = "PYRIN_EXTRACT_OUTPUT"
+const extractTestName = "TestPyrinExtractServerDef"
+
+// NOTE(patrik): The harness is added to the package as a test file with an
+// overlay so that unexported functions and main packages can be used, the
+// import names are prefixed so they don't collide with the package
+var extractHarnessTemplate = template.Must(template.New("harness").Parse(`// Code generated by pyrin extract. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	pyrin_extract_os "os"
+	pyrin_extract_testing "testing"
+
+	pyrin_extract_spark "github.com/nanoteck137/pyrin/spark"
+)
+
+func {{.TestName}}(t *pyrin_extract_testing.T) {
+	router := pyrin_extract_spark.Router{}
+	{{.Func}}(&router)
+
+	nameFilter := pyrin_extract_spark.NameFilter{}
+	{{- if .DefaultNameFilter}}
+	nameFilter.LoadDefault()
+	{{- end}}
+
+	serverDef, err := pyrin_extract_spark.CreateServerDef(&router, nameFilter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = serverDef.SaveToFile(pyrin_extract_os.Getenv("{{.OutputEnv}}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+`))
+
+type ExtractConfig struct {
+	// Dir is the directory the packages are loaded from
+	Dir      string
+	Patterns []string
+
+	// FuncName is the name of the function that registers the handlers,
+	// when empty the function is found by looking for a function with the
+	// signature func(pyrin.Router)
+	FuncName string
+
+	// LoadDefaultNameFilter loads the default banned field names
+	LoadDefaultNameFilter bool
+
+	// Envelope is the name of the envelope the server uses, defaults to
+	// pyrin.EnvelopeDefault
+	Envelope string
+}
+
+type registerFunc struct {
+	Pkg  *packages.Package
+	Name string
+}
+
+func isRouterType(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == pyrinPkgPath && obj.Name() == "Router"
+}
+
+func findRegisterFuncs(pkg *packages.Package, name string) []registerFunc {
+	var res []registerFunc
+
+	if pkg.Types == nil {
+		return nil
+	}
+
+	scope := pkg.Types.Scope()
+	for _, n := range scope.Names() {
+		if name != "" && n != name {
+			continue
+		}
+
+		fn, ok := scope.Lookup(n).(*types.Func)
+		if !ok {
+			continue
+		}
+
+		sig := fn.Type().(*types.Signature)
+		if sig.Params().Len() != 1 || sig.Results().Len() != 0 {
+			continue
+		}
+
+		if !isRouterType(sig.Params().At(0).Type()) {
+			continue
+		}
+
+		res = append(res, registerFunc{
+			Pkg:  pkg,
+			Name: n,
+		})
+	}
+
+	return res
+}
+
+// ExtractServerDef creates the server def for a package without a bespoke
+// main package, the register function is found inside the packages and
+// called from a temporary test harness that saves the server def
+func ExtractServerDef(config ExtractConfig) (*ServerDef, error) {
+	dir := config.Dir
+	if dir == "" {
+		dir = "."
+	}
+
+	patterns := config.Patterns
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	cfg := &packages.Config{
+		Mode: packages.NeedName |
+			packages.NeedFiles |
+			packages.NeedTypes |
+			packages.NeedImports |
+			packages.NeedDeps,
+		Dir: dir,
+	}
+
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load packages: %w", err)
+	}
+
+	var errs []error
+	var funcs []registerFunc
+	for _, pkg := range pkgs {
+		for _, e := range pkg.Errors {
+			errs = append(errs, e)
+		}
+
+		funcs = append(funcs, findRegisterFuncs(pkg, config.FuncName)...)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if len(funcs) == 0 {
+		return nil, errors.New("no register function found, expected a function with the signature func(pyrin.Router)")
+	}
+
+	if len(funcs) > 1 {
+		var names []string
+		for _, f := range funcs {
+			names = append(names, f.Pkg.PkgPath+"."+f.Name)
+		}
+
+		return nil, fmt.Errorf("multiple register functions found, select one with the function name or package: %s", strings.Join(names, ", "))
+	}
+
+	serverDef, err := runExtractHarness(funcs[0], config.LoadDefaultNameFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Envelope != "" {
+		serverDef.Envelope = config.Envelope
+	}
+
+	return serverDef, nil
+}
+
+func runExtractHarness(fn registerFunc, defaultNameFilter bool) (*ServerDef, error) {
+	if len(fn.Pkg.GoFiles) == 0 {
+		return nil, fmt.Errorf("%s: package has no go files", fn.Pkg.PkgPath)
+	}
+
+	pkgDir := filepath.Dir(fn.Pkg.GoFiles[0])
+
+	tmp, err := os.MkdirTemp("", "pyrin-extract-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	buf := &bytes.Buffer{}
+	err = extractHarnessTemplate.Execute(buf, map[string]any{
+		"Package":           fn.Pkg.Name,
+		"TestName":          extractTestName,
+		"Func":              fn.Name,
+		"DefaultNameFilter": defaultNameFilter,
+		"OutputEnv":         extractOutputEnv,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	harness := filepath.Join(tmp, "harness.go")
+	err = os.WriteFile(harness, buf.Bytes(), 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	overlay, err := json.Marshal(map[string]any{
+		"Replace": map[string]string{
+			filepath.Join(pkgDir, "pyrin_extract_harness_test.go"): harness,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	overlayPath := filepath.Join(tmp, "overlay.json")
+	err = os.WriteFile(overlayPath, overlay, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	output := filepath.Join(tmp, "pyrin.json")
+
+	cmd := exec.Command(
+		"go", "test",
+		"-count=1",
+		"-overlay", overlayPath,
+		"-run", "^"+extractTestName+"$",
+		".",
+	)
+	cmd.Dir = pkgDir
+	cmd.Env = append(os.Environ(), extractOutputEnv+"="+output)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run extract harness: %w\n%s", err, out)
+	}
+
+	d, err := os.ReadFile(output)
+	if err != nil {
+		return nil, fmt.Errorf("extract harness produced no server def: %w", err)
+	}
+
+	var serverDef ServerDef
+	err = json.Unmarshal(d, &serverDef)
+	if err != nil {
+		return nil, err
+	}
+
+	return &serverDef, nil
+}
@@ -7,6 +7,8 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+
+	"github.com/iancoleman/strcase"
 )
 
 type StructRegistry struct {
@@ -31,7 +33,7 @@ func (c *StructRegistry) isTypeRegisterd(t reflect.Type) bool {
 }
 
 func (c *StructRegistry) registerType(t reflect.Type) {
-	name := t.Name()
+	name := c.typeName(t)
 	// fullName := t.PkgPath() + "-" + name
 
 	used, exists := c.nameUsed[name]
@@ -50,6 +52,35 @@ func (c *StructRegistry) registerType(t reflect.Type) {
 	c.types[name] = t
 }
 
+// isPageType returns true when t is a instance of pyrin.Page
+func isPageType(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct &&
+		t.PkgPath() == pyrinPkgPath &&
+		strings.HasPrefix(t.Name(), "Page[")
+}
+
+// typeName returns the name of the structure created from t
+func (c *StructRegistry) typeName(t reflect.Type) string {
+	if !isPageType(t) {
+		return t.Name()
+	}
+
+	// NOTE(patrik): The name of a generic type has the package paths of the
+	// type arguments, e.g. "Page[github.com/user/app.Track]", so pages is
+	// named after the items instead, e.g. "TrackPage"
+	item, _ := t.FieldByName("Items")
+	el := item.Type.Elem()
+	for el.Kind() == reflect.Pointer {
+		el = el.Elem()
+	}
+
+	if n, exists := c.names[el]; exists {
+		return n + "Page"
+	}
+
+	return strcase.ToCamel(el.Kind().String()) + "Page"
+}
+
 func (c *StructRegistry) TranslateName(t reflect.Type) (string, error) {
 	n, exists := c.names[t]
 	if !exists {
@@ -79,6 +110,16 @@ func (c *StructRegistry) check(t reflect.Type) error {
 		return nil
 	}
 
+	// NOTE(patrik): The items are registered first so the page can be
+	// named after them
+	if isPageType(t) {
+		item, _ := t.FieldByName("Items")
+		err := c.checkType(item.Type)
+		if err != nil {
+			return err
+		}
+	}
+
 	c.registerType(t)
 
 	for i := 0; i < t.NumField(); i++ {
@@ -88,6 +129,10 @@ func (c *StructRegistry) check(t reflect.Type) error {
 			continue
 		}
 
+		if _, _, skip := parseJsonTag(sf); skip {
+			continue
+		}
+
 		err := c.checkType(sf.Type)
 		if err != nil {
 			return err
@@ -180,23 +225,13 @@ func (c *StructRegistry) GetStructDecls() ([]StructDecl, error) {
 				continue
 			}
 
-			j := f.Tag.Get("json")
-
-			parts := strings.Split(j, ",")
-
-			jname := parts[0]
-			joptions := parts[1:]
-
-			omitEmpty := false
-
-			for _, v := range joptions {
-				if v == "omitempty" {
-					omitEmpty = true
-					break
-				}
+			jname, omitEmpty, skip := parseJsonTag(f)
+			if skip {
+				continue
 			}
 
 			ts := c.getType(f.Type)
+			optional, nullable := fieldPresence(f.Type, omitEmpty)
 
 			name := f.Name
 			if jname != "" {
@@ -204,9 +239,10 @@ func (c *StructRegistry) GetStructDecls() ([]StructDecl, error) {
 			}
 
 			fields = append(fields, &FieldDecl{
-				Name: name,
-				Type: ts,
-				OmitEmpty: omitEmpty,
+				Name:     name,
+				Type:     ts,
+				Optional: optional,
+				Nullable: nullable,
 			})
 		}
 
@@ -219,3 +255,44 @@ func (c *StructRegistry) GetStructDecls() ([]StructDecl, error) {
 
 	return res, nil
 }
+
+// parseJsonTag returns the name and the omitempty option from the json tag
+// of the field, skip is true when the field is ignored by encoding/json
+func parseJsonTag(f reflect.StructField) (name string, omitEmpty bool, skip bool) {
+	j := f.Tag.Get("json")
+	if j == "-" {
+		return "", false, true
+	}
+
+	parts := strings.Split(j, ",")
+
+	name = parts[0]
+	for _, v := range parts[1:] {
+		if v == "omitempty" {
+			omitEmpty = true
+			break
+		}
+	}
+
+	return name, omitEmpty, false
+}
+
+// fieldPresence follows the rules of encoding/json to figure out if a field
+// can be missing from the encoded object or be encoded as null
+func fieldPresence(t reflect.Type, omitEmpty bool) (optional bool, nullable bool) {
+	switch t.Kind() {
+	case reflect.Struct:
+		// NOTE(patrik): omitempty has no effect on structs
+		return false, false
+	case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map:
+		// NOTE(patrik): nil values are encoded as null unless they are
+		// omitted by omitempty
+		if omitEmpty {
+			return true, false
+		}
+
+		return false, true
+	default:
+		return omitEmpty, false
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	_ "embed"
 	"fmt"
+	"go/token"
 	"io"
 	"os"
 	"path"
+	"slices"
 	"strings"
 
 	"github.com/iancoleman/strcase"
@@ -40,7 +42,7 @@ func (g *GolangGenerator) Generate(serverDef *spark.ServerDef, resolver *spark.R
 	}
 
 	buf = &bytes.Buffer{}
-	err = g.generateClientCode(buf, serverDef)
+	err = g.generateClientCode(buf, serverDef, resolver)
 	if err != nil {
 		return err
 	}
@@ -84,6 +86,36 @@ func (g *GolangGenerator) mapFieldName(field *spark.ResolvedField) string {
 	return field.Name
 }
 
+// writeDoc writes doc as a GoDoc comment
+func writeDoc(w *spark.CodeWriter, doc string) {
+	if doc == "" {
+		return
+	}
+
+	for _, line := range strings.Split(doc, "\n") {
+		if line == "" {
+			w.IndentWritef("//\n")
+		} else {
+			w.IndentWritef("// %s\n", line)
+		}
+	}
+}
+
+func (g *GolangGenerator) writeEndpointDoc(w *spark.CodeWriter, e *spark.Endpoint) {
+	doc := e.FullDoc()
+
+	if e.Deprecated != nil {
+		if doc != "" {
+			doc += "\n\n"
+		}
+
+		replacement := g.mapName(e.Deprecated.Replacement)
+		doc += "Deprecated: " + e.Deprecated.DeprecationMessage(replacement)
+	}
+
+	writeDoc(w, doc)
+}
+
 func (g *GolangGenerator) generateTypeDefinitionCode(out io.Writer, resolver *spark.Resolver) error {
 	w := spark.NewCodeWriter(out, indent)
 
@@ -106,11 +138,19 @@ func (g *GolangGenerator) generateTypeDefinitionCode(out io.Writer, resolver *sp
 func (g *GolangGenerator) generateStruct(w *spark.CodeWriter, rs *spark.ResolvedStruct) error {
 	name := g.mapName(rs.Name)
 
+	if rs.Doc != "" {
+		writeDoc(w, rs.Doc)
+		w.IndentWritef("//\n")
+	}
 	w.IndentWritef("// Name: %s\n", rs.Name)
 	w.IndentWritef("type %s struct {\n", name)
 
 	w.Indent()
 	for _, field := range rs.Fields {
+		if field.Doc != "" {
+			writeDoc(w, field.Doc)
+			w.IndentWritef("//\n")
+		}
 		w.IndentWritef("// Name: %s\n", field.FullyQualifiedName)
 
 		err := w.WriteIndent()
@@ -161,15 +201,12 @@ func (g *GolangGenerator) generateFieldType(w *spark.CodeWriter, ty spark.FieldT
 func (g *GolangGenerator) generateField(w *spark.CodeWriter, field *spark.ResolvedField) {
 	name := strcase.ToCamel(g.mapFieldName(field))
 
-	_, isPointer := field.Type.(*spark.FieldTypePtr)
-
 	w.Writef("%s ", name)
 	g.generateFieldType(w, field.Type)
 	w.Writef(" `")
 	w.Writef("json:\"")
 	w.Writef("%s", field.Name)
-	// TODO(patrik): Should this be here?
-	if isPointer {
+	if field.Optional {
 		w.Writef(",omitempty")
 	}
 	w.Writef("\"")
@@ -203,6 +240,7 @@ func (g *GolangGenerator) generateApiEndpoint(w *spark.CodeWriter, e *spark.Endp
 
 	fmt.Fprintf(&b, "options Options")
 
+	g.writeEndpointDoc(w, e)
 	w.IndentWritef("func (c *Client) %v(%s) (*%s, error) {\n", name, b.String(), response)
 	w.Indent()
 
@@ -232,8 +270,26 @@ func (g *GolangGenerator) generateApiEndpoint(w *spark.CodeWriter, e *spark.Endp
 	w.IndentWritef("Url: url,\n")
 	w.IndentWritef("Method: \"%v\",\n", e.Method)
 	w.IndentWritef("ClientHeaders: c.Headers,\n")
+	w.IndentWritef("Codec: c.Codec,\n")
 	w.IndentWritef("Headers: options.Header,\n")
 
+	if len(e.Security) > 0 {
+		w.IndentWritef("Security: %s,\n", securityList(e.Security))
+		w.IndentWritef("Credentials: c.credentials,\n")
+	}
+
+	if len(e.RateLimits) > 0 {
+		w.IndentWritef("RateLimit: &c.RateLimit,\n")
+	}
+
+	if e.Idempotency != nil {
+		w.IndentWritef("Idempotent: true,\n")
+	}
+
+	if e.Cache != nil && e.Cache.Conditional {
+		w.IndentWritef("Cache: c.Cache,\n")
+	}
+
 	w.Unindent()
 	w.IndentWritef("}\n")
 
@@ -251,6 +307,165 @@ func (g *GolangGenerator) generateApiEndpoint(w *spark.CodeWriter, e *spark.Endp
 	return nil
 }
 
+// generatePageIterator generates a method that returns a PageIterator over
+// the items of every page of a paginated endpoint
+func (g *GolangGenerator) generatePageIterator(w *spark.CodeWriter, e *spark.Endpoint, resolver *spark.Resolver) error {
+	_, args := utils.ReplacePathArgs(e.Path, g.mapName, func(name string) string {
+		return "%v"
+	})
+
+	page, err := spark.ResolvePageFields(resolver, e.Response)
+	if err != nil {
+		return err
+	}
+
+	itemBuf := &strings.Builder{}
+	itemWriter := spark.NewCodeWriter(itemBuf, indent)
+	g.generateFieldType(&itemWriter, page.ItemType())
+	item := itemBuf.String()
+
+	field := func(f spark.ResolvedField) string {
+		return strcase.ToCamel(g.mapFieldName(&f))
+	}
+
+	// NOTE(patrik): The offset fields of pyrin.Page is pointers so cursor
+	// pages can leave them out
+	value := func(f spark.ResolvedField) string {
+		if _, ok := f.Type.(*spark.FieldTypePtr); ok {
+			return "valueOrZero(res." + field(f) + ")"
+		}
+
+		return "res." + field(f)
+	}
+
+	name := g.mapName(e.Name)
+	body := g.mapName(e.Body)
+
+	params := strings.Builder{}
+	callArgs := strings.Builder{}
+
+	for _, v := range args {
+		fmt.Fprintf(&params, "%s string, ", v)
+		fmt.Fprintf(&callArgs, "%s, ", v)
+	}
+
+	if body != "" {
+		fmt.Fprintf(&params, "body %s, ", body)
+		fmt.Fprintf(&callArgs, "body, ")
+	}
+
+	writeDoc(w, fmt.Sprintf("Iterate%s walks every page of %s", name, name))
+	w.IndentWritef("func (c *Client) Iterate%s(%soptions Options) *PageIterator[%s] {\n", name, params.String(), item)
+	w.Indent()
+
+	w.IndentWritef("return NewPageIterator(%q, options, func(options Options) ([]%s, PageInfo, error) {\n", e.Pagination.Style, item)
+	w.Indent()
+
+	w.IndentWritef("res, err := c.%s(%soptions)\n", name, callArgs.String())
+	w.IndentWritef("if err != nil {\n")
+	w.Indent()
+	w.IndentWritef("return nil, PageInfo{}, err\n")
+	w.Unindent()
+	w.IndentWritef("}\n")
+
+	w.Writef("\n")
+
+	w.IndentWritef("info := PageInfo{\n")
+	w.Indent()
+	w.IndentWritef("Page: %s,\n", value(page.Page))
+	w.IndentWritef("TotalPages: %s,\n", value(page.TotalPages))
+	w.IndentWritef("NextCursor: res.%s,\n", field(page.NextCursor))
+	w.Unindent()
+	w.IndentWritef("}\n")
+
+	w.IndentWritef("return res.%s, info, nil\n", field(page.Items))
+
+	w.Unindent()
+	w.IndentWritef("})\n")
+
+	w.Unindent()
+	w.IndentWritef("}\n")
+
+	return nil
+}
+
+// formFileArgs returns the names of the arguments for the files of the
+// form, the names can't collide with the other arguments and the variables
+// of the generated method
+func formFileArgs(files []spark.FormFileDef, pathArgs []string) []string {
+	used := map[string]bool{
+		"c": true, "body": true, "options": true, "path": true,
+		"url": true, "err": true, "data": true,
+	}
+
+	for _, arg := range pathArgs {
+		used[arg] = true
+	}
+
+	res := make([]string, 0, len(files))
+	for _, file := range files {
+		name := strcase.ToLowerCamel(file.Name)
+		if name == "" || token.IsKeyword(name) || used[name] {
+			name += "Files"
+		}
+
+		used[name] = true
+		res = append(res, name)
+	}
+
+	return res
+}
+
+func (g *GolangGenerator) generateFormSpec(w *spark.CodeWriter, form *spark.FormDef) {
+	w.IndentWritef("Form: &FormSpec{\n")
+	w.Indent()
+
+	if form.MaxTotalSize > 0 {
+		w.IndentWritef("MaxTotalSize: %d,\n", form.MaxTotalSize)
+	}
+
+	if len(form.Files) > 0 {
+		w.IndentWritef("Files: []FormFileSpec{\n")
+		w.Indent()
+
+		for _, file := range form.Files {
+			w.IndentWritef("{\n")
+			w.Indent()
+
+			w.IndentWritef("Name: %q,\n", file.Name)
+
+			if file.MinFiles > 0 {
+				w.IndentWritef("MinFiles: %d,\n", file.MinFiles)
+			}
+
+			if file.Optional {
+				w.IndentWritef("Optional: true,\n")
+			}
+
+			if file.MaxFiles > 0 {
+				w.IndentWritef("MaxFiles: %d,\n", file.MaxFiles)
+			}
+
+			if file.MaxFileSize > 0 {
+				w.IndentWritef("MaxFileSize: %d,\n", file.MaxFileSize)
+			}
+
+			if len(file.AllowedMimeTypes) > 0 {
+				w.IndentWritef("AllowedMimeTypes: %#v,\n", file.AllowedMimeTypes)
+			}
+
+			w.Unindent()
+			w.IndentWritef("},\n")
+		}
+
+		w.Unindent()
+		w.IndentWritef("},\n")
+	}
+
+	w.Unindent()
+	w.IndentWritef("},\n")
+}
+
 func (g *GolangGenerator) generateFormEndpoint(w *spark.CodeWriter, e *spark.Endpoint) error {
 	newPath, args := utils.ReplacePathArgs(e.Path, g.mapName, func(name string) string {
 		return "%v"
@@ -258,23 +473,36 @@ func (g *GolangGenerator) generateFormEndpoint(w *spark.CodeWriter, e *spark.End
 
 	name := g.mapName(e.Name)
 	response := g.mapName(e.Response)
-	// body := g.mapName(e.Body)
+	body := g.mapName(e.Body)
 
 	if response == "" {
 		response = "any"
 	}
 
+	var files []spark.FormFileDef
+	if e.Form != nil {
+		files = e.Form.Files
+	}
+
+	fileArgs := formFileArgs(files, args)
+
 	b := strings.Builder{}
 
 	for _, v := range args {
 		fmt.Fprintf(&b, "%s string, ", v)
 	}
 
-	fmt.Fprintf(&b, "boundary string, ")
-	fmt.Fprintf(&b, "body Reader, ")
+	if body != "" {
+		fmt.Fprintf(&b, "body %s, ", body)
+	}
+
+	for _, arg := range fileArgs {
+		fmt.Fprintf(&b, "%s []FormFile, ", arg)
+	}
 
 	fmt.Fprintf(&b, "options Options")
 
+	g.writeEndpointDoc(w, e)
 	w.IndentWritef("func (c *Client) %v(%s) (*%s, error) {\n", name, b.String(), response)
 	w.Indent()
 
@@ -304,12 +532,43 @@ func (g *GolangGenerator) generateFormEndpoint(w *spark.CodeWriter, e *spark.End
 	w.IndentWritef("Url: url,\n")
 	w.IndentWritef("Method: \"%v\",\n", e.Method)
 	w.IndentWritef("ClientHeaders: c.Headers,\n")
+	w.IndentWritef("Codec: c.Codec,\n")
 	w.IndentWritef("Headers: options.Header,\n")
 
+	if len(e.Security) > 0 {
+		w.IndentWritef("Security: %s,\n", securityList(e.Security))
+		w.IndentWritef("Credentials: c.credentials,\n")
+	}
+
+	if len(e.RateLimits) > 0 {
+		w.IndentWritef("RateLimit: &c.RateLimit,\n")
+	}
+
+	if e.Idempotency != nil {
+		w.IndentWritef("Idempotent: true,\n")
+	}
+
+	// NOTE(patrik): The check reads the whole body into memory so it's
+	// skipped for streaming endpoints
+	if e.Form.HasConstraints() && !e.Form.Streaming {
+		g.generateFormSpec(w, e.Form)
+	}
+
 	w.Unindent()
 	w.IndentWritef("}\n")
 
-	w.IndentWritef("return RequestForm[%s](data, boundary, body)\n", response)
+	bodyArg := "nil"
+	if body != "" {
+		bodyArg = "body"
+	}
+
+	w.IndentWritef("return RequestFormFiles[%s](data, %s, []FormField{\n", response, bodyArg)
+	w.Indent()
+	for i, file := range files {
+		w.IndentWritef("{Name: %q, Files: %s},\n", file.Name, fileArgs[i])
+	}
+	w.Unindent()
+	w.IndentWritef("})\n")
 
 	w.Unindent()
 	w.IndentWritef("}\n")
@@ -317,6 +576,262 @@ func (g *GolangGenerator) generateFormEndpoint(w *spark.CodeWriter, e *spark.End
 	return nil
 }
 
+func (g *GolangGenerator) generateDownloadEndpoint(w *spark.CodeWriter, e *spark.Endpoint) error {
+	newPath, args := utils.ReplacePathArgs(e.Path, g.mapName, func(name string) string {
+		return "%v"
+	})
+
+	name := g.mapName(e.Name)
+
+	b := strings.Builder{}
+
+	for _, v := range args {
+		fmt.Fprintf(&b, "%s string, ", v)
+	}
+
+	fmt.Fprintf(&b, "options Options")
+
+	g.writeEndpointDoc(w, e)
+	w.IndentWritef("func (c *Client) %v(%s) (*DownloadResponse, error) {\n", name, b.String())
+	w.Indent()
+
+	if len(args) > 0 {
+		b := strings.Builder{}
+		for _, v := range args {
+			fmt.Fprintf(&b, ", %s", v)
+		}
+
+		w.IndentWritef("path := Sprintf(\"%v\"%s)\n", newPath, b.String())
+	} else {
+		w.IndentWritef("path := \"%v\"\n", e.Path)
+	}
+
+	w.IndentWritef("url, err := createUrl(c.addr, path, options.Query)\n")
+	w.IndentWritef("if err != nil {\n")
+	w.Indent()
+	w.IndentWritef("return nil, err\n")
+	w.Unindent()
+	w.IndentWritef("}\n")
+
+	w.Writef("\n")
+
+	w.IndentWritef("data := RequestData{\n")
+	w.Indent()
+
+	w.IndentWritef("Url: url,\n")
+	w.IndentWritef("Method: \"%v\",\n", e.Method)
+	w.IndentWritef("ClientHeaders: c.Headers,\n")
+	w.IndentWritef("Codec: c.Codec,\n")
+	w.IndentWritef("Headers: options.Header,\n")
+
+	if len(e.Security) > 0 {
+		w.IndentWritef("Security: %s,\n", securityList(e.Security))
+		w.IndentWritef("Credentials: c.credentials,\n")
+	}
+
+	if len(e.RateLimits) > 0 {
+		w.IndentWritef("RateLimit: &c.RateLimit,\n")
+	}
+
+	w.Unindent()
+	w.IndentWritef("}\n")
+
+	w.IndentWritef("return Download(data)\n")
+
+	w.Unindent()
+	w.IndentWritef("}\n")
+
+	return nil
+}
+
+func (g *GolangGenerator) generateUploadEndpoint(w *spark.CodeWriter, e *spark.Endpoint) error {
+	newPath, args := utils.ReplacePathArgs(e.Path, g.mapName, func(name string) string {
+		return "%v"
+	})
+
+	name := g.mapName(e.Name)
+	response := g.mapName(e.Response)
+
+	if response == "" {
+		response = "any"
+	}
+
+	b := strings.Builder{}
+
+	for _, v := range args {
+		fmt.Fprintf(&b, "%s string, ", v)
+	}
+
+	fmt.Fprintf(&b, "content ReadSeeker, upload UploadOptions, options Options")
+
+	g.writeEndpointDoc(w, e)
+	w.IndentWritef("func (c *Client) %v(%s) (*%s, error) {\n", name, b.String(), response)
+	w.Indent()
+
+	if len(args) > 0 {
+		b := strings.Builder{}
+		for _, v := range args {
+			fmt.Fprintf(&b, ", %s", v)
+		}
+
+		w.IndentWritef("path := Sprintf(\"%v\"%s)\n", newPath, b.String())
+	} else {
+		w.IndentWritef("path := \"%v\"\n", e.Path)
+	}
+
+	w.IndentWritef("url, err := createUrl(c.addr, path, options.Query)\n")
+	w.IndentWritef("if err != nil {\n")
+	w.Indent()
+	w.IndentWritef("return nil, err\n")
+	w.Unindent()
+	w.IndentWritef("}\n")
+
+	w.Writef("\n")
+
+	w.IndentWritef("data := RequestData{\n")
+	w.Indent()
+
+	w.IndentWritef("Url: url,\n")
+	w.IndentWritef("Method: \"%v\",\n", e.Method)
+	w.IndentWritef("ClientHeaders: c.Headers,\n")
+	w.IndentWritef("Codec: c.Codec,\n")
+	w.IndentWritef("Headers: options.Header,\n")
+
+	if len(e.Security) > 0 {
+		w.IndentWritef("Security: %s,\n", securityList(e.Security))
+		w.IndentWritef("Credentials: c.credentials,\n")
+	}
+
+	if len(e.RateLimits) > 0 {
+		w.IndentWritef("RateLimit: &c.RateLimit,\n")
+	}
+
+	w.Unindent()
+	w.IndentWritef("}\n")
+
+	w.IndentWritef("return ResumableUpload[%s](data, content, upload)\n", response)
+
+	w.Unindent()
+	w.IndentWritef("}\n")
+
+	return nil
+}
+
+// generateJobEndpoint generates the method that starts the job and the
+// methods that reads, cancels and awaits the jobs of the endpoint
+func (g *GolangGenerator) generateJobEndpoint(w *spark.CodeWriter, e *spark.Endpoint) error {
+	newPath, args := utils.ReplacePathArgs(e.Path, g.mapName, func(name string) string {
+		return "%v"
+	})
+
+	name := g.mapName(e.Name)
+	result := g.mapName(e.Response)
+	body := g.mapName(e.Body)
+
+	if result == "" {
+		result = "any"
+	}
+
+	writeMethod := func(methodName, params, returnType, method, subPath string, call func()) {
+		b := strings.Builder{}
+
+		for _, v := range args {
+			fmt.Fprintf(&b, "%s string, ", v)
+		}
+
+		b.WriteString(params)
+		b.WriteString("options Options")
+
+		w.IndentWritef("func (c *Client) %v(%s) (*%s, error) {\n", methodName, b.String(), returnType)
+		w.Indent()
+
+		pathArgs := args
+		if subPath != "" {
+			pathArgs = append(slices.Clone(args), "jobId")
+		}
+
+		if len(pathArgs) > 0 {
+			b := strings.Builder{}
+			for _, v := range pathArgs {
+				fmt.Fprintf(&b, ", %s", v)
+			}
+
+			w.IndentWritef("path := Sprintf(\"%v%s\"%s)\n", newPath, subPath, b.String())
+		} else {
+			w.IndentWritef("path := \"%v\"\n", e.Path)
+		}
+
+		w.IndentWritef("url, err := createUrl(c.addr, path, options.Query)\n")
+		w.IndentWritef("if err != nil {\n")
+		w.Indent()
+		w.IndentWritef("return nil, err\n")
+		w.Unindent()
+		w.IndentWritef("}\n")
+
+		w.Writef("\n")
+
+		w.IndentWritef("data := RequestData{\n")
+		w.Indent()
+
+		w.IndentWritef("Url: url,\n")
+		w.IndentWritef("Method: \"%v\",\n", method)
+		w.IndentWritef("ClientHeaders: c.Headers,\n")
+		w.IndentWritef("Codec: c.Codec,\n")
+		w.IndentWritef("Headers: options.Header,\n")
+
+		if len(e.Security) > 0 {
+			w.IndentWritef("Security: %s,\n", securityList(e.Security))
+			w.IndentWritef("Credentials: c.credentials,\n")
+		}
+
+		if len(e.RateLimits) > 0 {
+			w.IndentWritef("RateLimit: &c.RateLimit,\n")
+		}
+
+		w.Unindent()
+		w.IndentWritef("}\n")
+
+		call()
+
+		w.Unindent()
+		w.IndentWritef("}\n")
+	}
+
+	job := fmt.Sprintf("Job[%s]", result)
+
+	bodyParam := ""
+	bodyArg := "nil"
+	if body != "" {
+		bodyParam = fmt.Sprintf("body %s, ", body)
+		bodyArg = "body"
+	}
+
+	g.writeEndpointDoc(w, e)
+	writeMethod(name, bodyParam, job, e.Method, "", func() {
+		w.IndentWritef("return Request[%s](data, %s)\n", job, bodyArg)
+	})
+
+	w.Writef("\n")
+	writeDoc(w, fmt.Sprintf("Get%sJob returns a job started by %s", name, name))
+	writeMethod("Get"+name+"Job", "jobId string, ", job, "GET", "/%v", func() {
+		w.IndentWritef("return Request[%s](data, nil)\n", job)
+	})
+
+	w.Writef("\n")
+	writeDoc(w, fmt.Sprintf("Cancel%sJob cancels a job started by %s", name, name))
+	writeMethod("Cancel"+name+"Job", "jobId string, ", job, "POST", "/%v/cancel", func() {
+		w.IndentWritef("return Request[%s](data, nil)\n", job)
+	})
+
+	w.Writef("\n")
+	writeDoc(w, fmt.Sprintf("Await%sJob waits for a job started by %s and returns the result", name, name))
+	writeMethod("Await"+name+"Job", "jobId string, job JobOptions, ", result, "GET", "/%v", func() {
+		w.IndentWritef("return AwaitJob[%s](data, job)\n", result)
+	})
+
+	return nil
+}
+
 func (g *GolangGenerator) generateUrlForEndpoint(w *spark.CodeWriter, e *spark.Endpoint) error {
 	newPath, args := utils.ReplacePathArgs(e.Path, g.mapName, func(name string) string {
 		return "%v"
@@ -334,6 +849,7 @@ func (g *GolangGenerator) generateUrlForEndpoint(w *spark.CodeWriter, e *spark.E
 		fmt.Fprintf(&b, "%s string", v)
 	}
 
+	g.writeEndpointDoc(w, e)
 	w.IndentWritef("func (c *ClientUrls) %v(%s) (*URL, error) {\n", name, b.String())
 	w.Indent()
 
@@ -356,13 +872,78 @@ func (g *GolangGenerator) generateUrlForEndpoint(w *spark.CodeWriter, e *spark.E
 	return nil
 }
 
-func (g *GolangGenerator) generateClientCode(w io.Writer, serverDef *spark.ServerDef) error {
+func securityList(security []string) string {
+	var b strings.Builder
+
+	b.WriteString("[]string{")
+	for i, name := range security {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+
+		fmt.Fprintf(&b, "%q", name)
+	}
+	b.WriteString("}")
+
+	return b.String()
+}
+
+func (g *GolangGenerator) generateSecurityHelper(w *spark.CodeWriter, scheme *spark.SecuritySchemeDef) {
+	name := strcase.ToCamel(scheme.Name)
+
+	switch scheme.Type {
+	case "bearer":
+		w.IndentWritef("func (c *Client) Set%sToken(token string) {\n", name)
+		w.Indent()
+		w.IndentWritef("c.setCredential(%q, token)\n", scheme.Name)
+	case "apiKey":
+		w.IndentWritef("func (c *Client) Set%sApiKey(apiKey string) {\n", name)
+		w.Indent()
+		w.IndentWritef("c.setCredential(%q, apiKey)\n", scheme.Name)
+	case "basic":
+		w.IndentWritef("func (c *Client) Set%sCredentials(username, password string) {\n", name)
+		w.Indent()
+		w.IndentWritef("c.setCredential(%q, basicCredentials(username, password))\n", scheme.Name)
+	case "cookie":
+		w.IndentWritef("func (c *Client) Set%sCookie(value string) {\n", name)
+		w.Indent()
+		w.IndentWritef("c.setCredential(%q, value)\n", scheme.Name)
+	default:
+		return
+	}
+
+	w.Unindent()
+	w.IndentWritef("}\n")
+}
+
+func (g *GolangGenerator) generateClientCode(w io.Writer, serverDef *spark.ServerDef, resolver *spark.Resolver) error {
 	cw := spark.NewCodeWriter(w, indent)
 
 	cw.IndentWritef("// DO NOT EDIT THIS: This file was generated by the Pyrin Golang Generator\n")
 	cw.IndentWritef("package api\n")
 	cw.Writef("\n")
 
+	envelope, err := serverDef.ResponseEnvelope()
+	if err != nil {
+		return err
+	}
+
+	cw.IndentWritef("const responseEnvelope = %q\n", envelope)
+	cw.Writef("\n")
+
+	cw.IndentWritef("var securitySchemes = map[string]SecurityScheme{\n")
+	cw.Indent()
+	for _, scheme := range serverDef.SecuritySchemes {
+		cw.IndentWritef("%q: {Type: %q, In: %q, ParamName: %q},\n", scheme.Name, scheme.Type, scheme.In, scheme.ParamName)
+	}
+	cw.Unindent()
+	cw.IndentWritef("}\n")
+
+	for _, scheme := range serverDef.SecuritySchemes {
+		cw.Writef("\n")
+		g.generateSecurityHelper(&cw, &scheme)
+	}
+
 	for _, endpoint := range serverDef.Endpoints {
 		cw.IndentWritef("\n")
 
@@ -372,11 +953,35 @@ func (g *GolangGenerator) generateClientCode(w io.Writer, serverDef *spark.Serve
 			if err != nil {
 				return err
 			}
+
+			if endpoint.Pagination != nil {
+				cw.Writef("\n")
+
+				err := g.generatePageIterator(&cw, &endpoint, resolver)
+				if err != nil {
+					return err
+				}
+			}
 		case spark.EndpointTypeForm:
 			err := g.generateFormEndpoint(&cw, &endpoint)
 			if err != nil {
 				return err
 			}
+		case spark.EndpointTypeDownload:
+			err := g.generateDownloadEndpoint(&cw, &endpoint)
+			if err != nil {
+				return err
+			}
+		case spark.EndpointTypeUpload:
+			err := g.generateUploadEndpoint(&cw, &endpoint)
+			if err != nil {
+				return err
+			}
+		case spark.EndpointTypeJob:
+			err := g.generateJobEndpoint(&cw, &endpoint)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
@@ -41,11 +41,26 @@ type ResolvedField struct {
 	FullyQualifiedName string
 	Name               string
 	Type               FieldType
-	OmitEmpty          bool
+	// Optional is true when the field may be absent from the JSON object
+	Optional bool
+	// Nullable is true when the field may be present with the value null
+	Nullable bool
+	Doc      string
+}
+
+// BaseType returns the type of the field without the outer pointer, the
+// nullability of the field itself is described by Nullable.
+func (f *ResolvedField) BaseType() FieldType {
+	if ptr, ok := f.Type.(*FieldTypePtr); ok {
+		return ptr.BaseType
+	}
+
+	return f.Type
 }
 
 type ResolvedStruct struct {
 	Name   string
+	Doc    string
 	Fields []ResolvedField
 }
 
@@ -158,7 +173,9 @@ func (resolver *Resolver) ResolveField(decl *StructDecl, field *FieldDecl) (Reso
 		FullyQualifiedName: fmt.Sprintf("%s.%s", decl.Name, field.Name),
 		Name:               field.Name,
 		Type:               ty,
-		OmitEmpty:          field.OmitEmpty,
+		Optional:           field.Optional,
+		Nullable:           field.Nullable,
+		Doc:                field.Doc,
 	}, nil
 }
 
@@ -199,17 +216,25 @@ func (resolver *Resolver) resolveExtendedStruct(decl *StructDecl) (*ResolvedStru
 
 		if found {
 			fields[index].Type = ty
+			fields[index].Optional = df.Optional
+			fields[index].Nullable = df.Nullable
+			if df.Doc != "" {
+				fields[index].Doc = df.Doc
+			}
 		} else {
 			fields = append(fields, ResolvedField{
-				Name:      df.Name,
-				Type:      ty,
-				OmitEmpty: df.OmitEmpty,
+				Name:     df.Name,
+				Type:     ty,
+				Optional: df.Optional,
+				Nullable: df.Nullable,
+				Doc:      df.Doc,
 			})
 		}
 	}
 
 	return &ResolvedStruct{
 		Name:   decl.Name,
+		Doc:    decl.Doc,
 		Fields: fields,
 	}, nil
 }
@@ -231,6 +256,7 @@ func (resolver *Resolver) resolveStruct(decl *StructDecl) (*ResolvedStruct, erro
 
 	return &ResolvedStruct{
 		Name:   decl.Name,
+		Doc:    decl.Doc,
 		Fields: fields,
 	}, nil
 }
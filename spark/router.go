@@ -2,14 +2,20 @@ package spark
 
 import (
 	"strings"
+	"time"
 
 	"github.com/nanoteck137/pyrin"
+	"github.com/nanoteck137/pyrin/chisel"
 )
 
 var _ pyrin.Router = (*Router)(nil)
 
 type Router struct {
 	Routes []Route
+
+	// Envelope needs to be the same as the envelope of the server, defaults
+	// to pyrin.DefaultEnvelope
+	Envelope pyrin.Envelope
 }
 
 func (r *Router) AddRoute(route Route) {
@@ -17,9 +23,11 @@ func (r *Router) AddRoute(route Route) {
 }
 
 func (r *Router) Group(
-	prefix string, 
+	prefix string,
 	middlewares ...pyrin.MiddlewareFunc,
 ) pyrin.Group {
+	// NOTE(patrik): Plain middlewares can't be inspected so only the
+	// metadata added with With is recorded, see pyrin.Router
 	return NewRouteGroup(r, prefix)
 }
 
@@ -31,9 +39,21 @@ type ApiRoute struct {
 	Name         string
 	Path         string
 	Method       string
+	Summary      string
+	Description  string
+	Tags         []string
+	Deprecated   *pyrin.Deprecation
+	Meta         map[string]string
+	Security     []*pyrin.SecurityScheme
+	RateLimits   []*pyrin.RateLimitPolicy
+	Idempotency  *pyrin.IdempotencyPolicy
+	Cache        *pyrin.CachePolicy
+	Pagination   *pyrin.PaginationPolicy
+	Filter       *chisel.Schema
 	ErrorTypes   []pyrin.ErrorType
 	ResponseType any
 	BodyType     any
+	Status       int
 }
 
 func (r ApiRoute) routeType() {}
@@ -42,24 +62,101 @@ type FormApiRoute struct {
 	Name         string
 	Path         string
 	Method       string
+	Summary      string
+	Description  string
+	Tags         []string
+	Deprecated   *pyrin.Deprecation
+	Meta         map[string]string
+	Security     []*pyrin.SecurityScheme
+	RateLimits   []*pyrin.RateLimitPolicy
 	ErrorTypes   []pyrin.ErrorType
 	ResponseType any
 	Spec         pyrin.FormSpec
+	Streaming    bool
+	Status       int
 }
 
 func (r FormApiRoute) routeType() {}
 
+type DownloadRoute struct {
+	Name        string
+	Path        string
+	Method      string
+	Summary     string
+	Description string
+	Tags        []string
+	Deprecated  *pyrin.Deprecation
+	Meta        map[string]string
+	Security    []*pyrin.SecurityScheme
+	RateLimits  []*pyrin.RateLimitPolicy
+	ErrorTypes  []pyrin.ErrorType
+	ContentType string
+	Filename    string
+	Inline      bool
+	Digest      bool
+}
+
+func (r DownloadRoute) routeType() {}
+
+type UploadRoute struct {
+	Name            string
+	Path            string
+	Summary         string
+	Description     string
+	Tags            []string
+	Deprecated      *pyrin.Deprecation
+	Meta            map[string]string
+	Security        []*pyrin.SecurityScheme
+	RateLimits      []*pyrin.RateLimitPolicy
+	ErrorTypes      []pyrin.ErrorType
+	ResponseType    any
+	MaxSize         int64
+	Expiry          time.Duration
+	RequireChecksum bool
+}
+
+func (r UploadRoute) routeType() {}
+
+type JobRoute struct {
+	Name         string
+	Method       string
+	Path         string
+	Summary      string
+	Description  string
+	Tags         []string
+	Deprecated   *pyrin.Deprecation
+	Meta         map[string]string
+	Security     []*pyrin.SecurityScheme
+	RateLimits   []*pyrin.RateLimitPolicy
+	ErrorTypes   []pyrin.ErrorType
+	ResultType   any
+	BodyType     any
+	PollInterval time.Duration
+}
+
+func (r JobRoute) routeType() {}
+
 type NormalRoute struct {
-	Name   string
-	Path   string
-	Method string
+	Name        string
+	Path        string
+	Method      string
+	Summary     string
+	Description string
+	Tags        []string
+	Deprecated  *pyrin.Deprecation
+	Meta        map[string]string
+	Security    []*pyrin.SecurityScheme
+	RateLimits  []*pyrin.RateLimitPolicy
 }
 
 func (r NormalRoute) routeType() {}
 
 type RouteGroup struct {
-	Router *Router
-	Prefix string
+	Router     *Router
+	Prefix     string
+	Meta       map[string]string
+	Security   []*pyrin.SecurityScheme
+	RateLimits []*pyrin.RateLimitPolicy
 }
 
 func joinPaths(prefix, path string) string {
@@ -73,6 +170,84 @@ func NewRouteGroup(router *Router, prefix string) *RouteGroup {
 	}
 }
 
+func copyMeta(meta map[string]string) map[string]string {
+	if meta == nil {
+		return nil
+	}
+
+	res := make(map[string]string, len(meta))
+	for k, v := range meta {
+		res[k] = v
+	}
+
+	return res
+}
+
+func (r *RouteGroup) Group(
+	prefix string,
+	middlewares ...pyrin.MiddlewareFunc,
+) pyrin.Group {
+	return &RouteGroup{
+		Router:     r.Router,
+		Prefix:     joinPaths(r.Prefix, prefix),
+		Meta:       copyMeta(r.Meta),
+		Security:   r.Security,
+		RateLimits: r.RateLimits,
+	}
+}
+
+func (r *RouteGroup) With(middlewares ...pyrin.Middleware) pyrin.Group {
+	meta := copyMeta(r.Meta)
+	security := r.Security
+
+	rateLimits := make([]*pyrin.RateLimitPolicy, 0, len(r.RateLimits))
+	rateLimits = append(rateLimits, r.RateLimits...)
+
+	for _, m := range middlewares {
+		switch m := m.(type) {
+		case pyrin.MetaMiddleware:
+			if meta == nil {
+				meta = make(map[string]string, len(m.Meta))
+			}
+
+			for k, v := range m.Meta {
+				meta[k] = v
+			}
+		case pyrin.SecurityMiddleware:
+			security = m.Schemes
+		case *pyrin.RateLimitPolicy:
+			rateLimits = append(rateLimits, m)
+		}
+	}
+
+	return &RouteGroup{
+		Router:     r.Router,
+		Prefix:     r.Prefix,
+		Meta:       meta,
+		Security:   security,
+		RateLimits: rateLimits,
+	}
+}
+
+func (r *RouteGroup) security(schemes []*pyrin.SecurityScheme) []*pyrin.SecurityScheme {
+	if schemes != nil {
+		return schemes
+	}
+
+	return r.Security
+}
+
+func (r *RouteGroup) rateLimits(policy *pyrin.RateLimitPolicy) []*pyrin.RateLimitPolicy {
+	res := make([]*pyrin.RateLimitPolicy, 0, len(r.RateLimits)+1)
+	res = append(res, r.RateLimits...)
+
+	if policy != nil {
+		res = append(res, policy)
+	}
+
+	return res
+}
+
 func (r *RouteGroup) Register(handlers ...pyrin.Handler) {
 	for _, h := range handlers {
 		switch h := h.(type) {
@@ -83,11 +258,23 @@ func (r *RouteGroup) Register(handlers ...pyrin.Handler) {
 
 			r.Router.AddRoute(ApiRoute{
 				Name:         h.Name,
-			Path:         joinPaths(r.Prefix, h.Path),
-			Method:       h.Method,
-			ErrorTypes:   h.Errors,
-			ResponseType: h.ResponseType,
-			BodyType:     h.BodyType,
+				Path:         joinPaths(r.Prefix, h.Path),
+				Method:       h.Method,
+				Summary:      h.Summary,
+				Description:  h.Description,
+				Tags:         h.Tags,
+				Deprecated:   h.Deprecated,
+				Meta:         copyMeta(r.Meta),
+				Security:     r.security(h.Security),
+				RateLimits:   r.rateLimits(h.RateLimit),
+				Idempotency:  h.Idempotency,
+				Cache:        h.Cache,
+				Pagination:   h.Pagination,
+				Filter:       h.Filter,
+				ErrorTypes:   h.Errors,
+				ResponseType: h.ResponseType,
+				BodyType:     h.BodyType,
+				Status:       h.Status,
 			})
 		case pyrin.FormApiHandler:
 			if h.Name == "" {
@@ -96,11 +283,84 @@ func (r *RouteGroup) Register(handlers ...pyrin.Handler) {
 
 			r.Router.AddRoute(FormApiRoute{
 				Name:         h.Name,
-			Path:         joinPaths(r.Prefix, h.Path),
-			Method:       h.Method,
-			ErrorTypes:   h.Errors,
-			ResponseType: h.ResponseType,
-			Spec:         h.Spec,
+				Path:         joinPaths(r.Prefix, h.Path),
+				Method:       h.Method,
+				Summary:      h.Summary,
+				Description:  h.Description,
+				Tags:         h.Tags,
+				Deprecated:   h.Deprecated,
+				Meta:         copyMeta(r.Meta),
+				Security:     r.security(h.Security),
+				RateLimits:   r.rateLimits(h.RateLimit),
+				ErrorTypes:   h.Errors,
+				ResponseType: h.ResponseType,
+				Spec:         h.Spec,
+				Streaming:    h.Streaming,
+				Status:       h.Status,
+			})
+		case pyrin.DownloadHandler:
+			if h.Name == "" {
+				continue
+			}
+
+			r.Router.AddRoute(DownloadRoute{
+				Name:        h.Name,
+				Path:        joinPaths(r.Prefix, h.Path),
+				Method:      h.Method,
+				Summary:     h.Summary,
+				Description: h.Description,
+				Tags:        h.Tags,
+				Deprecated:  h.Deprecated,
+				Meta:        copyMeta(r.Meta),
+				Security:    r.security(h.Security),
+				RateLimits:  r.rateLimits(h.RateLimit),
+				ErrorTypes:  h.Errors,
+				ContentType: h.ContentType,
+				Filename:    h.Filename,
+				Inline:      h.Inline,
+				Digest:      h.ComputeDigest,
+			})
+		case pyrin.UploadHandler:
+			if h.Name == "" {
+				continue
+			}
+
+			r.Router.AddRoute(UploadRoute{
+				Name:            h.Name,
+				Path:            joinPaths(r.Prefix, h.Path),
+				Summary:         h.Summary,
+				Description:     h.Description,
+				Tags:            h.Tags,
+				Deprecated:      h.Deprecated,
+				Meta:            copyMeta(r.Meta),
+				Security:        r.security(h.Security),
+				RateLimits:      r.rateLimits(h.RateLimit),
+				ErrorTypes:      h.Errors,
+				ResponseType:    h.ResponseType,
+				MaxSize:         h.MaxSize,
+				Expiry:          h.Expiry,
+				RequireChecksum: h.RequireChecksum,
+			})
+		case pyrin.JobHandler:
+			if h.Name == "" {
+				continue
+			}
+
+			r.Router.AddRoute(JobRoute{
+				Name:         h.Name,
+				Method:       h.Method,
+				Path:         joinPaths(r.Prefix, h.Path),
+				Summary:      h.Summary,
+				Description:  h.Description,
+				Tags:         h.Tags,
+				Deprecated:   h.Deprecated,
+				Meta:         copyMeta(r.Meta),
+				Security:     r.security(h.Security),
+				RateLimits:   r.rateLimits(h.RateLimit),
+				ErrorTypes:   h.Errors,
+				ResultType:   h.ResultType,
+				BodyType:     h.BodyType,
+				PollInterval: h.PollInterval,
 			})
 		case pyrin.NormalHandler:
 			if h.Name == "" {
@@ -108,9 +368,16 @@ func (r *RouteGroup) Register(handlers ...pyrin.Handler) {
 			}
 
 			r.Router.AddRoute(NormalRoute{
-				Name:   h.Name,
-				Path:   joinPaths(r.Prefix, h.Path),
-				Method: h.Method,
+				Name:        h.Name,
+				Path:        joinPaths(r.Prefix, h.Path),
+				Method:      h.Method,
+				Summary:     h.Summary,
+				Description: h.Description,
+				Tags:        h.Tags,
+				Deprecated:  h.Deprecated,
+				Meta:        copyMeta(r.Meta),
+				Security:    r.security(h.Security),
+				RateLimits:  r.rateLimits(h.RateLimit),
 			})
 		}
 	}
@@ -5,11 +5,15 @@ import (
 	"fmt"
 	goast "go/ast"
 	goparser "go/parser"
+	"net/http"
 	"os"
 	"reflect"
 	"sort"
+	"strings"
 
 	"github.com/maruel/natural"
+	"github.com/nanoteck137/pyrin"
+	"github.com/nanoteck137/pyrin/chisel"
 )
 
 type Generator interface {
@@ -17,13 +21,26 @@ type Generator interface {
 }
 
 type StructFieldDef struct {
-	Name      string `json:"name"`
-	Type      string `json:"type"`
-	OmitEmpty bool   `json:"omitEmpty"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Optional is true when the field may be absent
+	Optional bool `json:"optional"`
+	// Nullable is true when the field may be null
+	Nullable bool `json:"nullable"`
+
+	// NOTE(patrik): Only used by ServerDefVersion1, use Optional and
+	// Nullable instead
+	OmitEmpty bool `json:"omitEmpty,omitempty"`
+
+	Doc string `json:"doc,omitempty"`
 }
 
 type StructDef struct {
-	Name   string           `json:"name"`
+	Name string `json:"name"`
+	// GoType is the package path and name of the Go type the structure was
+	// created from, used to find the doc comments with AttachDocs
+	GoType string           `json:"goType,omitempty"`
+	Doc    string           `json:"doc,omitempty"`
 	Fields []StructFieldDef `json:"fields"`
 }
 
@@ -33,29 +50,462 @@ const (
 	EndpointTypeApi    EndpointType = "api"
 	EndpointTypeForm   EndpointType = "form"
 	EndpointTypeNormal EndpointType = "normal"
+	// EndpointTypeDownload is a endpoint that returns a file, the response
+	// is the content of the file instead of the envelope
+	EndpointTypeDownload EndpointType = "download"
+	// EndpointTypeUpload is a resumable upload, Path is the path that
+	// creates the upload and Response is the type returned by finalize
+	EndpointTypeUpload EndpointType = "upload"
+	// EndpointTypeJob is a background job, the request returns the job and
+	// Response is the type of the result of the job. The job is read from
+	// Path/{jobId} and canceled with Path/{jobId}/cancel
+	EndpointTypeJob EndpointType = "job"
 )
 
+type DeprecationDef struct {
+	Message     string `json:"message,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+	// NOTE(patrik): Dates are formatted as "2006-01-02"
+	Since  string `json:"since,omitempty"`
+	Sunset string `json:"sunset,omitempty"`
+}
+
 type Endpoint struct {
-	Type     EndpointType `json:"type"`
-	Name     string       `json:"name"`
-	Method   string       `json:"method"`
-	Path     string       `json:"path"`
-	Response string       `json:"response,omitempty"`
-	Body     string       `json:"body,omitempty"`
-	// TODO(patrik): Add form constrains
+	Type        EndpointType    `json:"type"`
+	Name        string          `json:"name"`
+	Method      string          `json:"method"`
+	Path        string          `json:"path"`
+	Summary     string          `json:"summary,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Tags        []string        `json:"tags,omitempty"`
+	Deprecated  *DeprecationDef `json:"deprecated,omitempty"`
+	// Meta is the metadata added by the middlewares of the groups
+	Meta map[string]string `json:"meta,omitempty"`
+	// Security is the names of the security schemes, any of them can be
+	// used to authenticate
+	Security []string `json:"security,omitempty"`
+	// RateLimits is the rate limit policies of the endpoint, the clients
+	// backs off when the endpoint is rate limited
+	RateLimits []RateLimitDef `json:"rateLimits,omitempty"`
+	// Idempotency is set when the endpoint accepts a Idempotency-Key, the
+	// clients sends a new key for every call
+	Idempotency *IdempotencyDef `json:"idempotency,omitempty"`
+	// Cache is set when the endpoint answers conditional requests, the
+	// clients caches the responses and revalidates them
+	Cache *CacheDef `json:"cache,omitempty"`
+	// Pagination is set when the endpoint returns a page of a list, the
+	// clients can walk every page of the list
+	Pagination *PaginationDef `json:"pagination,omitempty"`
+	// Filter is set when the endpoint can be filtered and sorted with the
+	// filter and sort query params
+	Filter *FilterDef `json:"filter,omitempty"`
+	// Download is set for EndpointTypeDownload
+	Download *DownloadDef `json:"download,omitempty"`
+	// Upload is set for EndpointTypeUpload
+	Upload *UploadDef `json:"upload,omitempty"`
+	// Job is set for EndpointTypeJob
+	Job *JobDef `json:"job,omitempty"`
+	// Form is the constraints of the form for EndpointTypeForm, the
+	// clients checks the files before the request is sent
+	Form *FormDef `json:"form,omitempty"`
+	// Status is the status of the successful responses, the response has
+	// no body when the status is 204
+	Status   int    `json:"status,omitempty"`
+	Response string `json:"response,omitempty"`
+	Body     string `json:"body,omitempty"`
+	Doc      string `json:"doc,omitempty"`
+}
+
+// FullDoc returns the summary and the description of the endpoint as
+// paragraphs, the doc comment is used when there is no description
+func (e *Endpoint) FullDoc() string {
+	var parts []string
+
+	if e.Summary != "" {
+		parts = append(parts, e.Summary)
+	}
+
+	if e.Description != "" {
+		parts = append(parts, e.Description)
+	} else if e.Doc != "" {
+		parts = append(parts, e.Doc)
+	}
+
+	return strings.Join(parts, "\n\n")
+}
+
+// DeprecationMessage returns the message the generators should use for a
+// deprecated endpoint, replacement is the name of the replacement method
+// after it has been mapped by the generator
+func (d *DeprecationDef) DeprecationMessage(replacement string) string {
+	var parts []string
+
+	if d.Message != "" {
+		parts = append(parts, d.Message)
+	}
+
+	if replacement != "" {
+		parts = append(parts, fmt.Sprintf("Use %s instead.", replacement))
+	}
+
+	if d.Sunset != "" {
+		parts = append(parts, fmt.Sprintf("Will be removed after %s.", d.Sunset))
+	}
+
+	if len(parts) == 0 {
+		return "Deprecated"
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func createDeprecationDef(d *pyrin.Deprecation) *DeprecationDef {
+	if d == nil {
+		return nil
+	}
+
+	res := &DeprecationDef{
+		Message:     d.Message,
+		Replacement: d.Replacement,
+	}
+
+	if !d.Since.IsZero() {
+		res.Since = d.Since.Format("2006-01-02")
+	}
+
+	if !d.Sunset.IsZero() {
+		res.Sunset = d.Sunset.Format("2006-01-02")
+	}
+
+	return res
+}
+
+type RateLimitDef struct {
+	Name      string `json:"name"`
+	Algorithm string `json:"algorithm"`
+	Limit     int    `json:"limit"`
+	// Window is in seconds
+	Window int  `json:"window"`
+	Burst  int  `json:"burst,omitempty"`
+	Shared bool `json:"shared,omitempty"`
+}
+
+func createRateLimitDefs(policies []*pyrin.RateLimitPolicy) []RateLimitDef {
+	var res []RateLimitDef
+
+	for _, p := range policies {
+		algorithm := p.Algorithm
+		if algorithm == "" {
+			algorithm = pyrin.RateLimitTokenBucket
+		}
+
+		res = append(res, RateLimitDef{
+			Name:      p.Name,
+			Algorithm: string(algorithm),
+			Limit:     p.Limit,
+			Window:    int(p.Window.Seconds()),
+			Burst:     p.Burst,
+			Shared:    p.Shared,
+		})
+	}
+
+	return res
+}
+
+type IdempotencyDef struct {
+	Required bool `json:"required,omitempty"`
+	// Window is in seconds
+	Window int `json:"window,omitempty"`
+}
+
+func createIdempotencyDef(p *pyrin.IdempotencyPolicy) *IdempotencyDef {
+	if p == nil {
+		return nil
+	}
+
+	return &IdempotencyDef{
+		Required: p.Required,
+		Window:   int(p.Window.Seconds()),
+	}
+}
+
+type CacheDef struct {
+	// Conditional is true when the endpoint sends ETag or Last-Modified
+	Conditional  bool   `json:"conditional"`
+	CacheControl string `json:"cacheControl,omitempty"`
+}
+
+type PaginationDef struct {
+	// Style is "offset" or "cursor", offset pages are requested with the
+	// page query param and cursor pages with the cursor query param
+	Style        string `json:"style"`
+	DefaultLimit int    `json:"defaultLimit"`
+	MaxLimit     int    `json:"maxLimit"`
+}
+
+func createPaginationDef(p *pyrin.PaginationPolicy) *PaginationDef {
+	if p == nil {
+		return nil
+	}
+
+	style := p.Style
+	if style == "" {
+		style = pyrin.PaginationOffset
+	}
+
+	res := &PaginationDef{
+		Style:        string(style),
+		DefaultLimit: p.DefaultLimit,
+		MaxLimit:     p.MaxLimit,
+	}
+
+	if res.MaxLimit <= 0 {
+		res.MaxLimit = pyrin.DefaultMaxPageLimit
+	}
+
+	if res.DefaultLimit <= 0 {
+		res.DefaultLimit = pyrin.DefaultPageLimit
+	}
+
+	res.DefaultLimit = min(res.DefaultLimit, res.MaxLimit)
+
+	return res
+}
+
+type FilterFieldDef struct {
+	Name string `json:"name"`
+	// Type is "string", "int", "float", "bool" or "date"
+	Type      string   `json:"type"`
+	Filter    bool     `json:"filter"`
+	Sort      bool     `json:"sort"`
+	Nullable  bool     `json:"nullable,omitempty"`
+	Operators []string `json:"operators,omitempty"`
+}
+
+type FilterDef struct {
+	Fields      []FilterFieldDef `json:"fields"`
+	DefaultSort string           `json:"defaultSort,omitempty"`
+}
+
+func createFilterDef(s *chisel.Schema) *FilterDef {
+	if s == nil {
+		return nil
+	}
+
+	// NOTE(patrik): The columns is left out, they are only used by the
+	// server
+	res := &FilterDef{
+		Fields:      []FilterFieldDef{},
+		DefaultSort: s.DefaultSort,
+	}
+
+	for _, f := range s.Fields {
+		var operators []string
+		if f.Filter {
+			for _, op := range chisel.Operators(f.Type) {
+				operators = append(operators, string(op))
+			}
+		}
+
+		res.Fields = append(res.Fields, FilterFieldDef{
+			Name:      f.Name,
+			Type:      string(f.Type),
+			Filter:    f.Filter,
+			Sort:      f.Sort,
+			Nullable:  f.Nullable,
+			Operators: operators,
+		})
+	}
+
+	return res
+}
+
+// PageFields is the fields of the response of a paginated endpoint, the
+// generators uses them to walk the pages
+type PageFields struct {
+	Items      ResolvedField
+	Page       ResolvedField
+	TotalPages ResolvedField
+	NextCursor ResolvedField
+}
+
+// ItemType returns the type of the items of the page
+func (p *PageFields) ItemType() FieldType {
+	return p.Items.Type.(*FieldTypeArray).ElementType
+}
+
+// ResolvePageFields returns the fields of the page structure name
+func ResolvePageFields(resolver *Resolver, name string) (PageFields, error) {
+	s, err := resolver.Resolve(name)
+	if err != nil {
+		return PageFields{}, err
+	}
+
+	var res PageFields
+
+	found := 0
+	for _, f := range s.Fields {
+		switch f.Name {
+		case "items":
+			if _, ok := f.Type.(*FieldTypeArray); !ok {
+				return PageFields{}, fmt.Errorf("%s: items is not a array", name)
+			}
+
+			res.Items = f
+		case "page":
+			res.Page = f
+		case "totalPages":
+			res.TotalPages = f
+		case "nextCursor":
+			res.NextCursor = f
+		default:
+			continue
+		}
+
+		found++
+	}
+
+	if found != 4 {
+		return PageFields{}, fmt.Errorf("%s is not a page", name)
+	}
+
+	return res, nil
+}
+
+type DownloadDef struct {
+	// ContentType is empty when the content type depends on the file
+	ContentType string `json:"contentType,omitempty"`
+	Filename    string `json:"filename,omitempty"`
+	Inline      bool   `json:"inline,omitempty"`
+	// Digest is true when the response always has a Repr-Digest header
+	Digest bool `json:"digest,omitempty"`
+}
+
+type UploadDef struct {
+	MaxSize int64 `json:"maxSize,omitempty"`
+	// Expiry is how long an unfinished upload is kept in seconds, 0 is
+	// the default of the server
+	Expiry          int  `json:"expiry,omitempty"`
+	RequireChecksum bool `json:"requireChecksum,omitempty"`
+}
+
+type JobDef struct {
+	// PollInterval is how often the clients polls the job in seconds, 0 is
+	// the default of the server. The Retry-After header of the job is used
+	// when the server sends it
+	PollInterval int `json:"pollInterval,omitempty"`
+}
+
+type FormFileDef struct {
+	Name string `json:"name"`
+	// MinFiles is the minimum number of files, the field can have no files
+	// when Optional is set
+	MinFiles         int      `json:"minFiles,omitempty"`
+	Optional         bool     `json:"optional,omitempty"`
+	MaxFiles         int      `json:"maxFiles,omitempty"`
+	MaxFileSize      int64    `json:"maxFileSize,omitempty"`
+	AllowedMimeTypes []string `json:"allowedMimeTypes,omitempty"`
+}
+
+type FormDef struct {
+	// Streaming is set when the server reads the form while the handler
+	// runs, the body needs to be the first part of the form
+	Streaming    bool          `json:"streaming,omitempty"`
+	OptionalBody bool          `json:"optionalBody,omitempty"`
+	MaxTotalSize int64         `json:"maxTotalSize,omitempty"`
+	Files        []FormFileDef `json:"files,omitempty"`
+}
+
+// HasConstraints returns true when the clients needs to check the form
+// before it's sent
+func (f *FormDef) HasConstraints() bool {
+	return f != nil && (f.MaxTotalSize > 0 || len(f.Files) > 0)
+}
+
+func createFormDef(spec *pyrin.FormSpec, streaming bool) *FormDef {
+	res := &FormDef{
+		Streaming:    streaming,
+		OptionalBody: spec.OptionalBody,
+		MaxTotalSize: spec.MaxTotalSize,
+	}
+
+	for name, file := range spec.Files {
+		res.Files = append(res.Files, FormFileDef{
+			Name:             name,
+			MinFiles:         file.NumExpected,
+			Optional:         file.Optional,
+			MaxFiles:         file.MaxFiles,
+			MaxFileSize:      file.MaxFileSize,
+			AllowedMimeTypes: file.AllowedMimeTypes,
+		})
+	}
+
+	// NOTE(patrik): Sorted so the generated code is the same every time
+	sort.Slice(res.Files, func(i, j int) bool {
+		return res.Files[i].Name < res.Files[j].Name
+	})
+
+	return res
+}
+
+func successStatus(status int) int {
+	if status == 0 {
+		return http.StatusOK
+	}
+
+	return status
+}
+
+func createCacheDef(p *pyrin.CachePolicy) *CacheDef {
+	if p == nil {
+		return nil
+	}
+
+	return &CacheDef{
+		Conditional:  p.ETag || p.Validator != nil,
+		CacheControl: p.CacheControl,
+	}
+}
+
+type SecuritySchemeDef struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	In        string `json:"in,omitempty"`
+	ParamName string `json:"paramName,omitempty"`
 }
 
 type ServerDefVersion int
 
 const (
 	ServerDefVersion1 ServerDefVersion = 1
+	// ServerDefVersion2 replaced omitEmpty with optional and nullable
+	ServerDefVersion2 ServerDefVersion = 2
+
+	ServerDefVersionLatest = ServerDefVersion2
 )
 
 type ServerDef struct {
 	Version ServerDefVersion `json:"version"`
+	// Envelope is the name of the envelope of the responses, empty is the
+	// same as pyrin.EnvelopeDefault
+	Envelope string `json:"envelope,omitempty"`
 
-	Structures []StructDef `json:"structures"`
-	Endpoints  []Endpoint  `json:"endpoints"`
+	SecuritySchemes []SecuritySchemeDef `json:"securitySchemes,omitempty"`
+	Structures      []StructDef         `json:"structures"`
+	Endpoints       []Endpoint          `json:"endpoints"`
+}
+
+// ResponseEnvelope returns the envelope of the responses, an error is
+// returned when the generators doesn't support the envelope
+func (s *ServerDef) ResponseEnvelope() (string, error) {
+	switch s.Envelope {
+	case "", pyrin.EnvelopeDefault:
+		return pyrin.EnvelopeDefault, nil
+	case pyrin.EnvelopeProblem:
+		return pyrin.EnvelopeProblem, nil
+	}
+
+	return "", fmt.Errorf("unsupported envelope %q", s.Envelope)
 }
 
 func (s *ServerDef) SaveToFile(p string) error {
@@ -357,7 +807,12 @@ func (n *NameFilter) LoadDefault() {
 
 func CreateServerDef(router *Router, fieldNameFilter NameFilter) (ServerDef, error) {
 	res := ServerDef{
-		Version: ServerDefVersion1,
+		Version:  ServerDefVersionLatest,
+		Envelope: pyrin.EnvelopeDefault,
+	}
+
+	if router.Envelope != nil {
+		res.Envelope = router.Envelope.Name()
 	}
 
 	resolver := NewResolver()
@@ -366,6 +821,19 @@ func CreateServerDef(router *Router, fieldNameFilter NameFilter) (ServerDef, err
 	for _, route := range router.Routes {
 		switch route := route.(type) {
 		case ApiRoute:
+			// NOTE(patrik): The clients reads the items of the pages so
+			// the response needs to be a pyrin.Page
+			if route.Pagination != nil && (route.ResponseType == nil || !isPageType(reflect.TypeOf(route.ResponseType))) {
+				return ServerDef{}, fmt.Errorf("%s is paginated but the response type is not a pyrin.Page", route.Name)
+			}
+
+			if route.Filter != nil {
+				err := route.Filter.Validate()
+				if err != nil {
+					return ServerDef{}, fmt.Errorf("%s has a invalid filter: %w", route.Name, err)
+				}
+			}
+
 			err := structRegistry.Register(route.ResponseType)
 			if err != nil {
 				return ServerDef{}, err
@@ -385,7 +853,22 @@ func CreateServerDef(router *Router, fieldNameFilter NameFilter) (ServerDef, err
 			if err != nil {
 				return ServerDef{}, err
 			}
-		case NormalRoute:
+		case UploadRoute:
+			err := structRegistry.Register(route.ResponseType)
+			if err != nil {
+				return ServerDef{}, err
+			}
+		case JobRoute:
+			err := structRegistry.Register(route.ResultType)
+			if err != nil {
+				return ServerDef{}, err
+			}
+
+			err = structRegistry.Register(route.BodyType)
+			if err != nil {
+				return ServerDef{}, err
+			}
+		case DownloadRoute, NormalRoute:
 		default:
 			panic(fmt.Sprintf("Unimplemented route type: %T", route))
 		}
@@ -408,6 +891,39 @@ func CreateServerDef(router *Router, fieldNameFilter NameFilter) (ServerDef, err
 		resolver.AddStructDecl(decl)
 	}
 
+	addSecurity := func(schemes []*pyrin.SecurityScheme) ([]string, error) {
+		var names []string
+
+		for _, scheme := range schemes {
+			def := SecuritySchemeDef{
+				Name:      scheme.Name,
+				Type:      string(scheme.Type),
+				In:        string(scheme.In),
+				ParamName: scheme.ParamName,
+			}
+
+			found := false
+			for _, existing := range res.SecuritySchemes {
+				if existing.Name == def.Name {
+					if existing != def {
+						return nil, fmt.Errorf("security scheme %s is declared multiple times with different settings", def.Name)
+					}
+
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				res.SecuritySchemes = append(res.SecuritySchemes, def)
+			}
+
+			names = append(names, scheme.Name)
+		}
+
+		return names, nil
+	}
+
 	getTypeName := func(ty any) (string, error) {
 		if ty == nil {
 			return "", nil
@@ -427,10 +943,22 @@ func CreateServerDef(router *Router, fieldNameFilter NameFilter) (ServerDef, err
 		return name, nil
 	}
 
+	// NOTE(patrik): The response type is ignored when the response has no
+	// body
+	getResponseTypeName := func(status int, ty any) (string, error) {
+		if status == http.StatusNoContent {
+			return "", nil
+		}
+
+		return getTypeName(ty)
+	}
+
 	for _, route := range router.Routes {
 		switch route := route.(type) {
 		case ApiRoute:
-			responseType, err := getTypeName(route.ResponseType)
+			status := successStatus(route.Status)
+
+			responseType, err := getResponseTypeName(status, route.ResponseType)
 			if err != nil {
 				return ServerDef{}, err
 			}
@@ -440,16 +968,35 @@ func CreateServerDef(router *Router, fieldNameFilter NameFilter) (ServerDef, err
 				return ServerDef{}, err
 			}
 
+			security, err := addSecurity(route.Security)
+			if err != nil {
+				return ServerDef{}, err
+			}
+
 			res.Endpoints = append(res.Endpoints, Endpoint{
-				Type:     EndpointTypeApi,
-				Name:     route.Name,
-				Method:   route.Method,
-				Path:     route.Path,
-				Response: responseType,
-				Body:     bodyType,
+				Type:        EndpointTypeApi,
+				Name:        route.Name,
+				Method:      route.Method,
+				Path:        route.Path,
+				Summary:     route.Summary,
+				Description: route.Description,
+				Tags:        route.Tags,
+				Deprecated:  createDeprecationDef(route.Deprecated),
+				Meta:        route.Meta,
+				Security:    security,
+				RateLimits:  createRateLimitDefs(route.RateLimits),
+				Idempotency: createIdempotencyDef(route.Idempotency),
+				Cache:       createCacheDef(route.Cache),
+				Pagination:  createPaginationDef(route.Pagination),
+				Filter:      createFilterDef(route.Filter),
+				Status:      status,
+				Response:    responseType,
+				Body:        bodyType,
 			})
 		case FormApiRoute:
-			responseType, err := getTypeName(route.ResponseType)
+			status := successStatus(route.Status)
+
+			responseType, err := getResponseTypeName(status, route.ResponseType)
 			if err != nil {
 				return ServerDef{}, err
 			}
@@ -459,20 +1006,136 @@ func CreateServerDef(router *Router, fieldNameFilter NameFilter) (ServerDef, err
 				return ServerDef{}, err
 			}
 
+			security, err := addSecurity(route.Security)
+			if err != nil {
+				return ServerDef{}, err
+			}
+
+			res.Endpoints = append(res.Endpoints, Endpoint{
+				Type:        EndpointTypeForm,
+				Name:        route.Name,
+				Method:      route.Method,
+				Path:        route.Path,
+				Summary:     route.Summary,
+				Description: route.Description,
+				Tags:        route.Tags,
+				Deprecated:  createDeprecationDef(route.Deprecated),
+				Meta:        route.Meta,
+				Security:    security,
+				RateLimits:  createRateLimitDefs(route.RateLimits),
+				Form:        createFormDef(&route.Spec, route.Streaming),
+				Status:      status,
+				Response:    responseType,
+				Body:        bodyType,
+			})
+		case DownloadRoute:
+			security, err := addSecurity(route.Security)
+			if err != nil {
+				return ServerDef{}, err
+			}
+
+			res.Endpoints = append(res.Endpoints, Endpoint{
+				Type:        EndpointTypeDownload,
+				Name:        route.Name,
+				Method:      route.Method,
+				Path:        route.Path,
+				Summary:     route.Summary,
+				Description: route.Description,
+				Tags:        route.Tags,
+				Deprecated:  createDeprecationDef(route.Deprecated),
+				Meta:        route.Meta,
+				Security:    security,
+				RateLimits:  createRateLimitDefs(route.RateLimits),
+				Download: &DownloadDef{
+					ContentType: route.ContentType,
+					Filename:    route.Filename,
+					Inline:      route.Inline,
+					Digest:      route.Digest,
+				},
+			})
+		case UploadRoute:
+			responseType, err := getTypeName(route.ResponseType)
+			if err != nil {
+				return ServerDef{}, err
+			}
+
+			security, err := addSecurity(route.Security)
+			if err != nil {
+				return ServerDef{}, err
+			}
+
 			res.Endpoints = append(res.Endpoints, Endpoint{
-				Type:     EndpointTypeForm,
-				Name:     route.Name,
-				Method:   route.Method,
-				Path:     route.Path,
+				Type:        EndpointTypeUpload,
+				Name:        route.Name,
+				Method:      http.MethodPost,
+				Path:        route.Path,
+				Summary:     route.Summary,
+				Description: route.Description,
+				Tags:        route.Tags,
+				Deprecated:  createDeprecationDef(route.Deprecated),
+				Meta:        route.Meta,
+				Security:    security,
+				RateLimits:  createRateLimitDefs(route.RateLimits),
+				Upload: &UploadDef{
+					MaxSize:         route.MaxSize,
+					Expiry:          int(route.Expiry.Seconds()),
+					RequireChecksum: route.RequireChecksum,
+				},
 				Response: responseType,
+			})
+		case JobRoute:
+			resultType, err := getTypeName(route.ResultType)
+			if err != nil {
+				return ServerDef{}, err
+			}
+
+			bodyType, err := getTypeName(route.BodyType)
+			if err != nil {
+				return ServerDef{}, err
+			}
+
+			security, err := addSecurity(route.Security)
+			if err != nil {
+				return ServerDef{}, err
+			}
+
+			res.Endpoints = append(res.Endpoints, Endpoint{
+				Type:        EndpointTypeJob,
+				Name:        route.Name,
+				Method:      route.Method,
+				Path:        route.Path,
+				Summary:     route.Summary,
+				Description: route.Description,
+				Tags:        route.Tags,
+				Deprecated:  createDeprecationDef(route.Deprecated),
+				Meta:        route.Meta,
+				Security:    security,
+				RateLimits:  createRateLimitDefs(route.RateLimits),
+				Job: &JobDef{
+					PollInterval: int(route.PollInterval.Seconds()),
+				},
+				Status:   http.StatusAccepted,
+				Response: resultType,
 				Body:     bodyType,
 			})
 		case NormalRoute:
+			security, err := addSecurity(route.Security)
+			if err != nil {
+				return ServerDef{}, err
+			}
+
 			res.Endpoints = append(res.Endpoints, Endpoint{
-				Type:   EndpointTypeNormal,
-				Name:   route.Name,
-				Method: route.Method,
-				Path:   route.Path,
+				Type:        EndpointTypeNormal,
+				Name:        route.Name,
+				Method:      route.Method,
+				Path:        route.Path,
+				Summary:     route.Summary,
+				Description: route.Description,
+				Tags:        route.Tags,
+				Deprecated:  createDeprecationDef(route.Deprecated),
+				Meta:        route.Meta,
+				Security:    security,
+				RateLimits:  createRateLimitDefs(route.RateLimits),
 			})
 		default:
 			panic(fmt.Sprintf("Unimplemented route type: %T", route))
@@ -495,18 +1158,29 @@ func CreateServerDef(router *Router, fieldNameFilter NameFilter) (ServerDef, err
 			}
 
 			fields = append(fields, StructFieldDef{
-				Name:      f.Name,
-				Type:      s,
-				OmitEmpty: f.OmitEmpty,
+				Name:     f.Name,
+				Type:     s,
+				Optional: f.Optional,
+				Nullable: f.Nullable,
 			})
 		}
 
+		goType := ""
+		if t, exists := structRegistry.types[st.Name]; exists && t.Name() != "" && !isPageType(t) {
+			goType = t.PkgPath() + "." + t.Name()
+		}
+
 		res.Structures = append(res.Structures, StructDef{
 			Name:   st.Name,
+			GoType: goType,
 			Fields: fields,
 		})
 	}
 
+	sort.SliceStable(res.SecuritySchemes, func(i, j int) bool {
+		return natural.Less(res.SecuritySchemes[i].Name, res.SecuritySchemes[j].Name)
+	})
+
 	sort.SliceStable(res.Structures, func(i, j int) bool {
 		return natural.Less(res.Structures[i].Name, res.Structures[j].Name)
 	})
@@ -520,6 +1194,10 @@ func CreateServerDef(router *Router, fieldNameFilter NameFilter) (ServerDef, err
 }
 
 func CreateResolverFromServerDef(s *ServerDef) (*Resolver, error) {
+	if s.Version > ServerDefVersionLatest {
+		return nil, fmt.Errorf("unsupported server def version: %d", s.Version)
+	}
+
 	resolver := NewResolver()
 
 	// TODO(patrik): Handle better
@@ -532,15 +1210,30 @@ func CreateResolverFromServerDef(s *ServerDef) (*Resolver, error) {
 				return nil, err
 			}
 
+			optional := f.Optional
+			nullable := f.Nullable
+
+			// NOTE(patrik): Version 1 only had omitEmpty, map it to how
+			// the generators treated it at that time
+			if s.Version < ServerDefVersion2 {
+				_, isPtr := t.(*PtrTypespec)
+
+				optional = f.OmitEmpty
+				nullable = isPtr
+			}
+
 			fields = append(fields, &FieldDecl{
-				Name:      f.Name,
-				Type:      t,
-				OmitEmpty: f.OmitEmpty,
+				Name:     f.Name,
+				Type:     t,
+				Optional: optional,
+				Nullable: nullable,
+				Doc:      f.Doc,
 			})
 		}
 
 		resolver.AddStructDecl(StructDecl{
 			Name:   t.Name,
+			Doc:    t.Doc,
 			Fields: fields,
 		})
 	}
@@ -18,24 +18,636 @@ export function createApiResponse<
   ]);
 }
 
+export const JobState = z.enum([
+  "pending",
+  "running",
+  "completed",
+  "failed",
+  "canceled",
+]);
+export type JobState = z.infer<typeof JobState>;
+
+// Schema of the job returned by a job endpoint, result is set when the job
+// is completed and error when the job is failed or canceled
+export function createJobSchema<Result extends z.ZodTypeAny>(result: Result) {
+  return z.object({
+    id: z.string(),
+    state: JobState,
+    result: result.optional(),
+    error: z
+      .object({
+        code: z.number(),
+        message: z.string(),
+        type: z.string(),
+        extra: z.any(),
+      })
+      .optional(),
+    createdAt: z.string(),
+    startedAt: z.string().optional(),
+    finishedAt: z.string().optional(),
+  });
+}
+
+export type PaginationStyle = "offset" | "cursor";
+
+export type ApiErrorData = {
+  code: number;
+  message: string;
+  type: string;
+  extra?: unknown;
+};
+
+// Thrown by the iterators of the paginated endpoints when a page fails
+export class ApiError extends Error {
+  code: number;
+  type: string;
+  extra?: unknown;
+
+  constructor(error: ApiErrorData) {
+    super(error.message);
+    this.name = "ApiError";
+    this.code = error.code;
+    this.type = error.type;
+    this.extra = error.extra;
+  }
+}
+
+type PageResponse<Item> =
+  | {
+      success: true;
+      data: {
+        items: Item[] | null;
+        page?: number;
+        totalPages?: number;
+        nextCursor?: string;
+      };
+    }
+  | { success: false; error: ApiErrorData };
+
+// Walks every page of a paginated endpoint starting at the page requested
+// by the query of extra, fetchPage is called with the options of the page
+export async function* paginate<Item>(
+  style: PaginationStyle,
+  extra: ExtraOptions | undefined,
+  fetchPage: (extra: ExtraOptions) => Promise<PageResponse<Item>>,
+): AsyncGenerator<Item, void, undefined> {
+  let query = { ...extra?.query };
+
+  for (;;) {
+    const res = await fetchPage({ ...extra, query });
+    if (!res.success) {
+      throw new ApiError(res.error);
+    }
+
+    const page = res.data;
+    yield* page.items ?? [];
+
+    if (style === "cursor") {
+      if (!page.nextCursor) {
+        return;
+      }
+
+      query = { ...query, cursor: page.nextCursor };
+    } else {
+      const current = page.page ?? 1;
+      if (current >= (page.totalPages ?? 0)) {
+        return;
+      }
+
+      query = { ...query, page: String(current + 1) };
+    }
+  }
+}
+
 export function createUrl(base: string, endpoint: string) {
   return new URL(base + endpoint);
 }
 
+// Returns the filename from a Content-Disposition header, the RFC 5987
+// "filename*" parameter is used when the server sent it
+export function parseContentDispositionFilename(header: string | null) {
+  if (!header) {
+    return null;
+  }
+
+  const extended = /filename\*\s*=\s*[^']*'[^']*'([^;]+)/i.exec(header);
+  if (extended) {
+    try {
+      return decodeURIComponent(extended[1].trim());
+    } catch {
+      // NOTE: Fallback to the plain filename
+    }
+  }
+
+  const plain = /filename\s*=\s*(?:"((?:\\.|[^"\\])*)"|([^;]+))/i.exec(header);
+  if (plain) {
+    return plain[1] !== undefined
+      ? plain[1].replace(/\\(.)/g, "$1")
+      : plain[2].trim();
+  }
+
+  return null;
+}
+
+export type DownloadResult = {
+  blob: Blob;
+  status: number;
+  contentType: string | null;
+  filename: string | null;
+  // SHA-256 of the whole file from the Repr-Digest header as base64
+  digest: string | null;
+};
+
+export type DownloadResponse =
+  | { success: true; data: DownloadResult }
+  | {
+      success: false;
+      error: { code: number; message: string; type: string; extra?: unknown };
+    };
+
 export type ExtraOptions = {
   headers?: Record<string, string>;
   query?: Record<string, string>;
 };
 
+export type UploadProgress = {
+  loaded: number;
+  // null when the size of the body is unknown
+  total: number | null;
+};
+
+export type FormOptions = ExtraOptions & {
+  // Called while the form is uploaded, uses XMLHttpRequest instead of
+  // fetch because fetch can't report the upload progress
+  onUploadProgress?: (progress: UploadProgress) => void;
+};
+
+export type UploadOptions = ExtraOptions & {
+  // Size of the chunks in bytes, defaults to 8 MiB
+  chunkSize?: number;
+  metadata?: Record<string, string>;
+  // Number of times a failed chunk is retried
+  retries?: number;
+  // URL of an upload created earlier, the upload continues from the offset
+  // the server has
+  uploadUrl?: string;
+  // Called with the URL of the new upload, store it to resume the upload
+  // later
+  onCreated?: (uploadUrl: string) => void;
+  // Called after every chunk the server has received
+  onUploadProgress?: (progress: UploadProgress) => void;
+};
+
+function toBase64(data: ArrayBuffer | Uint8Array) {
+  const bytes = data instanceof Uint8Array ? data : new Uint8Array(data);
+
+  let binary = "";
+  for (let i = 0; i < bytes.length; i++) {
+    binary += String.fromCharCode(bytes[i]);
+  }
+
+  return btoa(binary);
+}
+
+// Encodes the metadata as the Upload-Metadata header, the values are base64
+// encoded UTF-8
+function encodeUploadMetadata(metadata: Record<string, string>) {
+  return Object.keys(metadata)
+    .sort()
+    .map((key) => {
+      const value = new TextEncoder().encode(metadata[key]);
+      return `${key} ${toBase64(value)}`;
+    })
+    .join(",");
+}
+
+// Returns true when the chunk can be sent again after the offset has been
+// read from the server
+function retryableUploadError(error: { code: number; type: string }) {
+  switch (error.code) {
+    case 409:
+    case 423:
+      return error.type !== "UPLOAD_INCOMPLETE";
+    case 400:
+      return error.type === "UPLOAD_CHECKSUM_MISMATCH";
+  }
+
+  return error.code >= 500;
+}
+
+export type JobOptions = ExtraOptions & {
+  // Milliseconds between the polls when the server doesn't send a
+  // Retry-After header
+  pollInterval?: number;
+  // Milliseconds to wait for the job, the promise is rejected when the job
+  // isn't finished before the timeout
+  timeout?: number;
+};
+
+// Builds the multipart form of a form endpoint, the body is sent as JSON in
+// the "body" field before the files
+export function createFormData(
+  body: unknown,
+  files: Record<string, Blob[] | undefined>,
+) {
+  const form = new FormData();
+
+  if (body !== undefined) {
+    form.append("body", JSON.stringify(body));
+  }
+
+  for (const [name, list] of Object.entries(files)) {
+    for (const file of list ?? []) {
+      form.append(name, file);
+    }
+  }
+
+  return form;
+}
+
+function parseResponseHeaders(raw: string) {
+  const headers = new Headers();
+
+  for (const line of raw.trim().split(/[\r\n]+/)) {
+    const i = line.indexOf(":");
+    if (i > 0) {
+      headers.append(line.slice(0, i).trim(), line.slice(i + 1).trim());
+    }
+  }
+
+  return headers;
+}
+
+// Same as fetch but reports the upload progress
+function fetchWithProgress(
+  url: URL,
+  init: RequestInit,
+  onUploadProgress: (progress: UploadProgress) => void,
+) {
+  return new Promise<Response>((resolve, reject) => {
+    const xhr = new XMLHttpRequest();
+    xhr.open(init.method ?? "GET", url);
+    xhr.responseType = "blob";
+    xhr.withCredentials = init.credentials === "include";
+
+    for (const [key, value] of Object.entries(
+      (init.headers ?? {}) as Record<string, string>,
+    )) {
+      xhr.setRequestHeader(key, value);
+    }
+
+    xhr.upload.onprogress = (e) => {
+      onUploadProgress({
+        loaded: e.loaded,
+        total: e.lengthComputable ? e.total : null,
+      });
+    };
+
+    xhr.onload = () => {
+      // NOTE: Response can't have a body for 204 and 304
+      const nullBody = xhr.status === 204 || xhr.status === 304;
+
+      resolve(
+        new Response(nullBody ? null : xhr.response, {
+          status: xhr.status,
+          statusText: xhr.statusText,
+          headers: parseResponseHeaders(xhr.getAllResponseHeaders()),
+        }),
+      );
+    };
+    xhr.onerror = () => reject(new TypeError("Network request failed"));
+    xhr.onabort = () => reject(new DOMException("Aborted", "AbortError"));
+
+    xhr.send(init.body as XMLHttpRequestBodyInit | null);
+  });
+}
+
+export type EndpointOptions = {
+  // Names of the security schemes the endpoint accepts
+  security?: string[];
+  // Retry the request after the Retry-After delay when rate limited
+  rateLimited?: boolean;
+  // Send a Idempotency-Key, a key set in the extra headers is used instead
+  // of a new key
+  idempotent?: boolean;
+  // Cache the response and revalidate it with If-None-Match and
+  // If-Modified-Since
+  cached?: boolean;
+  // Constraints of the form, the files are checked before the request is
+  // sent
+  form?: FormSpec;
+  // Seconds between the polls of a job when the server doesn't send a
+  // Retry-After header
+  job?: { pollInterval?: number };
+};
+
+export type FormFileSpec = {
+  name: string;
+  minFiles?: number;
+  optional?: boolean;
+  maxFiles?: number;
+  maxFileSize?: number;
+  allowedMimeTypes?: string[];
+};
+
+export type FormSpec = {
+  optionalBody?: boolean;
+  maxTotalSize?: number;
+  files?: FormFileSpec[];
+};
+
+function mimeTypeAllowed(allowed: string[], mimeType: string) {
+  return allowed.some((a) => {
+    a = a.toLowerCase();
+    return (
+      a === mimeType ||
+      a === "*/*" ||
+      (a.endsWith("/*") && mimeType.startsWith(a.slice(0, -1)))
+    );
+  });
+}
+
+function validateFormFiles(spec: FormFileSpec, files: File[]) {
+  if (files.length === 0 && spec.optional) {
+    return null;
+  }
+
+  const minFiles = spec.minFiles ?? 0;
+  if (files.length < minFiles) {
+    return `expected ${minFiles} or more files, got ${files.length}`;
+  }
+
+  if (spec.maxFiles && files.length > spec.maxFiles) {
+    return `expected at most ${spec.maxFiles} files, got ${files.length}`;
+  }
+
+  for (const file of files) {
+    if (spec.maxFileSize && file.size > spec.maxFileSize) {
+      return `file "${file.name}" is larger than ${spec.maxFileSize} bytes`;
+    }
+
+    // NOTE: The browser sets the type from the extension, the server
+    // checks the content of the file
+    const mimeType = (file.type || "application/octet-stream")
+      .split(";")[0]
+      .trim()
+      .toLowerCase();
+    if (
+      spec.allowedMimeTypes &&
+      spec.allowedMimeTypes.length > 0 &&
+      !mimeTypeAllowed(spec.allowedMimeTypes, mimeType)
+    ) {
+      return `file "${file.name}" has type "${mimeType}", expected one of: ${spec.allowedMimeTypes.join(", ")}`;
+    }
+  }
+
+  return null;
+}
+
+// Returns the form with the "body" entry first, streaming endpoints reads
+// the body before the files
+function bodyFirst(form: FormData) {
+  const body = form.get("body");
+  if (body === null) {
+    return form;
+  }
+
+  const res = new FormData();
+  res.append("body", body);
+
+  form.forEach((value, key) => {
+    if (key !== "body") {
+      res.append(key, value);
+    }
+  });
+
+  return res;
+}
+
+// Checks the files of the form against the spec, returns the same
+// FORM_VALIDATION_ERROR response as the server when the form is invalid
+export function validateFormData(body: FormData, spec: FormSpec) {
+  const extra: Record<string, string> = {};
+
+  let total = 0;
+  for (const fileSpec of spec.files ?? []) {
+    const files = body
+      .getAll(fileSpec.name)
+      .filter((v): v is File => typeof v !== "string");
+
+    const msg = validateFormFiles(fileSpec, files);
+    if (msg !== null) {
+      extra[fileSpec.name] = msg;
+      continue;
+    }
+
+    for (const file of files) {
+      total += file.size;
+    }
+
+    if (spec.maxTotalSize && total > spec.maxTotalSize) {
+      extra[fileSpec.name] =
+        `total size of the files is larger than ${spec.maxTotalSize} bytes`;
+    }
+  }
+
+  if (Object.keys(extra).length === 0) {
+    return null;
+  }
+
+  return {
+    success: false,
+    error: {
+      code: 400,
+      type: "FORM_VALIDATION_ERROR",
+      message: "Form Validation error",
+      extra,
+    },
+  };
+}
+
+// Shape of the responses sent by the server, "problem" sends the data as is
+// and the errors as RFC 9457 problem details
+export type Envelope = "default" | "problem";
+
+type CachedResponse = {
+  etag: string | null;
+  lastModified: string | null;
+  data: unknown;
+};
+
+export type SecurityScheme =
+  | { type: "bearer" }
+  | { type: "basic" }
+  | { type: "apiKey"; in: "header" | "query"; paramName: string }
+  | { type: "cookie"; paramName: string };
+
 export class BaseApiClient {
   baseUrl: string;
   headers: Map<string, string>;
 
+  protected envelope: Envelope = "default";
+  protected securitySchemes: Record<string, SecurityScheme> = {};
+  private credentials = new Map<string, string>();
+
+  // Number of times a rate limited request is retried
+  rateLimitRetries = 3;
+  // Longest Retry-After delay in seconds the client waits for
+  maxRetryAfter = 60;
+
+  // Number of responses kept for the cached endpoints
+  maxCachedResponses = 100;
+  private responseCache = new Map<string, CachedResponse>();
+
   constructor(baseUrl: string) {
     this.baseUrl = baseUrl;
     this.headers = new Map<string, string>();
   }
 
+  protected setCredential(scheme: string, value: string | null) {
+    if (value === null) {
+      this.credentials.delete(scheme);
+    } else {
+      this.credentials.set(scheme, value);
+    }
+  }
+
+  // Applies the credentials of the first scheme that has credentials set,
+  // returns true if the credentials are sent as a cookie
+  private applySecurity(
+    headers: Record<string, string>,
+    url: URL,
+    security: string[],
+  ) {
+    for (const name of security) {
+      const value = this.credentials.get(name);
+      const scheme = this.securitySchemes[name];
+      if (value === undefined || !scheme) {
+        continue;
+      }
+
+      switch (scheme.type) {
+        case "bearer":
+          headers["Authorization"] = `Bearer ${value}`;
+          break;
+        case "basic":
+          headers["Authorization"] = `Basic ${value}`;
+          break;
+        case "apiKey":
+          if (scheme.in === "query") {
+            url.searchParams.set(scheme.paramName, value);
+          } else {
+            headers[scheme.paramName] = value;
+          }
+          break;
+        case "cookie":
+          // NOTE: Browsers ignores the Cookie header and uses the cookies
+          // stored by the browser instead
+          headers["Cookie"] = `${scheme.paramName}=${value}`;
+          return true;
+      }
+
+      return false;
+    }
+
+    return false;
+  }
+
+  private async fetchWithBackoff(
+    url: URL,
+    init: RequestInit,
+    rateLimited: boolean,
+    send: (url: URL, init: RequestInit) => Promise<Response> = fetch,
+  ) {
+    for (let attempt = 0; ; attempt++) {
+      const res = await send(url, init);
+      if (
+        res.status !== 429 ||
+        !rateLimited ||
+        attempt >= this.rateLimitRetries
+      ) {
+        return res;
+      }
+
+      const retryAfter = Number(res.headers.get("Retry-After") ?? "1");
+      if (isNaN(retryAfter) || retryAfter > this.maxRetryAfter) {
+        return res;
+      }
+
+      await new Promise((resolve) =>
+        setTimeout(resolve, Math.max(retryAfter, 0) * 1000),
+      );
+    }
+  }
+
+  private cacheKey(method: string, url: URL, headers: Record<string, string>) {
+    return [
+      method,
+      url.toString(),
+      headers["Authorization"] ?? "",
+      headers["Cookie"] ?? "",
+    ].join(" ");
+  }
+
+  private storeResponse(key: string, res: Response, data: unknown) {
+    const etag = res.headers.get("ETag");
+    const lastModified = res.headers.get("Last-Modified");
+    if (!etag && !lastModified) {
+      return;
+    }
+
+    // NOTE: Map keeps the insertion order so the first key is the oldest
+    this.responseCache.delete(key);
+    this.responseCache.set(key, { etag, lastModified, data });
+
+    while (this.responseCache.size > this.maxCachedResponses) {
+      const oldest = this.responseCache.keys().next().value;
+      if (oldest === undefined) {
+        break;
+      }
+
+      this.responseCache.delete(oldest);
+    }
+  }
+
+  // Converts the response to the default envelope so it can be parsed with
+  // the schema from createApiResponse
+  private unwrapEnvelope(res: Response, body: unknown): unknown {
+    if (this.envelope !== "problem") {
+      return body;
+    }
+
+    if (res.ok) {
+      return { success: true, data: body };
+    }
+
+    const problem = (body ?? {}) as Record<string, unknown>;
+
+    return {
+      success: false,
+      error: {
+        code: res.status,
+        message: problem.detail ?? problem.title ?? res.statusText,
+        type: problem.errorType ?? problem.type ?? "UNKNOWN_ERROR",
+        extra: problem.extra,
+      },
+    };
+  }
+
+  private async readResponse(res: Response): Promise<unknown> {
+    // NOTE: 204 has no body, the result is the same as a response without
+    // data
+    if (res.status === 204) {
+      return { success: true };
+    }
+
+    return this.unwrapEnvelope(res, await res.json());
+  }
+
+  clearResponseCache() {
+    this.responseCache.clear();
+  }
+
   private getInitialHeaders() {
     const headers: Record<string, string> = {};
 
@@ -55,7 +667,8 @@ export class BaseApiClient {
     dataSchema: DataSchema,
     errorExtraSchema: ErrorExtraSchema,
     body?: unknown,
-    extra?: ExtraOptions
+    extra?: ExtraOptions,
+    endpointOptions: EndpointOptions = {},
   ) {
     const url = createUrl(this.baseUrl, endpoint);
     const headers = this.getInitialHeaders();
@@ -64,6 +677,16 @@ export class BaseApiClient {
       headers["Content-Type"] = "application/json";
     }
 
+    if (endpointOptions.idempotent) {
+      headers["Idempotency-Key"] = crypto.randomUUID();
+    }
+
+    const withCookies = this.applySecurity(
+      headers,
+      url,
+      endpointOptions.security ?? [],
+    );
+
     if (extra) {
       if (extra.headers) {
         for (const [key, value] of Object.entries(extra.headers)) {
@@ -78,15 +701,46 @@ export class BaseApiClient {
       }
     }
 
-    const res = await fetch(url, {
-      method,
-      headers,
-      body: body ? JSON.stringify(body) : null,
-    });
+    const cacheKey = endpointOptions.cached
+      ? this.cacheKey(method, url, headers)
+      : null;
+    const cached =
+      cacheKey !== null ? this.responseCache.get(cacheKey) : undefined;
+
+    if (cached) {
+      if (cached.etag) {
+        headers["If-None-Match"] = cached.etag;
+      }
+
+      if (cached.lastModified) {
+        headers["If-Modified-Since"] = cached.lastModified;
+      }
+    }
+
+    const res = await this.fetchWithBackoff(
+      url,
+      {
+        method,
+        headers,
+        body: body ? JSON.stringify(body) : null,
+        credentials: withCookies ? "include" : undefined,
+      },
+      endpointOptions.rateLimited ?? false,
+    );
 
     const Schema = createApiResponse(dataSchema, errorExtraSchema);
 
-    const data = await res.json();
+    let data: unknown;
+    if (res.status === 304 && cached) {
+      data = cached.data;
+    } else {
+      data = await this.readResponse(res);
+
+      if (cacheKey !== null && res.ok) {
+        this.storeResponse(cacheKey, res, data);
+      }
+    }
+
     const parsedData = await Schema.parseAsync(data);
 
     return parsedData;
@@ -101,11 +755,27 @@ export class BaseApiClient {
     dataSchema: DataSchema,
     errorExtraSchema: ErrorExtraSchema,
     body: FormData,
-    extra?: ExtraOptions
+    extra?: FormOptions,
+    endpointOptions: EndpointOptions = {},
   ) {
+    const Schema = createApiResponse(dataSchema, errorExtraSchema);
+
+    if (endpointOptions.form) {
+      const formError = validateFormData(body, endpointOptions.form);
+      if (formError) {
+        return await Schema.parseAsync(formError);
+      }
+    }
+
     const url = createUrl(this.baseUrl, endpoint);
     const headers = this.getInitialHeaders();
 
+    const withCookies = this.applySecurity(
+      headers,
+      url,
+      endpointOptions.security ?? [],
+    );
+
     if (extra) {
       if (extra.headers) {
         for (const [key, value] of Object.entries(extra.headers)) {
@@ -120,17 +790,351 @@ export class BaseApiClient {
       }
     }
 
-    const res = await fetch(url, {
-      method,
+    const res = await this.fetchWithBackoff(
+      url,
+      {
+        method,
+        headers,
+        body: bodyFirst(body),
+        credentials: withCookies ? "include" : undefined,
+      },
+      endpointOptions.rateLimited ?? false,
+      extra?.onUploadProgress
+        ? (url, init) => fetchWithProgress(url, init, extra.onUploadProgress!)
+        : fetch,
+    );
+
+    const data = await this.readResponse(res);
+    const parsedData = await Schema.parseAsync(data);
+
+    return parsedData;
+  }
+
+  // Downloads the file of a download endpoint, set the Range header in the
+  // extra headers to download a part of the file
+  async download(
+    endpoint: string,
+    method: string,
+    extra?: ExtraOptions,
+    endpointOptions: EndpointOptions = {},
+  ): Promise<DownloadResponse> {
+    const url = createUrl(this.baseUrl, endpoint);
+    const headers = this.getInitialHeaders();
+
+    const withCookies = this.applySecurity(
       headers,
-      body,
-    });
+      url,
+      endpointOptions.security ?? [],
+    );
+
+    if (extra) {
+      if (extra.headers) {
+        for (const [key, value] of Object.entries(extra.headers)) {
+          headers[key] = value;
+        }
+      }
+
+      if (extra.query) {
+        for (const [key, value] of Object.entries(extra.query)) {
+          url.searchParams.set(key, value);
+        }
+      }
+    }
+
+    const res = await this.fetchWithBackoff(
+      url,
+      {
+        method,
+        headers,
+        credentials: withCookies ? "include" : undefined,
+      },
+      endpointOptions.rateLimited ?? false,
+    );
+
+    if (res.status >= 400) {
+      const Schema = createApiResponse(z.undefined(), z.any());
+      const parsed = await Schema.parseAsync(await this.readResponse(res));
+      if (!parsed.success) {
+        return { success: false, error: parsed.error };
+      }
 
+      throw new Error(`unexpected status ${res.status}`);
+    }
+
+    const digest = /sha-256=:([^:]*):/.exec(
+      res.headers.get("Repr-Digest") ?? "",
+    );
+
+    return {
+      success: true,
+      data: {
+        blob: await res.blob(),
+        status: res.status,
+        contentType: res.headers.get("Content-Type"),
+        filename: parseContentDispositionFilename(
+          res.headers.get("Content-Disposition"),
+        ),
+        digest: digest ? digest[1] : null,
+      },
+    };
+  }
+
+  // Sends the file to a upload endpoint in chunks, failed chunks are retried
+  // from the offset the server has. The upload is finalized after the last
+  // chunk and the response of the finalize request is returned
+  async resumableUpload<
+    DataSchema extends z.ZodTypeAny,
+    ErrorExtraSchema extends z.ZodTypeAny
+  >(
+    endpoint: string,
+    dataSchema: DataSchema,
+    errorExtraSchema: ErrorExtraSchema,
+    file: Blob,
+    extra?: UploadOptions,
+    endpointOptions: EndpointOptions = {},
+  ) {
     const Schema = createApiResponse(dataSchema, errorExtraSchema);
 
-    const data = await res.json();
+    const url = createUrl(this.baseUrl, endpoint);
+    const headers = this.getInitialHeaders();
+
+    const withCookies = this.applySecurity(
+      headers,
+      url,
+      endpointOptions.security ?? [],
+    );
+
+    if (extra) {
+      if (extra.headers) {
+        for (const [key, value] of Object.entries(extra.headers)) {
+          headers[key] = value;
+        }
+      }
+
+      if (extra.query) {
+        for (const [key, value] of Object.entries(extra.query)) {
+          url.searchParams.set(key, value);
+        }
+      }
+    }
+
+    const send = (
+      url: URL,
+      method: string,
+      extraHeaders: Record<string, string>,
+      body?: ArrayBuffer,
+    ) =>
+      this.fetchWithBackoff(
+        url,
+        {
+          method,
+          headers: { ...headers, ...extraHeaders },
+          body: body ?? null,
+          credentials: withCookies ? "include" : undefined,
+        },
+        endpointOptions.rateLimited ?? false,
+      );
+
+    // NOTE: HEAD responses has no body so the error is built from the
+    // status
+    const readOffset = async (uploadUrl: URL) => {
+      const res = await send(uploadUrl, "HEAD", {});
+      if (!res.ok) {
+        return Schema.parseAsync({
+          success: false,
+          error: {
+            code: res.status,
+            message: res.statusText,
+            type: "UNKNOWN_ERROR",
+          },
+        });
+      }
+
+      return Number(res.headers.get("Upload-Offset") ?? "0");
+    };
+
+    // NOTE: The query has the api key when the key is sent in the query
+    const withQuery = (uploadUrl: string) => {
+      const res = new URL(uploadUrl, url);
+      url.searchParams.forEach((value, key) => {
+        res.searchParams.set(key, value);
+      });
+
+      return res;
+    };
+
+    let uploadUrl: URL;
+    let offset = 0;
+
+    if (extra?.uploadUrl) {
+      uploadUrl = withQuery(extra.uploadUrl);
+
+      const res = await readOffset(uploadUrl);
+      if (typeof res !== "number") {
+        return res;
+      }
+
+      offset = res;
+    } else {
+      // NOTE: WebCrypto can't hash a stream so the digest of the whole file
+      // isn't sent, every chunk is still checked by the server
+      const res = await send(url, "POST", {
+        "Upload-Length": String(file.size),
+        "Upload-Metadata": encodeUploadMetadata(extra?.metadata ?? {}),
+      });
+      if (!res.ok) {
+        return Schema.parseAsync(await this.readResponse(res));
+      }
+
+      const created = new URL(res.headers.get("Location") ?? "", url);
+      extra?.onCreated?.(created.toString());
+      uploadUrl = withQuery(created.toString());
+    }
+
+    const chunkSize = extra?.chunkSize ?? 8 * 1024 * 1024;
+    const retries = extra?.retries ?? 3;
+    let failures = 0;
+
+    while (offset < file.size) {
+      const chunk = await file.slice(offset, offset + chunkSize).arrayBuffer();
+      const sum = await crypto.subtle.digest("SHA-256", chunk);
+
+      let res: Response;
+      try {
+        res = await send(
+          uploadUrl,
+          "PATCH",
+          {
+            "Content-Type": "application/offset+octet-stream",
+            "Upload-Offset": String(offset),
+            "Upload-Checksum": `sha256 ${toBase64(sum)}`,
+          },
+          chunk,
+        );
+      } catch (err) {
+        // NOTE: Network errors
+        if (++failures > retries) {
+          throw err;
+        }
+
+        res = Response.error();
+      }
+
+      if (res.status === 204) {
+        failures = 0;
+        offset = Number(res.headers.get("Upload-Offset") ?? "0");
+        extra?.onUploadProgress?.({ loaded: offset, total: file.size });
+        continue;
+      }
+
+      if (res.type !== "error") {
+        const parsed = await Schema.parseAsync(await this.readResponse(res));
+        if (
+          parsed.success ||
+          ++failures > retries ||
+          !retryableUploadError(parsed.error)
+        ) {
+          return parsed;
+        }
+      }
+
+      const current = await readOffset(uploadUrl);
+      if (typeof current !== "number") {
+        return current;
+      }
+
+      offset = current;
+    }
+
+    const finalizeUrl = new URL(uploadUrl);
+    finalizeUrl.pathname += "/finalize";
+    const res = await send(finalizeUrl, "POST", {});
+    const data = await this.readResponse(res);
     const parsedData = await Schema.parseAsync(data);
 
     return parsedData;
   }
+
+  // Polls the job until it is finished, returns the result of a completed
+  // job and the error of a failed or canceled job
+  async awaitJob<
+    DataSchema extends z.ZodTypeAny,
+    ErrorExtraSchema extends z.ZodTypeAny
+  >(
+    endpoint: string,
+    dataSchema: DataSchema,
+    errorExtraSchema: ErrorExtraSchema,
+    extra?: JobOptions,
+    endpointOptions: EndpointOptions = {},
+  ) {
+    const Schema = createApiResponse(dataSchema, errorExtraSchema);
+    const JobSchema = createApiResponse(createJobSchema(z.any()), z.any());
+
+    const url = createUrl(this.baseUrl, endpoint);
+    const headers = this.getInitialHeaders();
+
+    const withCookies = this.applySecurity(
+      headers,
+      url,
+      endpointOptions.security ?? [],
+    );
+
+    if (extra) {
+      if (extra.headers) {
+        for (const [key, value] of Object.entries(extra.headers)) {
+          headers[key] = value;
+        }
+      }
+
+      if (extra.query) {
+        for (const [key, value] of Object.entries(extra.query)) {
+          url.searchParams.set(key, value);
+        }
+      }
+    }
+
+    const deadline =
+      extra?.timeout !== undefined ? Date.now() + extra.timeout : null;
+
+    for (;;) {
+      const res = await this.fetchWithBackoff(
+        url,
+        {
+          method: "GET",
+          headers,
+          credentials: withCookies ? "include" : undefined,
+        },
+        endpointOptions.rateLimited ?? false,
+      );
+
+      const job = await JobSchema.parseAsync(await this.readResponse(res));
+      if (!job.success) {
+        return Schema.parseAsync(job);
+      }
+
+      switch (job.data.state) {
+        case "completed":
+          return Schema.parseAsync({ success: true, data: job.data.result });
+        case "failed":
+        case "canceled":
+          return Schema.parseAsync({ success: false, error: job.data.error });
+      }
+
+      // NOTE: Browsers only exposes Retry-After to other origins when the
+      // server lists it in Access-Control-Expose-Headers
+      const retryAfter = Number(res.headers.get("Retry-After") ?? "");
+      let wait =
+        extra?.pollInterval ??
+        (endpointOptions.job?.pollInterval ?? 1) * 1000;
+      if (retryAfter > 0) {
+        wait = retryAfter * 1000;
+      }
+
+      if (deadline !== null && Date.now() + wait > deadline) {
+        throw new Error("job did not finish before the timeout");
+      }
+
+      await new Promise((resolve) => setTimeout(resolve, wait));
+    }
+  }
 }
@@ -3,12 +3,15 @@ package typescript
 import (
 	"bytes"
 	_ "embed"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/iancoleman/strcase"
+	"github.com/nanoteck137/pyrin"
 	"github.com/nanoteck137/pyrin/spark"
 	"github.com/nanoteck137/pyrin/utils"
 )
@@ -83,6 +86,44 @@ func (g *TypescriptGenerator) mapFieldName(field *spark.ResolvedField) string {
 	return field.Name
 }
 
+// writeDoc writes doc as a TSDoc comment
+func writeDoc(w *spark.CodeWriter, doc string) {
+	if doc == "" {
+		return
+	}
+
+	w.IndentWritef("/**\n")
+	for _, line := range strings.Split(doc, "\n") {
+		line = strings.ReplaceAll(line, "*/", "*\\/")
+
+		if line == "" {
+			w.IndentWritef(" *\n")
+		} else {
+			w.IndentWritef(" * %s\n", line)
+		}
+	}
+	w.IndentWritef(" */\n")
+}
+
+func (g *TypescriptGenerator) writeEndpointDoc(w *spark.CodeWriter, e *spark.Endpoint) {
+	doc := e.FullDoc()
+
+	if e.Deprecated != nil {
+		replacement := ""
+		if e.Deprecated.Replacement != "" {
+			replacement = g.mapName(strcase.ToLowerCamel(e.Deprecated.Replacement))
+		}
+
+		if doc != "" {
+			doc += "\n\n"
+		}
+
+		doc += "@deprecated " + e.Deprecated.DeprecationMessage(replacement)
+	}
+
+	writeDoc(w, doc)
+}
+
 func (g *TypescriptGenerator) generateTypeDefinitionCode(out io.Writer, resolver *spark.Resolver) error {
 	w := spark.NewCodeWriter(out, indent)
 
@@ -106,6 +147,7 @@ func (g *TypescriptGenerator) generateStruct(w *spark.CodeWriter, rs *spark.Reso
 	name := g.mapName(rs.Name)
 
 	w.IndentWritef("// Name: %s\n", rs.Name)
+	writeDoc(w, rs.Doc)
 	err := w.Writef("export const %s = z.object({\n", name)
 	if err != nil {
 		return err
@@ -114,6 +156,7 @@ func (g *TypescriptGenerator) generateStruct(w *spark.CodeWriter, rs *spark.Reso
 	w.Indent()
 	for _, field := range rs.Fields {
 		w.IndentWritef("// Name: %s\n", field.FullyQualifiedName)
+		writeDoc(w, field.Doc)
 
 		err = w.WriteIndent()
 		if err != nil {
@@ -164,9 +207,13 @@ func (g *TypescriptGenerator) generateFieldType(w *spark.CodeWriter, ty spark.Fi
 
 func (g *TypescriptGenerator) generateField(w *spark.CodeWriter, field *spark.ResolvedField) {
 	w.Writef("\"%s\": ", field.Name)
-	g.generateFieldType(w, field.Type)
+	g.generateFieldType(w, field.BaseType())
+
+	if field.Nullable {
+		w.Writef(".nullable()")
+	}
 
-	if field.OmitEmpty {
+	if field.Optional {
 		w.Writef(".optional()")
 	}
 
@@ -182,6 +229,7 @@ func (g *TypescriptGenerator) generateApiEndpoint(w *spark.CodeWriter, e *spark.
 	response := g.mapName(e.Response)
 	body := g.mapName(e.Body)
 
+	g.writeEndpointDoc(w, e)
 	w.IndentWritef("%s", name)
 	w.Writef("(")
 
@@ -225,6 +273,10 @@ func (g *TypescriptGenerator) generateApiEndpoint(w *spark.CodeWriter, e *spark.
 
 	w.Writef(", options")
 
+	if opts := endpointOptions(e); opts != "" {
+		w.Writef(", %s", opts)
+	}
+
 	w.Writef(")\n")
 	w.Unindent()
 
@@ -233,6 +285,37 @@ func (g *TypescriptGenerator) generateApiEndpoint(w *spark.CodeWriter, e *spark.
 	return nil
 }
 
+// generatePageIterator generates a method that returns a async generator
+// over the items of every page of a paginated endpoint
+func (g *TypescriptGenerator) generatePageIterator(w *spark.CodeWriter, e *spark.Endpoint) {
+	_, args := utils.ReplacePathArgs(e.Path, g.mapName, func(name string) string {
+		return "${" + name + "}"
+	})
+
+	name := g.mapName(strcase.ToLowerCamel(e.Name))
+	body := g.mapName(e.Body)
+
+	params := strings.Builder{}
+	callArgs := strings.Builder{}
+
+	for _, arg := range args {
+		fmt.Fprintf(&params, "%s: string, ", arg)
+		fmt.Fprintf(&callArgs, "%s, ", arg)
+	}
+
+	if body != "" {
+		fmt.Fprintf(&params, "body: api.%s, ", body)
+		fmt.Fprintf(&callArgs, "body, ")
+	}
+
+	writeDoc(w, fmt.Sprintf("Walks every page of %s", name))
+	w.IndentWritef("iterate%s(%soptions?: ExtraOptions) {\n", strcase.ToCamel(name), params.String())
+	w.Indent()
+	w.IndentWritef("return paginate(%q, options, (extra) => this.%s(%sextra));\n", e.Pagination.Style, name, callArgs.String())
+	w.Unindent()
+	w.IndentWritef("}\n")
+}
+
 func (g *TypescriptGenerator) generateFormEndpoint(w *spark.CodeWriter, e *spark.Endpoint) error {
 	newPath, args := utils.ReplacePathArgs(e.Path, g.mapName, func(name string) string {
 		return "${" + name + "}"
@@ -240,8 +323,14 @@ func (g *TypescriptGenerator) generateFormEndpoint(w *spark.CodeWriter, e *spark
 
 	name := g.mapName(strcase.ToLowerCamel(e.Name))
 	response := g.mapName(e.Response)
-	// body := g.mapName(e.Body)
+	body := g.mapName(e.Body)
+
+	var files []spark.FormFileDef
+	if e.Form != nil {
+		files = e.Form.Files
+	}
 
+	g.writeEndpointDoc(w, e)
 	w.IndentWritef("%s", name)
 	w.Writef("(")
 
@@ -249,9 +338,32 @@ func (g *TypescriptGenerator) generateFormEndpoint(w *spark.CodeWriter, e *spark
 		w.Writef("%s: string, ", arg)
 	}
 
-	w.Writef("body: FormData, ")
+	if body != "" {
+		w.Writef("body: api.%s, ", body)
+	}
+
+	if len(files) > 0 {
+		w.Writef("files: { ")
+		for i, file := range files {
+			if i > 0 {
+				w.Writef("; ")
+			}
+
+			key, _ := json.Marshal(file.Name)
 
-	w.Writef("options?: ExtraOptions")
+			// NOTE(patrik): The field can be left out when the server
+			// accepts no files
+			optional := ""
+			if file.Optional || file.MinFiles == 0 {
+				optional = "?"
+			}
+
+			w.Writef("%s%s: Blob[]", key, optional)
+		}
+		w.Writef(" }, ")
+	}
+
+	w.Writef("options?: FormOptions")
 
 	w.Writef(") {\n")
 
@@ -275,10 +387,69 @@ func (g *TypescriptGenerator) generateFormEndpoint(w *spark.CodeWriter, e *spark
 
 	w.Writef(", z.any()")
 
-	w.Writef(", body")
+	bodyArg := "undefined"
+	if body != "" {
+		bodyArg = "body"
+	}
+
+	filesArg := "{}"
+	if len(files) > 0 {
+		filesArg = "files"
+	}
+
+	w.Writef(", createFormData(%s, %s)", bodyArg, filesArg)
+
+	w.Writef(", options")
+
+	if opts := endpointOptions(e); opts != "" {
+		w.Writef(", %s", opts)
+	}
+
+	w.Writef(")\n")
+	w.Unindent()
+
+	w.IndentWritef("}\n")
+
+	return nil
+}
+
+func (g *TypescriptGenerator) generateDownloadEndpoint(w *spark.CodeWriter, e *spark.Endpoint) error {
+	newPath, args := utils.ReplacePathArgs(e.Path, g.mapName, func(name string) string {
+		return "${" + name + "}"
+	})
+
+	name := g.mapName(strcase.ToLowerCamel(e.Name))
+
+	g.writeEndpointDoc(w, e)
+	w.IndentWritef("%s", name)
+	w.Writef("(")
+
+	for _, arg := range args {
+		w.Writef("%s: string, ", arg)
+	}
+
+	w.Writef("options?: ExtraOptions")
+
+	w.Writef(") {\n")
+
+	w.Indent()
+
+	w.IndentWritef("return this.download(")
+
+	if len(args) > 0 {
+		w.Writef("`%s`", newPath)
+	} else {
+		w.Writef("\"%s\"", newPath)
+	}
+
+	w.Writef(", \"%s\"", e.Method)
 
 	w.Writef(", options")
 
+	if opts := endpointOptions(e); opts != "" {
+		w.Writef(", %s", opts)
+	}
+
 	w.Writef(")\n")
 	w.Unindent()
 
@@ -287,6 +458,145 @@ func (g *TypescriptGenerator) generateFormEndpoint(w *spark.CodeWriter, e *spark
 	return nil
 }
 
+func (g *TypescriptGenerator) generateUploadEndpoint(w *spark.CodeWriter, e *spark.Endpoint) error {
+	newPath, args := utils.ReplacePathArgs(e.Path, g.mapName, func(name string) string {
+		return "${" + name + "}"
+	})
+
+	name := g.mapName(strcase.ToLowerCamel(e.Name))
+	response := g.mapName(e.Response)
+
+	g.writeEndpointDoc(w, e)
+	w.IndentWritef("%s", name)
+	w.Writef("(")
+
+	for _, arg := range args {
+		w.Writef("%s: string, ", arg)
+	}
+
+	w.Writef("file: Blob, options?: UploadOptions")
+
+	w.Writef(") {\n")
+
+	w.Indent()
+
+	w.IndentWritef("return this.resumableUpload(")
+
+	if len(args) > 0 {
+		w.Writef("`%s`", newPath)
+	} else {
+		w.Writef("\"%s\"", newPath)
+	}
+
+	// NOTE(patrik): The response of OnComplete is untyped when the handler
+	// has no ResponseType
+	if response != "" {
+		w.Writef(", api.%s", response)
+	} else {
+		w.Writef(", z.any()")
+	}
+
+	w.Writef(", z.any()")
+
+	w.Writef(", file, options")
+
+	if opts := endpointOptions(e); opts != "" {
+		w.Writef(", %s", opts)
+	}
+
+	w.Writef(")\n")
+	w.Unindent()
+
+	w.IndentWritef("}\n")
+
+	return nil
+}
+
+// generateJobEndpoint generates the method that starts the job and the
+// methods that reads, cancels and awaits the jobs of the endpoint
+func (g *TypescriptGenerator) generateJobEndpoint(w *spark.CodeWriter, e *spark.Endpoint) error {
+	newPath, args := utils.ReplacePathArgs(e.Path, g.mapName, func(name string) string {
+		return "${" + name + "}"
+	})
+
+	name := g.mapName(strcase.ToLowerCamel(e.Name))
+	typeName := strcase.ToCamel(name)
+	body := g.mapName(e.Body)
+
+	result := "z.any()"
+	if e.Response != "" {
+		result = "api." + g.mapName(e.Response)
+	}
+
+	opts := endpointOptions(e)
+
+	writeMethod := func(methodName, params, optionsType, subPath, call string) {
+		w.IndentWritef("%s", methodName)
+		w.Writef("(")
+
+		for _, arg := range args {
+			w.Writef("%s: string, ", arg)
+		}
+
+		w.Writef("%soptions?: %s", params, optionsType)
+
+		w.Writef(") {\n")
+
+		w.Indent()
+
+		w.IndentWritef("return %s(", call)
+
+		if len(args) > 0 || subPath != "" {
+			w.Writef("`%s%s`", newPath, subPath)
+		} else {
+			w.Writef("\"%s\"", newPath)
+		}
+	}
+
+	endCall := func() {
+		if opts != "" {
+			w.Writef(", %s", opts)
+		}
+
+		w.Writef(")\n")
+		w.Unindent()
+
+		w.IndentWritef("}\n")
+	}
+
+	bodyParam := ""
+	bodyArg := "undefined"
+	if body != "" {
+		bodyParam = fmt.Sprintf("body: api.%s, ", body)
+		bodyArg = "body"
+	}
+
+	g.writeEndpointDoc(w, e)
+	writeMethod(name, bodyParam, "ExtraOptions", "", "this.request")
+	w.Writef(", \"%s\", createJobSchema(%s), z.any(), %s, options", e.Method, result, bodyArg)
+	endCall()
+
+	w.Writef("\n")
+	writeDoc(w, fmt.Sprintf("Returns a job started by %s", name))
+	writeMethod("get"+typeName+"Job", "jobId: string, ", "ExtraOptions", "/${jobId}", "this.request")
+	w.Writef(", \"GET\", createJobSchema(%s), z.any(), undefined, options", result)
+	endCall()
+
+	w.Writef("\n")
+	writeDoc(w, fmt.Sprintf("Cancels a job started by %s", name))
+	writeMethod("cancel"+typeName+"Job", "jobId: string, ", "ExtraOptions", "/${jobId}/cancel", "this.request")
+	w.Writef(", \"POST\", createJobSchema(%s), z.any(), undefined, options", result)
+	endCall()
+
+	w.Writef("\n")
+	writeDoc(w, fmt.Sprintf("Waits for a job started by %s and returns the result", name))
+	writeMethod("await"+typeName+"Job", "jobId: string, ", "JobOptions", "/${jobId}", "this.awaitJob")
+	w.Writef(", %s, z.any(), options", result)
+	endCall()
+
+	return nil
+}
+
 func (g *TypescriptGenerator) generateUrlForEndpoint(w *spark.CodeWriter, e *spark.Endpoint) error {
 	newPath, args := utils.ReplacePathArgs(e.Path, g.mapName, func(name string) string {
 		return "${" + name + "}"
@@ -294,6 +604,7 @@ func (g *TypescriptGenerator) generateUrlForEndpoint(w *spark.CodeWriter, e *spa
 
 	name := g.mapName(strcase.ToLowerCamel(e.Name))
 
+	g.writeEndpointDoc(w, e)
 	w.IndentWritef("%s", name)
 	w.Writef("(")
 
@@ -325,12 +636,95 @@ func (g *TypescriptGenerator) generateUrlForEndpoint(w *spark.CodeWriter, e *spa
 	return nil
 }
 
+func securityList(security []string) string {
+	var b strings.Builder
+
+	b.WriteString("[")
+	for i, name := range security {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+
+		fmt.Fprintf(&b, "%q", name)
+	}
+	b.WriteString("]")
+
+	return b.String()
+}
+
+// endpointOptions returns the EndpointOptions of the endpoint for the base
+// client, empty when the endpoint has no options
+func endpointOptions(e *spark.Endpoint) string {
+	var opts []string
+
+	if len(e.Security) > 0 {
+		opts = append(opts, "security: "+securityList(e.Security))
+	}
+
+	if len(e.RateLimits) > 0 {
+		opts = append(opts, "rateLimited: true")
+	}
+
+	if e.Idempotency != nil {
+		opts = append(opts, "idempotent: true")
+	}
+
+	if e.Cache != nil && e.Cache.Conditional {
+		opts = append(opts, "cached: true")
+	}
+
+	if e.Form.HasConstraints() {
+		// NOTE(patrik): The json of the FormDef is the same as the FormSpec
+		// type in the base client
+		d, _ := json.Marshal(e.Form)
+		opts = append(opts, "form: "+string(d))
+	}
+
+	if e.Job != nil && e.Job.PollInterval > 0 {
+		opts = append(opts, fmt.Sprintf("job: { pollInterval: %d }", e.Job.PollInterval))
+	}
+
+	if len(opts) == 0 {
+		return ""
+	}
+
+	return "{ " + strings.Join(opts, ", ") + " }"
+}
+
+func (g *TypescriptGenerator) generateSecurityHelper(w *spark.CodeWriter, scheme *spark.SecuritySchemeDef) {
+	name := strcase.ToCamel(scheme.Name)
+
+	switch scheme.Type {
+	case "bearer":
+		w.IndentWritef("set%sToken(token: string | null) {\n", name)
+		w.Indent()
+		w.IndentWritef("this.setCredential(%q, token);\n", scheme.Name)
+	case "apiKey":
+		w.IndentWritef("set%sApiKey(apiKey: string | null) {\n", name)
+		w.Indent()
+		w.IndentWritef("this.setCredential(%q, apiKey);\n", scheme.Name)
+	case "basic":
+		w.IndentWritef("set%sCredentials(credentials: { username: string; password: string } | null) {\n", name)
+		w.Indent()
+		w.IndentWritef("this.setCredential(%q, credentials ? btoa(`${credentials.username}:${credentials.password}`) : null);\n", scheme.Name)
+	case "cookie":
+		w.IndentWritef("set%sCookie(value: string | null) {\n", name)
+		w.Indent()
+		w.IndentWritef("this.setCredential(%q, value);\n", scheme.Name)
+	default:
+		return
+	}
+
+	w.Unindent()
+	w.IndentWritef("}\n")
+}
+
 func (g *TypescriptGenerator) generateClientCode(out io.Writer, serverDef *spark.ServerDef) error {
 	w := spark.NewCodeWriter(out, indent)
 
 	w.Writef("import { z } from \"zod\";\n")
 	w.Writef("import * as api from \"./types\";\n")
-	w.Writef("import { BaseApiClient, createUrl, type ExtraOptions } from \"./base-client\";\n")
+	w.Writef("import { BaseApiClient, createFormData, createJobSchema, createUrl, paginate, type ExtraOptions, type FormOptions, type JobOptions, type UploadOptions } from \"./base-client\";\n")
 	w.Writef("\n")
 
 	w.Writef("\n")
@@ -346,10 +740,43 @@ func (g *TypescriptGenerator) generateClientCode(out io.Writer, serverDef *spark
 	w.Indent()
 	w.IndentWritef("super(baseUrl);\n")
 	w.IndentWritef("this.url = new ClientUrls(baseUrl);\n")
+
+	envelope, err := serverDef.ResponseEnvelope()
+	if err != nil {
+		return err
+	}
+
+	if envelope != pyrin.EnvelopeDefault {
+		w.IndentWritef("this.envelope = %q;\n", envelope)
+	}
+
+	if len(serverDef.SecuritySchemes) > 0 {
+		w.IndentWritef("this.securitySchemes = {\n")
+		w.Indent()
+		for _, scheme := range serverDef.SecuritySchemes {
+			w.IndentWritef("%q: ", scheme.Name)
+			switch scheme.Type {
+			case "apiKey":
+				w.Writef("{ type: \"apiKey\", in: %q, paramName: %q },\n", scheme.In, scheme.ParamName)
+			case "cookie":
+				w.Writef("{ type: \"cookie\", paramName: %q },\n", scheme.ParamName)
+			default:
+				w.Writef("{ type: %q },\n", scheme.Type)
+			}
+		}
+		w.Unindent()
+		w.IndentWritef("};\n")
+	}
+
 	w.Unindent()
 
 	w.IndentWritef("}\n")
 
+	for _, scheme := range serverDef.SecuritySchemes {
+		w.Writef("\n")
+		g.generateSecurityHelper(&w, &scheme)
+	}
+
 	for _, endpoint := range serverDef.Endpoints {
 		w.IndentWritef("\n")
 
@@ -359,11 +786,31 @@ func (g *TypescriptGenerator) generateClientCode(out io.Writer, serverDef *spark
 			if err != nil {
 				return err
 			}
+
+			if endpoint.Pagination != nil {
+				w.Writef("\n")
+				g.generatePageIterator(&w, &endpoint)
+			}
 		case spark.EndpointTypeForm:
 			err := g.generateFormEndpoint(&w, &endpoint)
 			if err != nil {
 				return err
 			}
+		case spark.EndpointTypeDownload:
+			err := g.generateDownloadEndpoint(&w, &endpoint)
+			if err != nil {
+				return err
+			}
+		case spark.EndpointTypeUpload:
+			err := g.generateUploadEndpoint(&w, &endpoint)
+			if err != nil {
+				return err
+			}
+		case spark.EndpointTypeJob:
+			err := g.generateJobEndpoint(&w, &endpoint)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
@@ -1,6 +1,11 @@
 package pyrin
 
-import "net/http"
+import (
+	"net/http"
+	"time"
+
+	"github.com/nanoteck137/pyrin/chisel"
+)
 
 const formBodyKey = "body"
 
@@ -25,39 +30,137 @@ type Handler interface {
 
 type MiddlewareFunc func(http.Handler) http.Handler
 
+// Middleware is a middleware that can be added to a group with Group.With
+type Middleware interface {
+	middlewareType()
+}
+
+func (m MiddlewareFunc) middlewareType() {}
+
+// MetaMiddleware attaches metadata to every handler registered on the
+// group, spark records the metadata on the endpoints so the clients and docs
+// knows about it, e.g. {"auth": "required"}. Middleware is optional
+type MetaMiddleware struct {
+	Meta       map[string]string
+	Middleware MiddlewareFunc
+}
+
+func (m MetaMiddleware) middlewareType() {}
+
+// WithMeta creates a MetaMiddleware, middleware can be nil when only the
+// metadata is needed
+func WithMeta(meta map[string]string, middleware MiddlewareFunc) MetaMiddleware {
+	return MetaMiddleware{
+		Meta:       meta,
+		Middleware: middleware,
+	}
+}
+
+// ContextMiddlewareFunc is a middleware that runs with the Context of the
+// handler, after the net/http middlewares and the authentication. Calling
+// next runs the rest of the chain and returns its error, the error returned
+// by the middleware is sent through the error handler of the server
+type ContextMiddlewareFunc func(c Context, next func() error) error
+
+func (m ContextMiddlewareFunc) middlewareType() {}
+
+// Deprecation marks a handler as deprecated, the server sends the
+// Deprecation and Sunset headers and the generated clients mark the method
+// as deprecated
+type Deprecation struct {
+	// Message is shown to the users of the generated clients
+	Message string
+	// Replacement is the name of the handler that should be used instead
+	Replacement string
+	Since       time.Time
+	Sunset      time.Time
+}
+
 type ApiHandlerFunc func(c Context) (any, error)
 
 type ApiHandler struct {
 	Name         string
 	Method       string
 	Path         string
+	Summary      string
+	Description  string
+	Tags         []string
+	Deprecated   *Deprecation
 	ResponseType any
 	BodyType     any
-	Errors       []ErrorType
-	Middlewares  []MiddlewareFunc
-	HandlerFunc  ApiHandlerFunc
+	// Status is the status of the successful responses, defaults to 200.
+	// Return a Result to change the status of a single response, 204 sends
+	// no body
+	Status      int
+	Security    []*SecurityScheme
+	RateLimit   *RateLimitPolicy
+	Idempotency *IdempotencyPolicy
+	Cache       *CachePolicy
+	// Pagination marks the handler as a paginated list, the handler
+	// returns a Page
+	Pagination *PaginationPolicy
+	// Filter is the fields the handler can be filtered and sorted by, the
+	// handler reads the query with ParseFilter. Register panics when the
+	// schema is invalid
+	Filter      *chisel.Schema
+	Errors      []ErrorType
+	Middlewares []MiddlewareFunc
+	HandlerFunc ApiHandlerFunc
 }
 
 func (h ApiHandler) handlerType() {}
 
 type FormFileSpec struct {
+	// NumExpected is the minimum number of files
 	NumExpected int
+	// Optional allows the field to have no files, the other limits are
+	// only checked when files are sent
+	Optional bool
+	// MaxFiles is the maximum number of files, 0 is unlimited
+	MaxFiles int
+	// MaxFileSize is the maximum size of a file in bytes, 0 is unlimited
+	MaxFileSize int64
+	// AllowedMimeTypes is the media types the files can have, e.g.
+	// "image/png" or "image/*". The type is sniffed from the content of
+	// the file, the Content-Type of the part is only used when the content
+	// is not recognized
+	AllowedMimeTypes []string
 }
 
 type FormSpec struct {
 	BodyType any
-	Files    map[string]FormFileSpec
+	// OptionalBody allows the form to be sent without the body
+	OptionalBody bool
+	// MaxTotalSize is the maximum size of all the files in the Files
+	// fields in bytes, 0 is unlimited. The request is cut off at
+	// MaxTotalSize with room for the body and the headers of the parts
+	MaxTotalSize int64
+	Files        map[string]FormFileSpec
 }
 
 type FormApiHandler struct {
 	Name         string
 	Method       string
 	Path         string
+	Summary      string
+	Description  string
+	Tags         []string
+	Deprecated   *Deprecation
 	ResponseType any
 	Spec         FormSpec
-	Errors       []ErrorType
-	Middlewares  []MiddlewareFunc
-	HandlerFunc  ApiHandlerFunc
+	// Streaming reads the form while the handler runs instead of parsing
+	// the whole form before, the handler reads the files with FormParts.
+	// The body needs to be the first part of the form. The parts the
+	// handler didn't read is checked against the spec after the handler
+	// returns, the response is then the error of the spec
+	Streaming bool
+	// Status is the status of the successful responses, defaults to 200
+	Status      int
+	Security    []*SecurityScheme
+	RateLimit   *RateLimitPolicy
+	Errors      []ErrorType
+	Middlewares []MiddlewareFunc
+	HandlerFunc ApiHandlerFunc
 }
 
 func (h FormApiHandler) handlerType() {}
@@ -68,6 +171,12 @@ type NormalHandler struct {
 	Name        string
 	Method      string
 	Path        string
+	Summary     string
+	Description string
+	Tags        []string
+	Deprecated  *Deprecation
+	Security    []*SecurityScheme
+	RateLimit   *RateLimitPolicy
 	Middlewares []MiddlewareFunc
 	HandlerFunc NormalHandlerFunc
 }
@@ -75,9 +184,21 @@ type NormalHandler struct {
 func (h NormalHandler) handlerType() {}
 
 type Router interface {
+	// Group creates a group for prefix, the middlewares also runs for the
+	// unmatched requests below the prefix (404, 405 and OPTIONS). The
+	// middlewares is plain functions so spark can't see them, add the
+	// security, rate limits and metadata with With
 	Group(prefix string, middlewares ...MiddlewareFunc) Group
 }
 
 type Group interface {
 	Register(handlers ...Handler)
+	// Group creates a subgroup, the prefix is added to the prefix of the
+	// group and the middlewares run after the middlewares of the group.
+	// Like Router.Group the middlewares also runs for the unmatched
+	// requests below the prefix and is not recorded by spark
+	Group(prefix string, middlewares ...MiddlewareFunc) Group
+	// With returns a group with the same prefix and the extra middlewares,
+	// the middlewares only runs for the handlers registered on the group
+	With(middlewares ...Middleware) Group
 }
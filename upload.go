@@ -0,0 +1,571 @@
+package pyrin
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	uploadOffsetHeader   = "Upload-Offset"
+	uploadLengthHeader   = "Upload-Length"
+	uploadExpiresHeader  = "Upload-Expires"
+	uploadMetadataHeader = "Upload-Metadata"
+	uploadChecksumHeader = "Upload-Checksum"
+	reprDigestHeader     = "Repr-Digest"
+
+	uploadChunkMimeType = "application/offset+octet-stream"
+)
+
+const defaultUploadExpiry = 24 * time.Hour
+
+// UploadStatus is the response when a upload is created
+type UploadStatus struct {
+	Id      string    `json:"id"`
+	Offset  int64     `json:"offset"`
+	Length  int64     `json:"length"`
+	Expires time.Time `json:"expires"`
+}
+
+type UploadCompleteFunc func(c Context, upload *UploadInfo, content io.Reader) (any, error)
+
+// UploadHandler is a resumable upload, the upload is sent in chunks and can
+// continue after the connection is lost. Registers the routes:
+//
+//	POST  Path              creates the upload, the size of the file is
+//	                        sent in Upload-Length
+//	HEAD  Path/:id          returns the Upload-Offset of the upload
+//	PATCH Path/:id          writes a chunk at the Upload-Offset
+//	POST  Path/:id/finalize calls OnComplete with the file
+//
+// The chunks can have a "Upload-Checksum: sha256 <base64>" header and the
+// create request a "Repr-Digest: sha-256=:<base64>:" header with the
+// SHA-256 of the whole file. Browsers on another origin needs the Upload-*
+// headers in CorsConfig.ExposedHeaders
+type UploadHandler struct {
+	Name        string
+	Path        string
+	Summary     string
+	Description string
+	Tags        []string
+	Deprecated  *Deprecation
+	// ResponseType is the type returned by OnComplete
+	ResponseType any
+	// MaxSize is the maximum size of the file in bytes, 0 is unlimited
+	MaxSize int64
+	// Expiry is how long an unfinished upload is kept, defaults to 24 hours
+	Expiry time.Duration
+	// RequireChecksum rejects the chunks without a Upload-Checksum header
+	RequireChecksum bool
+	// Store defaults to the UploadStore of the server
+	Store       UploadStore
+	Security    []*SecurityScheme
+	RateLimit   *RateLimitPolicy
+	Errors      []ErrorType
+	Middlewares []MiddlewareFunc
+	// OnComplete is called by finalize when the whole file is uploaded and
+	// is required, the upload is removed after OnComplete returns without
+	// an error. When the removal fails the error is sent to the
+	// ErrorCallback of the server and the client still gets the result. A
+	// upload is finalized by one request at a time, the others gets
+	// UPLOAD_LOCKED. The lock is kept by the server so a store shared by
+	// multiple servers needs a lock of its own
+	OnComplete UploadCompleteFunc
+}
+
+func (h UploadHandler) handlerType() {}
+
+func (h *UploadHandler) expiry() time.Duration {
+	if h.Expiry > 0 {
+		return h.Expiry
+	}
+
+	return defaultUploadExpiry
+}
+
+func newRandomId() (string, error) {
+	var b [16]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b[:]), nil
+}
+
+// NOTE(patrik): The id is used in the paths of the store so only ids
+// created by newRandomId are accepted
+func validUploadId(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// parseUploadMetadata parses the tus Upload-Metadata header,
+// "key base64,key2 base64"
+func parseUploadMetadata(header string) (map[string]string, bool) {
+	res := make(map[string]string)
+
+	if strings.TrimSpace(header) == "" {
+		return res, true
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, false
+		}
+
+		d, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, false
+		}
+
+		res[key] = string(d)
+	}
+
+	return res, true
+}
+
+// parseReprDigest returns the sha-256 digest of a Repr-Digest header
+func parseReprDigest(header string) ([]byte, bool) {
+	for _, part := range strings.Split(header, ",") {
+		algorithm, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found || algorithm != "sha-256" {
+			continue
+		}
+
+		digest, err := base64.StdEncoding.DecodeString(strings.Trim(value, ":"))
+		if err != nil || len(digest) != sha256.Size {
+			return nil, false
+		}
+
+		return digest, true
+	}
+
+	return nil, false
+}
+
+// parseUploadChecksum parses the tus Upload-Checksum header, only sha256
+// is supported
+func parseUploadChecksum(header string) ([]byte, bool) {
+	algorithm, value, found := strings.Cut(header, " ")
+	if !found || algorithm != "sha256" {
+		return nil, false
+	}
+
+	checksum, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(checksum) != sha256.Size {
+		return nil, false
+	}
+
+	return checksum, true
+}
+
+func headerError(header, message string) *Error {
+	return ValidationError(map[string]string{
+		header: message,
+	})
+}
+
+// chunkReader reads a chunk and fails when the chunk is larger than the
+// rest of the upload or the checksum doesn't match
+type chunkReader struct {
+	r         io.Reader
+	length    int64
+	remaining int64
+	read      int64
+
+	hash     hash.Hash
+	checksum []byte
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+
+	if c.read > c.remaining {
+		return 0, fmt.Errorf("%w: %w", ErrDiscardChunk, UploadTooLarge(c.length))
+	}
+
+	if c.hash != nil {
+		c.hash.Write(p[:n])
+
+		if err == io.EOF && !bytes.Equal(c.hash.Sum(nil), c.checksum) {
+			return n, fmt.Errorf("%w: %w", ErrDiscardChunk, UploadChecksumMismatch())
+		}
+
+		// NOTE(patrik): The checksum is for the whole chunk so a partial
+		// chunk can't be trusted
+		if err != nil && err != io.EOF {
+			return n, fmt.Errorf("%w: %w", ErrDiscardChunk, err)
+		}
+	}
+
+	return n, err
+}
+
+func writeUploadHeaders(w http.ResponseWriter, info *UploadInfo) {
+	header := w.Header()
+	header.Set(uploadOffsetHeader, strconv.FormatInt(info.Offset, 10))
+	header.Set(uploadLengthHeader, strconv.FormatInt(info.Length, 10))
+	header.Set(uploadExpiresHeader, info.Expires.UTC().Format(http.TimeFormat))
+	header.Set("Cache-Control", "no-store")
+}
+
+// getUpload returns the upload of the :id path parameter, expired uploads
+// are removed
+func (h *UploadHandler) getUpload(ctx *wrapperContext, store UploadStore) (*UploadInfo, error) {
+	id := ctx.Param("id")
+	if !validUploadId(id) {
+		return nil, UploadNotFound()
+	}
+
+	info, err := store.Get(ctx.r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	if info == nil {
+		return nil, UploadNotFound()
+	}
+
+	if time.Now().After(info.Expires) {
+		err := store.Delete(ctx.r.Context(), id)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, UploadExpired()
+	}
+
+	return info, nil
+}
+
+func (h *UploadHandler) create(ctx *wrapperContext, store UploadStore) error {
+	length, err := strconv.ParseInt(ctx.r.Header.Get(uploadLengthHeader), 10, 64)
+	if err != nil || length < 0 {
+		return headerError(uploadLengthHeader, "expected the size of the file")
+	}
+
+	if h.MaxSize > 0 && length > h.MaxSize {
+		return UploadTooLarge(h.MaxSize)
+	}
+
+	metadata, ok := parseUploadMetadata(ctx.r.Header.Get(uploadMetadataHeader))
+	if !ok {
+		return headerError(uploadMetadataHeader, "expected \"key base64\" pairs")
+	}
+
+	var digest []byte
+	if header := ctx.r.Header.Get(reprDigestHeader); header != "" {
+		digest, ok = parseReprDigest(header)
+		if !ok {
+			return headerError(reprDigestHeader, "expected a sha-256 digest")
+		}
+	}
+
+	id, err := newRandomId()
+	if err != nil {
+		return err
+	}
+
+	info := UploadInfo{
+		Id:       id,
+		Length:   length,
+		Metadata: metadata,
+		Digest:   digest,
+		Expires:  time.Now().Add(h.expiry()).Truncate(time.Second),
+	}
+
+	err = store.Create(ctx.r.Context(), info)
+	if err != nil {
+		return err
+	}
+
+	writeUploadHeaders(ctx.w, &info)
+
+	location := strings.TrimSuffix(ctx.r.URL.Path, "/") + "/" + id
+	writeApiResult(ctx, 0, Created(UploadStatus{
+		Id:      info.Id,
+		Offset:  info.Offset,
+		Length:  info.Length,
+		Expires: info.Expires,
+	}, location))
+
+	return nil
+}
+
+func (h *UploadHandler) offset(ctx *wrapperContext, store UploadStore) error {
+	info, err := h.getUpload(ctx, store)
+	if err != nil {
+		return err
+	}
+
+	writeUploadHeaders(ctx.w, info)
+	ctx.w.WriteHeader(http.StatusOK)
+
+	return nil
+}
+
+func (h *UploadHandler) writeChunk(ctx *wrapperContext, store UploadStore) error {
+	err := ctx.checkContentType(uploadChunkMimeType)
+	if err != nil {
+		return err
+	}
+
+	offset, err := strconv.ParseInt(ctx.r.Header.Get(uploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		return headerError(uploadOffsetHeader, "expected the offset of the chunk")
+	}
+
+	info, err := h.getUpload(ctx, store)
+	if err != nil {
+		return err
+	}
+
+	// NOTE(patrik): Checked before the size so a client with the wrong
+	// offset gets the offset to resume from, the store checks the offset
+	// again while it holds the lock of the upload
+	if offset != info.Offset || offset > info.Length {
+		return UploadOffsetMismatch(info.Offset)
+	}
+
+	remaining := info.Length - offset
+	if ctx.r.ContentLength > remaining {
+		return UploadTooLarge(info.Length)
+	}
+
+	reader := &chunkReader{
+		r:         ctx.r.Body,
+		length:    info.Length,
+		remaining: remaining,
+	}
+
+	if header := ctx.r.Header.Get(uploadChecksumHeader); header != "" {
+		checksum, ok := parseUploadChecksum(header)
+		if !ok {
+			return headerError(uploadChecksumHeader, "expected \"sha256 <base64>\"")
+		}
+
+		reader.hash = sha256.New()
+		reader.checksum = checksum
+	} else if h.RequireChecksum {
+		return headerError(uploadChecksumHeader, "checksum is required")
+	}
+
+	newOffset, err := store.WriteChunk(ctx.r.Context(), info.Id, offset, reader)
+	if err != nil {
+		var apiErr *Error
+		if errors.As(err, &apiErr) {
+			return apiErr
+		}
+
+		return err
+	}
+
+	info.Offset = newOffset
+	writeUploadHeaders(ctx.w, info)
+	ctx.w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *UploadHandler) verifyDigest(ctx *wrapperContext, store UploadStore, info *UploadInfo) error {
+	content, err := store.Open(ctx.r.Context(), info.Id)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, content)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(hash.Sum(nil), info.Digest) {
+		// NOTE(patrik): The content is wrong so the upload can't be
+		// finished, the client needs to start over
+		err := store.Delete(ctx.r.Context(), info.Id)
+		if err != nil {
+			return err
+		}
+
+		return UploadChecksumMismatch()
+	}
+
+	return nil
+}
+
+// uploadLocks makes sure only one request at a time finalizes an upload
+type uploadLocks struct {
+	mu     sync.Mutex
+	locked map[string]bool
+	// NOTE(patrik): Uploads that are completed but couldn't be deleted
+	// from the store, finalize treats them as removed
+	completed map[string]bool
+}
+
+func newUploadLocks() *uploadLocks {
+	return &uploadLocks{
+		locked:    make(map[string]bool),
+		completed: make(map[string]bool),
+	}
+}
+
+func (l *uploadLocks) isCompleted(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.completed[id]
+}
+
+func (l *uploadLocks) markCompleted(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.completed[id] = true
+}
+
+func (l *uploadLocks) tryLock(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.locked[id] {
+		return false
+	}
+
+	l.locked[id] = true
+
+	return true
+}
+
+func (l *uploadLocks) unlock(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.locked, id)
+}
+
+func (h *UploadHandler) finalize(ctx *wrapperContext, store UploadStore, locks *uploadLocks, errorCallback ErrorCallback) error {
+	// NOTE(patrik): Without the lock two finalize requests for the same
+	// upload could both call OnComplete
+	id := ctx.Param("id")
+	if !locks.tryLock(id) {
+		return UploadLocked()
+	}
+	defer locks.unlock(id)
+
+	if locks.isCompleted(id) {
+		return UploadNotFound()
+	}
+
+	info, err := h.getUpload(ctx, store)
+	if err != nil {
+		return err
+	}
+
+	if info.Offset != info.Length {
+		return UploadIncomplete(info.Offset, info.Length)
+	}
+
+	if info.Digest != nil {
+		err := h.verifyDigest(ctx, store, info)
+		if err != nil {
+			return err
+		}
+	}
+
+	content, err := store.Open(ctx.r.Context(), info.Id)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	data, err := h.OnComplete(ctx, info, content)
+	if err != nil {
+		return err
+	}
+
+	// NOTE(patrik): The upload is done when OnComplete returns, a error
+	// here would make the client retry and call OnComplete again
+	err = store.Delete(ctx.r.Context(), info.Id)
+	if err != nil {
+		locks.markCompleted(info.Id)
+
+		if errorCallback != nil {
+			errorCallback(fmt.Errorf("pyrin: failed to delete completed upload %q: %w", info.Id, err))
+		}
+	}
+
+	writeApiResult(ctx, 0, data)
+
+	return nil
+}
+
+func (g *serverGroup) handleUpload(h UploadHandler) {
+	store := h.Store
+	if store == nil {
+		store = g.server.uploadStore
+	}
+
+	// NOTE(patrik): Without OnComplete every finalize request would panic
+	if h.OnComplete == nil {
+		panic(fmt.Sprintf("pyrin: upload handler %q has no OnComplete", h.Name))
+	}
+
+	locks := newUploadLocks()
+	finalize := func(ctx *wrapperContext, store UploadStore) error {
+		return h.finalize(ctx, store, locks, g.server.errorCallback)
+	}
+
+	routes := []struct {
+		method string
+		path   string
+		run    func(ctx *wrapperContext, store UploadStore) error
+	}{
+		{http.MethodPost, h.Path, h.create},
+		{http.MethodHead, joinPaths(h.Path, "/:id"), h.offset},
+		{http.MethodPatch, joinPaths(h.Path, "/:id"), h.writeChunk},
+		{http.MethodPost, joinPaths(h.Path, "/:id/finalize"), finalize},
+	}
+
+	for _, r := range routes {
+		run := r.run
+
+		g.handle(route{
+			endpoint: EndpointInfo{
+				Name:         h.Name,
+				Method:       r.method,
+				Path:         r.path,
+				Summary:      h.Summary,
+				Description:  h.Description,
+				Tags:         h.Tags,
+				Deprecated:   h.Deprecated,
+				ResponseType: h.ResponseType,
+				Security:     h.Security,
+				Errors:       h.Errors,
+			},
+			rateLimit:   h.RateLimit,
+			middlewares: h.Middlewares,
+			run: func(ctx *wrapperContext) error {
+				return run(ctx, store)
+			},
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package pyrin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDiscardChunk is wrapped by the errors of a chunk reader when the bytes
+// of the chunk can't be trusted, e.g. when the checksum didn't match
+var ErrDiscardChunk = errors.New("pyrin: discard upload chunk")
+
+// UploadInfo is the state of a resumable upload
+type UploadInfo struct {
+	Id string `json:"id"`
+	// Length is the size of the whole file
+	Length int64 `json:"length"`
+	// Offset is the number of bytes the server has received
+	Offset   int64             `json:"offset"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Digest is the SHA-256 of the whole file, nil when the client didn't
+	// send it when the upload was created
+	Digest  []byte    `json:"digest,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// UploadStore stores the resumable uploads, implement it to keep the
+// uploads in e.g. object storage
+type UploadStore interface {
+	// Create stores a new empty upload
+	Create(ctx context.Context, info UploadInfo) error
+	// Get returns the upload, returns nil when the upload doesn't exist
+	Get(ctx context.Context, id string) (*UploadInfo, error)
+	// WriteChunk writes the chunk at the offset and returns the new offset
+	// of the upload. Returns UploadOffsetMismatch when offset is not the
+	// offset of the upload and UploadLocked when a chunk is already being
+	// written. When r fails the bytes read before the error are kept,
+	// unless the error wraps ErrDiscardChunk
+	WriteChunk(ctx context.Context, id string, offset int64, r io.Reader) (int64, error)
+	// Open returns the content of the upload
+	Open(ctx context.Context, id string) (io.ReadCloser, error)
+	// Delete removes the upload
+	Delete(ctx context.Context, id string) error
+}
+
+var _ UploadStore = (*FileUploadStore)(nil)
+
+// FileUploadStore keeps the uploads as files in a directory, the expired
+// uploads are removed when new uploads are created. The directory and the
+// files can only be read by the user running the server
+type FileUploadStore struct {
+	dir string
+
+	mu        sync.Mutex
+	writing   map[string]bool
+	nextSweep time.Time
+}
+
+func NewFileUploadStore(dir string) *FileUploadStore {
+	return &FileUploadStore{
+		dir:     dir,
+		writing: make(map[string]bool),
+	}
+}
+
+func (s *FileUploadStore) infoPath(id string) string {
+	return filepath.Join(s.dir, id+".info")
+}
+
+func (s *FileUploadStore) dataPath(id string) string {
+	return filepath.Join(s.dir, id+".bin")
+}
+
+func (s *FileUploadStore) readInfo(id string) (*UploadInfo, error) {
+	d, err := os.ReadFile(s.infoPath(id))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var info UploadInfo
+	err = json.Unmarshal(d, &info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// NOTE(patrik): Written to a temporary file first so a crash never leaves
+// a half written info file
+func (s *FileUploadStore) writeInfo(info *UploadInfo) error {
+	d, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.infoPath(info.Id) + ".tmp"
+	err = os.WriteFile(tmp, d, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.infoPath(info.Id))
+}
+
+func (s *FileUploadStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+
+	s.nextSweep = now.Add(time.Minute)
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		id, found := strings.CutSuffix(entry.Name(), ".info")
+		if !found || s.writing[id] {
+			continue
+		}
+
+		info, err := s.readInfo(id)
+		if err != nil || info == nil {
+			continue
+		}
+
+		if now.After(info.Expires) {
+			os.Remove(s.dataPath(id))
+			os.Remove(s.infoPath(id))
+		}
+	}
+}
+
+func (s *FileUploadStore) Create(ctx context.Context, info UploadInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(time.Now())
+
+	// NOTE(patrik): Only the user of the server can read the uploads, the
+	// mode is also set when the directory exists so a directory created
+	// by another user is rejected
+	err := os.MkdirAll(s.dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(s.dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.dataPath(info.Id), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	return s.writeInfo(&info)
+}
+
+func (s *FileUploadStore) Get(ctx context.Context, id string) (*UploadInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.readInfo(id)
+}
+
+func (s *FileUploadStore) WriteChunk(ctx context.Context, id string, offset int64, r io.Reader) (int64, error) {
+	s.mu.Lock()
+
+	if s.writing[id] {
+		s.mu.Unlock()
+		return 0, UploadLocked()
+	}
+
+	info, err := s.readInfo(id)
+	if err != nil {
+		s.mu.Unlock()
+		return 0, err
+	}
+
+	if info == nil {
+		s.mu.Unlock()
+		return 0, UploadNotFound()
+	}
+
+	if info.Offset != offset {
+		s.mu.Unlock()
+		return 0, UploadOffsetMismatch(info.Offset)
+	}
+
+	s.writing[id] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.writing, id)
+		s.mu.Unlock()
+	}()
+
+	f, err := os.OpenFile(s.dataPath(id), os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n, chunkErr := io.Copy(io.NewOffsetWriter(f, offset), r)
+	if chunkErr != nil && errors.Is(chunkErr, ErrDiscardChunk) {
+		n = 0
+	}
+
+	err = f.Truncate(offset + n)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	info.Offset = offset + n
+	err = s.writeInfo(info)
+	s.mu.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Offset, chunkErr
+}
+
+func (s *FileUploadStore) Open(ctx context.Context, id string) (io.ReadCloser, error) {
+	f, err := os.Open(s.dataPath(id))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, UploadNotFound()
+		}
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (s *FileUploadStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(s.infoPath(id))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	err = os.Remove(s.dataPath(id))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
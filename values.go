@@ -0,0 +1,128 @@
+package pyrin
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// Key is a typed key for values stored on the request, created with NewKey
+// and used with Set and Get
+type Key[T any] struct {
+	name string
+}
+
+// NewKey creates a new key, the name is only used for debugging, two keys
+// with the same name are still different keys
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{
+		name: name,
+	}
+}
+
+func (k *Key[T]) String() string {
+	return k.name
+}
+
+type requestStoreKey struct{}
+
+// requestStore holds the values of a request, the server adds the store to
+// the request before any middleware runs so values set by a middleware can
+// be read by the handler without replacing the request
+type requestStore struct {
+	mu     sync.RWMutex
+	values map[any]any
+
+	errorHandler func(err error, w http.ResponseWriter, r *http.Request)
+	codecs       []Codec
+	envelope     Envelope
+}
+
+func getRequestStore(r *http.Request) *requestStore {
+	store, _ := r.Context().Value(requestStoreKey{}).(*requestStore)
+	return store
+}
+
+func withRequestStore(r *http.Request, store *requestStore) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestStoreKey{}, store))
+}
+
+// Set stores the value for the key on the request, the value can be read by
+// the middlewares and handlers that runs after
+func Set[T any](c Context, key *Key[T], value T) {
+	ctx, ok := c.(*wrapperContext)
+	if ok && getRequestStore(ctx.r) == nil {
+		// NOTE(patrik): Request not served by the server, e.g. a handler
+		// called directly, add a store so the values still works
+		ctx.r = withRequestStore(ctx.r, &requestStore{})
+	}
+
+	SetRequestValue(c.Request(), key, value)
+}
+
+// Get returns the value for the key, ok is false when the value is not set
+func Get[T any](c Context, key *Key[T]) (T, bool) {
+	return RequestValue(c.Request(), key)
+}
+
+// MustGet returns the value for the key and panics when the value is not
+// set, used when a middleware on the group always sets the value
+func MustGet[T any](c Context, key *Key[T]) T {
+	value, ok := Get(c, key)
+	if !ok {
+		panic("pyrin: value for key '" + key.name + "' is not set")
+	}
+
+	return value
+}
+
+// SetRequestValue is Set for net/http middlewares, the request needs to be
+// served by a pyrin server otherwise the value is dropped
+func SetRequestValue[T any](r *http.Request, key *Key[T], value T) {
+	store := getRequestStore(r)
+	if store == nil {
+		return
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.values == nil {
+		store.values = make(map[any]any)
+	}
+
+	store.values[key] = value
+}
+
+// RequestValue is Get for net/http middlewares
+func RequestValue[T any](r *http.Request, key *Key[T]) (T, bool) {
+	var res T
+
+	store := getRequestStore(r)
+	if store == nil {
+		return res, false
+	}
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	value, exists := store.values[key]
+	if !exists {
+		return res, false
+	}
+
+	return value.(T), true
+}
+
+// WriteError sends the error through the error handler of the server, used
+// by net/http middlewares to stop the request with a *Error the same way a
+// handler would
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	store := getRequestStore(r)
+	if store == nil || store.errorHandler == nil {
+		errorHandler(err, w, r, nil)
+		return
+	}
+
+	store.errorHandler(err, w, r)
+}